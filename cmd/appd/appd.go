@@ -2,12 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/ldej/api-ldej-nl/internal/app"
+	"github.com/ldej/api-ldej-nl/internal/app/db"
 	"github.com/ldej/api-ldej-nl/internal/app/db/datastoredb"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/blob"
 	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/ratelimit"
+	"github.com/ldej/api-ldej-nl/pkg/sharelink"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+	"github.com/ldej/api-ldej-nl/pkg/tracing"
 	_ "github.com/ldej/api-ldej-nl/swagger"
 )
 
@@ -23,6 +39,11 @@ import (
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description An API key as bearer token: "Bearer ak_..."
+
 func main() {
 	projectID := "api-ldej-nl"
 	ctx := context.Background()
@@ -33,17 +54,341 @@ func main() {
 	}
 	addr := fmt.Sprintf(":%s", port)
 
+	// GRPC_PORT=off disables the gRPC API
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	grpcAddr := ""
+	if grpcPort != "off" {
+		grpcAddr = fmt.Sprintf(":%s", grpcPort)
+	}
+
 	logger := log.NewJSONLogger(os.Stderr, projectID, true)
 
-	dbService, err := datastoredb.NewService(ctx, projectID)
+	dbOptions := []db.Option{db.WithLogger(logger)}
+	if os.Getenv("TIME_SORTABLE_IDS") == "true" {
+		dbOptions = append(dbOptions, db.WithIDGenerator(db.TimeSortableID))
+	}
+
+	dbService, err := datastoredb.NewService(ctx, projectID, dbOptions...)
+	if err != nil {
+		logger.Fatal(ctx, err)
+	}
+
+	// `appd create-api-key -name admin -scopes apikeys:manage` issues the first API key
+	if len(os.Args) > 1 && os.Args[1] == "create-api-key" {
+		if err := createAPIKey(ctx, dbService, os.Args[2:]); err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return
+	}
+
+	// `appd backfill-readers` stores the readers of things stored before owners were recorded, so they are listed
+	if len(os.Args) > 1 && os.Args[1] == "backfill-readers" {
+		n, err := datastoredb.BackfillReaders(ctx, dbService)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		fmt.Printf("backfilled the readers of %d things\n", n)
+		return
+	}
+
+	blobStore, err := attachmentStore(ctx)
 	if err != nil {
 		logger.Fatal(ctx, err)
 	}
 
-	server, err := app.NewServer(logger, dbService)
+	// OPENAPI_VALIDATION=requests validates requests against the spec, =all validates responses as well
+	var serverOptions []app.Option
+	switch os.Getenv("OPENAPI_VALIDATION") {
+	case "requests":
+		serverOptions = append(serverOptions, app.WithOpenAPIValidation(false))
+	case "all":
+		serverOptions = append(serverOptions, app.WithOpenAPIValidation(true))
+	}
+
+	// MAX_BODY_SIZE is the maximum size of request bodies in bytes
+	if maxBodySize := os.Getenv("MAX_BODY_SIZE"); maxBodySize != "" {
+		n, err := strconv.ParseInt(maxBodySize, 10, 64)
+		if err != nil || n <= 0 {
+			logger.Fatal(ctx, fmt.Errorf("invalid MAX_BODY_SIZE %q", maxBodySize))
+		}
+		serverOptions = append(serverOptions, app.WithMaxBodySize(n))
+	}
+
+	// AUTHENTICATION=off serves the API without requiring API keys, for local development only
+	if os.Getenv("AUTHENTICATION") != "off" {
+		serverOptions = append(serverOptions, app.WithAuthentication())
+
+		// OIDC_ISSUER accepts JSON Web Tokens of an OpenID Connect provider as well, see jwtConfig
+		if os.Getenv("OIDC_ISSUER") != "" {
+			config, err := jwtConfig()
+			if err != nil {
+				logger.Fatal(ctx, err)
+			}
+			serverOptions = append(serverOptions, app.WithJWTAuthentication(config))
+		}
+	}
+
+	// RATE_LIMIT and RATE_LIMIT_ROUTES limit the requests of every client, see rateLimitConfig
+	if os.Getenv("RATE_LIMIT") != "" || os.Getenv("RATE_LIMIT_ROUTES") != "" {
+		config, err := rateLimitConfig()
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		serverOptions = append(serverOptions, app.WithRateLimits(config))
+	}
+
+	// THING_QUOTA is the maximum number of things every client can own
+	if thingQuota := os.Getenv("THING_QUOTA"); thingQuota != "" {
+		n, err := strconv.Atoi(thingQuota)
+		if err != nil || n <= 0 {
+			logger.Fatal(ctx, fmt.Errorf("invalid THING_QUOTA %q", thingQuota))
+		}
+		serverOptions = append(serverOptions, app.WithThingQuota(n))
+	}
+
+	// CACHE_CONTROL sets the Cache-Control header of routes, see cacheControl
+	if os.Getenv("CACHE_CONTROL") != "" {
+		routes, err := cacheControl()
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		serverOptions = append(serverOptions, app.WithCacheControl(routes))
+	}
+
+	// SHARE_LINK_KEYS are the keys signing share links, the first signs new links, see sharelink.ParseKeys
+	if shareLinkKeys := os.Getenv("SHARE_LINK_KEYS"); shareLinkKeys != "" {
+		keys, err := sharelink.ParseKeys(shareLinkKeys)
+		if err != nil {
+			logger.Fatal(ctx, fmt.Errorf("SHARE_LINK_KEYS: %w", err))
+		}
+		signer, err := sharelink.NewSigner(keys...)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		serverOptions = append(serverOptions, app.WithShareLinks(signer))
+	}
+
+	// METRICS=off stops serving Prometheus metrics on /metrics
+	if os.Getenv("METRICS") != "off" {
+		serverOptions = append(serverOptions, app.WithMetrics("datastore"))
+	}
+
+	// SHUTDOWN_DRAIN is how long the server keeps serving while unready before it shuts down, like 5s
+	if shutdownDrain := os.Getenv("SHUTDOWN_DRAIN"); shutdownDrain != "" {
+		d, err := time.ParseDuration(shutdownDrain)
+		if err != nil || d < 0 {
+			logger.Fatal(ctx, fmt.Errorf("invalid SHUTDOWN_DRAIN %q", shutdownDrain))
+		}
+		serverOptions = append(serverOptions, app.WithShutdownDrain(d))
+	}
+
+	if resolvers := tenantResolvers(); resolvers != nil {
+		serverOptions = append(serverOptions, app.WithTenancy(resolvers...))
+	}
+
+	// the trace context of requests is propagated by the calls made while handling them, with and without tracing
+	otel.SetTextMapPropagator(tracing.Propagator())
+
+	// TRACE_EXPORTER exports the spans of requests and database operations, see tracerProvider
+	var provider *sdktrace.TracerProvider
+	if os.Getenv("TRACE_EXPORTER") != "" {
+		provider, err = tracerProvider(ctx, projectID)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		logger.WithSpans(tracing.SpanIDs)
+		serverOptions = append(serverOptions, app.WithTracing(provider, "datastore"))
+	}
+
+	server, err := app.NewServer(logger, dbService, blobStore, serverOptions...)
 	if err != nil {
 		logger.Fatal(ctx, err)
 	}
 
-	server.ListenAndServe(addr)
+	server.ListenAndServe(addr, grpcAddr)
+
+	if provider != nil {
+		ctxTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctxTimeout); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+}
+
+// tracerProvider exports spans to TRACE_EXPORTER: "otlp" for a collector configured with the
+// OTEL_EXPORTER_OTLP_* environment variables, "stdout" or "file" to write them to TRACE_FILE.
+// TRACE_SAMPLE_RATIO is the ratio of traces sampled when the caller did not decide, all by default.
+func tracerProvider(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
+	ratio := 1.0
+	if sampleRatio := os.Getenv("TRACE_SAMPLE_RATIO"); sampleRatio != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(sampleRatio, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid TRACE_SAMPLE_RATIO %q", sampleRatio)
+		}
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := os.Getenv("TRACE_EXPORTER"); name {
+	case "otlp":
+		exporter, err = tracing.NewOTLPExporter(ctx)
+	case "stdout":
+		exporter, err = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		path := os.Getenv("TRACE_FILE")
+		if path == "" {
+			return nil, errors.New("TRACE_FILE is required with TRACE_EXPORTER=file")
+		}
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = tracing.NewWriterExporter(f)
+	default:
+		return nil, fmt.Errorf("invalid TRACE_EXPORTER %q: expected otlp, stdout or file", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewProvider(exporter, serviceName, ratio), nil
+}
+
+// attachmentStore stores attachments in the Cloud Storage bucket ATTACHMENTS_BUCKET, or in the directory
+// ATTACHMENTS_DIR. A directory is only suitable for a single instance with a persistent disk, the
+// disk of App Engine standard instances is in memory and is lost on restarts.
+func attachmentStore(ctx context.Context) (blob.Store, error) {
+	bucket, dir := os.Getenv("ATTACHMENTS_BUCKET"), os.Getenv("ATTACHMENTS_DIR")
+	switch {
+	case bucket != "" && dir != "":
+		return nil, errors.New("set either ATTACHMENTS_BUCKET or ATTACHMENTS_DIR")
+	case bucket != "":
+		return blob.NewGCSStore(ctx, bucket)
+	case dir != "":
+		return blob.NewFileStore(dir)
+	}
+	return nil, errors.New("ATTACHMENTS_BUCKET or ATTACHMENTS_DIR is required")
+}
+
+// jwtConfig configures JSON Web Token authentication with OIDC_ISSUER, OIDC_AUDIENCE and the key set
+// at OIDC_JWKS_URL or in the file OIDC_JWKS_FILE
+func jwtConfig() (auth.JWTConfig, error) {
+	config := auth.JWTConfig{
+		Issuer:   os.Getenv("OIDC_ISSUER"),
+		Audience: os.Getenv("OIDC_AUDIENCE"),
+		Leeway:   time.Minute,
+	}
+	if config.Audience == "" {
+		return auth.JWTConfig{}, errors.New("OIDC_AUDIENCE is required with OIDC_ISSUER")
+	}
+
+	jwksURL, jwksFile := os.Getenv("OIDC_JWKS_URL"), os.Getenv("OIDC_JWKS_FILE")
+	switch {
+	case jwksURL != "" && jwksFile != "":
+		return auth.JWTConfig{}, errors.New("set either OIDC_JWKS_URL or OIDC_JWKS_FILE")
+	case jwksURL != "":
+		config.Keys = auth.NewRemoteKeySet(jwksURL, &http.Client{Timeout: 10 * time.Second})
+	case jwksFile != "":
+		config.Keys = auth.NewFileKeySet(jwksFile)
+	default:
+		return auth.JWTConfig{}, errors.New("OIDC_JWKS_URL or OIDC_JWKS_FILE is required with OIDC_ISSUER")
+	}
+	return config, nil
+}
+
+// rateLimitConfig limits the requests of every client to RATE_LIMIT, like 60/1m, and the requests to
+// routes to the limits of RATE_LIMIT_ROUTES, like "POST /v1/thing/new=10/1m,POST /v2/thing=10/1m".
+// Clients are identified by their App Engine IP address when they are not authenticated.
+func rateLimitConfig() (app.RateLimitConfig, error) {
+	config := app.RateLimitConfig{
+		Routes:   map[string]ratelimit.Limit{},
+		IPHeader: "X-Appengine-User-Ip",
+	}
+	if limit := os.Getenv("RATE_LIMIT"); limit != "" {
+		var err error
+		config.Limit, err = ratelimit.ParseLimit(limit)
+		if err != nil {
+			return app.RateLimitConfig{}, fmt.Errorf("RATE_LIMIT: %w", err)
+		}
+	}
+	if routes := os.Getenv("RATE_LIMIT_ROUTES"); routes != "" {
+		for _, route := range strings.Split(routes, ",") {
+			route, limit, ok := strings.Cut(strings.TrimSpace(route), "=")
+			if !ok {
+				return app.RateLimitConfig{}, fmt.Errorf("RATE_LIMIT_ROUTES: expected route=limit, got %q", route)
+			}
+			l, err := ratelimit.ParseLimit(limit)
+			if err != nil {
+				return app.RateLimitConfig{}, fmt.Errorf("RATE_LIMIT_ROUTES: %w", err)
+			}
+			config.Routes[route] = l
+		}
+	}
+	return config, nil
+}
+
+// cacheControl parses the Cache-Control directives of routes in CACHE_CONTROL, separated by semicolons
+// as directives contain commas: "GET /v1/thing/{uuid}=private, max-age=60;GET /v1/thing=no-cache"
+func cacheControl() (map[string]string, error) {
+	routes := map[string]string{}
+	for _, route := range strings.Split(os.Getenv("CACHE_CONTROL"), ";") {
+		route, directives, ok := strings.Cut(strings.TrimSpace(route), "=")
+		if !ok || directives == "" {
+			return nil, fmt.Errorf("CACHE_CONTROL: expected route=directives, got %q", route)
+		}
+		routes[route] = directives
+	}
+	return routes, nil
+}
+
+// tenantResolvers resolve the tenant of requests from the TENANT_HEADER header, the subdomain of
+// TENANT_DOMAIN and the TENANT_CLAIM claim of JSON Web Tokens, tenancy is disabled when none is set.
+// Tokens without the claim are rejected, like API keys without tenant.
+func tenantResolvers() []tenant.Resolver {
+	var resolvers []tenant.Resolver
+	if header := os.Getenv("TENANT_HEADER"); header != "" {
+		resolvers = append(resolvers, tenant.Header(header))
+	}
+	if domain := os.Getenv("TENANT_DOMAIN"); domain != "" {
+		resolvers = append(resolvers, tenant.Subdomain(domain))
+	}
+	if claim := os.Getenv("TENANT_CLAIM"); claim != "" {
+		resolvers = append(resolvers, tenant.Claim(claim))
+	}
+	return resolvers
+}
+
+// createAPIKey issues an API key and prints it, it cannot be retrieved later
+func createAPIKey(ctx context.Context, dbService db.Service, args []string) error {
+	flags := flag.NewFlagSet("create-api-key", flag.ContinueOnError)
+	name := flags.String("name", "", "the name of the API key")
+	scopes := flags.String("scopes", strings.Join([]string{app.ScopeThingsRead, app.ScopeThingsWrite}, ","), "comma separated scopes")
+	keyTenant := flags.String("tenant", "", "the tenant the API key is bound to, required to access things when tenancy is enabled")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("-name is required")
+	}
+
+	granted := strings.Split(*scopes, ",")
+	for _, scope := range granted {
+		switch scope {
+		case app.ScopeThingsRead, app.ScopeThingsWrite, app.ScopeThingsAdmin, app.ScopeAPIKeysManage:
+		default:
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	apiKey, key, err := app.IssueAPIKey(ctx, dbService, *name, granted, *keyTenant)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("id: %s\nscopes: %s\ntenant: %s\nkey: %s\n", apiKey.ID, strings.Join(apiKey.Scopes, ","), apiKey.Tenant, key)
+	return nil
 }
@@ -0,0 +1,39 @@
+// Command openapigen converts the Swagger 2.0 document generated by swag into an OpenAPI 3 document
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ldej/api-ldej-nl/pkg/openapi"
+)
+
+func main() {
+	in := flag.String("in", "swagger/swagger.json", "Swagger 2.0 document")
+	out := flag.String("out", "swagger/openapi.json", "OpenAPI 3 document")
+	flag.Parse()
+
+	if err := run(*in, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "openapigen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in string, out string) error {
+	spec, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	doc, err := openapi.Load(spec)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, append(data, '\n'), 0644)
+}
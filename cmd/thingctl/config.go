@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultEndpoint = "http://localhost:8080"
+
+// config is read from a YAML file, the environment variables THINGCTL_ENDPOINT and THINGCTL_TOKEN take precedence
+type config struct {
+	Endpoint string        `yaml:"endpoint"`
+	Token    string        `yaml:"token"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// defaultConfigPath is $THINGCTL_CONFIG or thingctl/config.yaml in the user config directory
+func defaultConfigPath() string {
+	if path := os.Getenv("THINGCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "thingctl", "config.yaml")
+}
+
+// loadConfig reads the config file at path, a missing file results in the default config
+func loadConfig(path string) (config, error) {
+	cfg := config{Endpoint: defaultEndpoint}
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return config{}, err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(b, &cfg); err != nil {
+				return config{}, err
+			}
+		}
+	}
+
+	if endpoint := os.Getenv("THINGCTL_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = endpoint
+	}
+	if token := os.Getenv("THINGCTL_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	return cfg, nil
+}
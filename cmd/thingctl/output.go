@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ldej/api-ldej-nl/pkg/client"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printThings writes things in the given output format, a single thing is written as an object instead of a list
+func printThings(w io.Writer, output string, single bool, things ...client.Thing) error {
+	var v interface{} = things
+	if single && len(things) == 1 {
+		v = things[0]
+	}
+
+	switch output {
+	case outputTable:
+		return printTable(w, things)
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		// converting through JSON keeps the field names of the API and renders data as YAML
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or yaml", output)
+}
+
+func printTable(w io.Writer, things []client.Thing) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tNAME\tVALUE\tKIND\tLABELS\tPARENT\tUPDATED")
+	for _, thing := range things {
+		value := thing.Value
+		if thing.Kind != "" {
+			value = string(thing.Data)
+		}
+		kind := thing.Kind
+		if kind != "" {
+			kind = fmt.Sprintf("%s/%d", thing.Kind, thing.KindVersion)
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			thing.UUID,
+			thing.Name,
+			truncate(value, 40),
+			kind,
+			formatLabels(thing.Labels),
+			thing.Parent,
+			thing.Updated.Format(time.RFC3339),
+		)
+	}
+	return tw.Flush()
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,403 @@
+// Command thingctl manages the things of api.ldej.nl
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ldej/api-ldej-nl/pkg/client"
+)
+
+const usage = `Usage: thingctl [-config file] [-endpoint url] <command> [flags] [args]
+
+Commands:
+  get [-o table|json|yaml] <uuid>                    Get a thing
+  list [-o table|json|yaml] [-selector s] [-limit n] List all things, optionally filtered by a label selector
+  create [-o ...] [-f file] [thing flags]            Create a thing from flags or a JSON file
+  update [-o ...] [-f file] [thing flags] <uuid>     Update a thing, or create it with this uuid
+  delete [-cascade] <uuid>...                        Delete things, with -cascade including their descendants
+  export [-selector s] [-f file]                     Write things as JSON lines to stdout or a file
+  import [-f file]                                   Create or update things from JSON lines on stdin or a file
+
+Thing flags: -name, -value, -kind, -data (JSON), -parent and -label key=value (repeatable)
+
+The endpoint and token are read from the config file (default $THINGCTL_CONFIG or
+<user config dir>/thingctl/config.yaml), THINGCTL_ENDPOINT and THINGCTL_TOKEN override them.
+`
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "thingctl:", err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("see thingctl -h for usage")
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("thingctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	configPath := flags.String("config", defaultConfigPath(), "config file")
+	endpoint := flags.String("endpoint", "", "API endpoint, overrides the config")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	if *endpoint != "" {
+		cfg.Endpoint = *endpoint
+	}
+	var opts []client.Option
+	if cfg.Token != "" {
+		opts = append(opts, client.WithHeader("Authorization", "Bearer "+cfg.Token))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, client.WithTimeout(cfg.Timeout))
+	}
+	c := client.New(cfg.Endpoint, opts...)
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "get":
+		return get(ctx, c, args, stdout)
+	case "list":
+		return list(ctx, c, args, stdout)
+	case "create":
+		return create(ctx, c, args, stdin, stdout)
+	case "update":
+		return update(ctx, c, args, stdin, stdout)
+	case "delete":
+		return remove(ctx, c, args)
+	case "export":
+		return export(ctx, c, args, stdout)
+	case "import":
+		return importThings(ctx, c, args, stdin)
+	}
+	flags.Usage()
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func newFlagSet(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	return flags
+}
+
+func get(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	flags := newFlagSet("get")
+	output := flags.String("o", outputTable, "output format: table, json or yaml")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+
+	thing, err := c.GetThing(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printThings(stdout, *output, true, thing)
+}
+
+func list(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	flags := newFlagSet("list")
+	output := flags.String("o", outputTable, "output format: table, json or yaml")
+	selector := flags.String("selector", "", "label selector, e.g. env=prod,team in (a,b),!deprecated")
+	limit := flags.Int("limit", 0, "maximum number of things, 0 lists all things")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	things := []client.Thing{}
+	it := c.IterateThings(ctx, client.ListOptions{Limit: 100, LabelSelector: *selector})
+	for (*limit <= 0 || len(things) < *limit) && it.Next() {
+		things = append(things, it.Thing())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return printThings(stdout, *output, false, things...)
+}
+
+// thingFlags are the flags used to create or update a thing
+type thingFlags struct {
+	file   *string
+	name   *string
+	value  *string
+	kind   *string
+	data   *string
+	parent *string
+	labels labelsFlag
+}
+
+func newThingFlags(flags *flag.FlagSet) *thingFlags {
+	f := &thingFlags{
+		file:   flags.String("f", "", "JSON file with the thing, - reads stdin"),
+		name:   flags.String("name", "", "name"),
+		value:  flags.String("value", "", "value of a thing without a kind"),
+		kind:   flags.String("kind", "", "kind"),
+		data:   flags.String("data", "", "JSON data of a thing with a kind"),
+		parent: flags.String("parent", "", "uuid of the parent, an empty string moves a thing to the root"),
+	}
+	flags.Var(&f.labels, "label", "label as key=value, can be repeated")
+	return f
+}
+
+func (f *thingFlags) isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// readFile decodes the JSON file given with -f into v
+func (f *thingFlags) readFile(stdin io.Reader, v interface{}) error {
+	r := stdin
+	if *f.file != "-" {
+		file, err := os.Open(*f.file)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	return json.NewDecoder(r).Decode(v)
+}
+
+func create(ctx context.Context, c *client.Client, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := newFlagSet("create")
+	output := flags.String("o", outputTable, "output format: table, json or yaml")
+	f := newThingFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errUsage
+	}
+
+	thing := client.CreateThing{
+		Name:   *f.name,
+		Value:  *f.value,
+		Labels: f.labels.labels,
+		Kind:   *f.kind,
+		Data:   jsonOrNil(*f.data),
+		Parent: *f.parent,
+	}
+	if *f.file != "" {
+		if err := f.readFile(stdin, &thing); err != nil {
+			return err
+		}
+	}
+
+	created, err := c.CreateThing(ctx, thing)
+	if err != nil {
+		return err
+	}
+	return printThings(stdout, *output, true, created)
+}
+
+func update(ctx context.Context, c *client.Client, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := newFlagSet("update")
+	output := flags.String("o", outputTable, "output format: table, json or yaml")
+	f := newThingFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+
+	thing := client.UpdateThing{
+		Name:  *f.name,
+		Value: *f.value,
+		Kind:  *f.kind,
+		Data:  jsonOrNil(*f.data),
+	}
+	if f.labels.labels != nil {
+		thing.Labels = &f.labels.labels
+	}
+	if f.isSet(flags, "parent") {
+		thing.Parent = f.parent
+	}
+	if *f.file != "" {
+		if err := f.readFile(stdin, &thing); err != nil {
+			return err
+		}
+	}
+
+	updated, _, err := c.UpdateThing(ctx, flags.Arg(0), thing)
+	if err != nil {
+		return err
+	}
+	return printThings(stdout, *output, true, updated)
+}
+
+func remove(ctx context.Context, c *client.Client, args []string) error {
+	flags := newFlagSet("delete")
+	cascade := flags.Bool("cascade", false, "delete the descendants of the things as well")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errUsage
+	}
+
+	for _, uuid := range flags.Args() {
+		if err := c.DeleteThing(ctx, uuid, *cascade); err != nil {
+			return fmt.Errorf("deleting %s: %w", uuid, err)
+		}
+	}
+	return nil
+}
+
+func export(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	flags := newFlagSet("export")
+	selector := flags.String("selector", "", "label selector, e.g. env=prod,team in (a,b),!deprecated")
+	file := flags.String("f", "", "file to write to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	w := stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	it := c.IterateThings(ctx, client.ListOptions{Limit: 100, LabelSelector: *selector})
+	for it.Next() {
+		if err := enc.Encode(it.Thing()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// importThings upserts exported things keeping their uuids, parents are imported before their children
+func importThings(ctx context.Context, c *client.Client, args []string, stdin io.Reader) error {
+	flags := newFlagSet("import")
+	file := flags.String("f", "", "file to read from instead of stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	r := stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var things []client.Thing
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var thing client.Thing
+		err := dec.Decode(&thing)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		things = append(things, thing)
+	}
+
+	sortByDepth(things)
+	for _, thing := range things {
+		parent := thing.Parent
+		// the labels of an existing thing are replaced, also when the imported thing has none
+		labels := thing.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		_, _, err := c.UpdateThing(ctx, thing.UUID, client.UpdateThing{
+			Name:   thing.Name,
+			Value:  thing.Value,
+			Labels: &labels,
+			Kind:   thing.Kind,
+			Data:   thing.Data,
+			Parent: &parent,
+		})
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", thing.UUID, err)
+		}
+	}
+	return nil
+}
+
+// sortByDepth sorts things on their depth in the hierarchy formed by the things themselves
+func sortByDepth(things []client.Thing) {
+	parents := make(map[string]string, len(things))
+	for _, thing := range things {
+		parents[thing.UUID] = thing.Parent
+	}
+	depth := func(uuid string) int {
+		d := 0
+		for p, ok := parents[uuid]; ok && p != "" && d <= len(things); p, ok = parents[p] {
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(things, func(i, j int) bool {
+		return depth(things[i].UUID) < depth(things[j].UUID)
+	})
+}
+
+func jsonOrNil(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// labelsFlag collects repeated -label key=value flags
+type labelsFlag struct {
+	labels map[string]string
+}
+
+func (l *labelsFlag) String() string {
+	return formatLabels(l.labels)
+}
+
+func (l *labelsFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid label %q, use key=value", s)
+	}
+	if l.labels == nil {
+		l.labels = map[string]string{}
+	}
+	l.labels[parts[0]] = parts[1]
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/client"
+)
+
+// fakeAPI serves the thing routes of the API used by thingctl from memory
+type fakeAPI struct {
+	things map[string]client.Thing
+	// authorization is the Authorization header of the last request
+	authorization string
+	// upserted are the uuids of all updated or created things in order
+	upserted []string
+}
+
+func newFakeAPI(t *testing.T, things ...client.Thing) (*fakeAPI, string) {
+	api := &fakeAPI{things: map[string]client.Thing{}}
+	for _, thing := range things {
+		api.things[thing.UUID] = thing
+	}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, server.URL
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.authorization = r.Header.Get("Authorization")
+	uuid := strings.TrimPrefix(r.URL.Path, "/v1/thing/")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/thing":
+		uuids := make([]string, 0, len(f.things))
+		for uuid := range f.things {
+			uuids = append(uuids, uuid)
+		}
+		sort.Strings(uuids)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		things := client.Things{Total: len(uuids), Page: page, Limit: limit, Things: []client.Thing{}}
+		for i := (page - 1) * limit; i < len(uuids) && i < page*limit; i++ {
+			things.Things = append(things.Things, f.things[uuids[i]])
+		}
+		writeJSON(w, http.StatusOK, things)
+	case r.Method == http.MethodGet:
+		thing, ok := f.things[uuid]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "thing not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, thing)
+	case r.Method == http.MethodPut:
+		var update client.UpdateThing
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		thing, exists := f.things[uuid]
+		if update.Parent != nil {
+			if _, ok := f.things[*update.Parent]; *update.Parent != "" && !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "parent not found"})
+				return
+			}
+			thing.Parent = *update.Parent
+		}
+		thing.UUID = uuid
+		thing.Name = update.Name
+		thing.Value = update.Value
+		if update.Labels != nil {
+			thing.Labels = *update.Labels
+		}
+		f.things[uuid] = thing
+		f.upserted = append(f.upserted, uuid)
+		if exists {
+			writeJSON(w, http.StatusOK, thing)
+		} else {
+			writeJSON(w, http.StatusCreated, thing)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.things, uuid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// runThingctl runs thingctl with args and returns what it wrote to stdout
+func runThingctl(stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout)
+	return stdout.String(), err
+}
+
+func writeConfig(t *testing.T, config string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	return path
+}
+
+func TestConfig(t *testing.T) {
+	api, endpoint := newFakeAPI(t, client.Thing{UUID: "abc", Name: "name"})
+	t.Setenv("THINGCTL_ENDPOINT", "")
+	t.Setenv("THINGCTL_TOKEN", "")
+
+	path := writeConfig(t, "endpoint: "+endpoint+"\ntoken: from-config\ntimeout: 5s\n")
+	_, err := runThingctl("", "-config", path, "get", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer from-config", api.authorization)
+
+	// the environment takes precedence over the config file
+	t.Setenv("THINGCTL_TOKEN", "from-env")
+	_, err = runThingctl("", "-config", path, "get", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer from-env", api.authorization)
+
+	// and the -endpoint flag over both
+	t.Setenv("THINGCTL_ENDPOINT", "http://localhost:1")
+	_, err = runThingctl("", "-config", path, "-endpoint", endpoint, "get", "abc")
+	require.NoError(t, err)
+
+	// a missing config file is not an error, the defaults and environment are used
+	t.Setenv("THINGCTL_ENDPOINT", endpoint)
+	_, err = runThingctl("", "-config", filepath.Join(t.TempDir(), "missing.yaml"), "get", "abc")
+	require.NoError(t, err)
+
+	_, err = runThingctl("", "-config", writeConfig(t, "endpoint: [invalid"), "get", "abc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reading config")
+
+	_, err = runThingctl("", "-config", path, "unknown")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown command "unknown"`)
+}
+
+func TestGetAndList(t *testing.T) {
+	updated := time.Date(2022, time.January, 2, 3, 4, 5, 0, time.UTC)
+	_, endpoint := newFakeAPI(t,
+		client.Thing{UUID: "abc", Name: "project", Value: "value", Labels: map[string]string{"team": "a", "env": "prod"}, Updated: updated},
+		client.Thing{UUID: "def", Name: "config", Kind: "port", KindVersion: 2, Data: json.RawMessage(`{"port":8080}`), Parent: "abc", Updated: updated},
+	)
+	t.Setenv("THINGCTL_TOKEN", "")
+	t.Setenv("THINGCTL_ENDPOINT", endpoint)
+	config := filepath.Join(t.TempDir(), "missing.yaml")
+
+	out, err := runThingctl("", "-config", config, "get", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "UUID  NAME     VALUE  KIND  LABELS           PARENT  UPDATED\n"+
+		"abc   project  value        env=prod,team=a          2022-01-02T03:04:05Z\n", out)
+
+	out, err = runThingctl("", "-config", config, "get", "-o", "json", "def")
+	require.NoError(t, err)
+	var thing client.Thing
+	require.NoError(t, json.Unmarshal([]byte(out), &thing), "a single thing is an object")
+	assert.Equal(t, "config", thing.Name)
+
+	out, err = runThingctl("", "-config", config, "get", "-o", "yaml", "def")
+	require.NoError(t, err)
+	assert.Contains(t, out, "data:\n  port: 8080\n")
+	assert.Contains(t, out, "kind: port\n")
+
+	_, err = runThingctl("", "-config", config, "get", "missing")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	_, err = runThingctl("", "-config", config, "get", "-o", "xml", "abc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown output format "xml"`)
+
+	out, err = runThingctl("", "-config", config, "list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "abc "))
+	assert.True(t, strings.HasPrefix(lines[2], "def "))
+	assert.Contains(t, lines[2], "port/2")
+	assert.Contains(t, lines[2], `{"port":8080}`)
+
+	out, err = runThingctl("", "-config", config, "list", "-o", "json", "-limit", "1")
+	require.NoError(t, err)
+	var things []client.Thing
+	require.NoError(t, json.Unmarshal([]byte(out), &things), "a list is an array")
+	assert.Len(t, things, 1)
+}
+
+func TestExportImport(t *testing.T) {
+	_, endpoint := newFakeAPI(t,
+		client.Thing{UUID: "a", Name: "project", Labels: map[string]string{"env": "prod"}},
+		client.Thing{UUID: "b", Name: "environment", Parent: "a"},
+		client.Thing{UUID: "c", Name: "config", Parent: "b"},
+	)
+	t.Setenv("THINGCTL_TOKEN", "")
+	t.Setenv("THINGCTL_ENDPOINT", endpoint)
+	config := filepath.Join(t.TempDir(), "missing.yaml")
+
+	exported, err := runThingctl("", "-config", config, "export")
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(exported), "\n"), 3)
+
+	// children come before their parents in the input, parents are imported first
+	lines := strings.Split(strings.TrimSpace(exported), "\n")
+	reversed := strings.Join([]string{lines[2], lines[1], lines[0]}, "\n")
+
+	api, endpoint := newFakeAPI(t)
+	t.Setenv("THINGCTL_ENDPOINT", endpoint)
+	_, err = runThingctl(reversed, "-config", config, "import")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, api.upserted)
+	assert.Equal(t, "b", api.things["c"].Parent)
+	assert.Equal(t, map[string]string{"env": "prod"}, api.things["a"].Labels)
+
+	// importing again replaces the labels of existing things
+	api.things["b"] = client.Thing{UUID: "b", Name: "environment", Parent: "a", Labels: map[string]string{"stale": "true"}}
+	_, err = runThingctl(exported, "-config", config, "import")
+	require.NoError(t, err)
+	assert.Empty(t, api.things["b"].Labels)
+
+	_, err = runThingctl("not json", "-config", config, "import")
+	assert.Error(t, err)
+}
+
+func TestSortByDepth(t *testing.T) {
+	things := []client.Thing{
+		{UUID: "d", Parent: "c"},
+		{UUID: "c", Parent: "b"},
+		{UUID: "x", Parent: "outside"},
+		{UUID: "b", Parent: "a"},
+		{UUID: "a"},
+		// a cycle does not loop forever
+		{UUID: "y", Parent: "z"},
+		{UUID: "z", Parent: "y"},
+	}
+	sortByDepth(things)
+
+	position := map[string]int{}
+	for i, thing := range things {
+		position[thing.UUID] = i
+	}
+	assert.Less(t, position["a"], position["b"])
+	assert.Less(t, position["b"], position["c"])
+	assert.Less(t, position["c"], position["d"])
+	// a parent which is not imported is expected to exist already
+	assert.Less(t, position["x"], position["b"])
+}
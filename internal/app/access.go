@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+)
+
+// errForbidden is returned when a principal can read a thing but not modify it, things which
+// cannot be read are not found
+var errForbidden = errors.New("access to the thing is denied")
+
+// accessControl enforces the ACLs of things for the principal of the context. Things created by
+// a principal are owned by it, without a principal or with the things:admin scope all things are
+// accessible.
+type accessControl struct {
+	db.Service
+}
+
+// viewer returns the viewer of ctx, nil when all things are accessible
+func viewer(ctx context.Context) *db.Viewer {
+	p, ok := auth.FromContext(ctx)
+	if !ok || p.HasScope(ScopeThingsAdmin) {
+		return nil
+	}
+	return &db.Viewer{Principal: p.ID, Groups: p.Groups}
+}
+
+// owner returns the owner of the things created with ctx
+func owner(ctx context.Context) string {
+	p, _ := auth.FromContext(ctx)
+	return p.ID
+}
+
+// checkAccess returns ErrThingNotFound when the viewer of ctx cannot read thing and errForbidden
+// when it needs write access but can only read it
+func checkAccess(ctx context.Context, thing db.Thing, level db.AccessLevel) error {
+	access := viewer(ctx).Access(thing)
+	if access == db.NoAccess {
+		return db.ErrThingNotFound
+	}
+	if level == db.WriteAccess && access != db.WriteAccess {
+		return errForbidden
+	}
+	return nil
+}
+
+// thing returns the thing with uuid when the viewer of ctx has access at level, a share link grants
+// read access to its thing
+func (a accessControl) thing(ctx context.Context, uuid string, level db.AccessLevel) (db.Thing, error) {
+	thing, err := a.Service.GetThing(ctx, uuid)
+	if err != nil {
+		return db.Thing{}, err
+	}
+	if shared, ok := sharedThing(ctx); ok && shared == uuid && level == db.ReadAccess {
+		return thing, nil
+	}
+	if err := checkAccess(ctx, thing, level); err != nil {
+		return db.Thing{}, err
+	}
+	return thing, nil
+}
+
+// parent checks that the viewer of ctx can write the new parent of input, if any
+func (a accessControl) parent(ctx context.Context, input db.ThingInput) error {
+	if input.ParentUUID == nil || *input.ParentUUID == "" {
+		return nil
+	}
+	_, err := a.thing(ctx, *input.ParentUUID, db.WriteAccess)
+	if err == db.ErrThingNotFound {
+		return db.ErrParentNotFound
+	}
+	return err
+}
+
+func (a accessControl) GetThing(ctx context.Context, uuid string) (db.Thing, error) {
+	return a.thing(ctx, uuid, db.ReadAccess)
+}
+
+func (a accessControl) GetThingsByUUID(ctx context.Context, uuids []string) ([]db.Thing, error) {
+	things, err := a.Service.GetThingsByUUID(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+	v := viewer(ctx)
+	var readable []db.Thing
+	for _, thing := range things {
+		if v.CanRead(thing) {
+			readable = append(readable, thing)
+		}
+	}
+	return readable, nil
+}
+
+func (a accessControl) CreateThing(ctx context.Context, input db.ThingInput) (db.Thing, error) {
+	if err := a.parent(ctx, input); err != nil {
+		return db.Thing{}, err
+	}
+	input.Owner = owner(ctx)
+	return a.Service.CreateThing(ctx, input)
+}
+
+func (a accessControl) UpdateThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, error) {
+	if _, err := a.thing(ctx, uuid, db.WriteAccess); err != nil {
+		return db.Thing{}, err
+	}
+	if err := a.parent(ctx, input); err != nil {
+		return db.Thing{}, err
+	}
+	return a.Service.UpdateThing(ctx, uuid, input)
+}
+
+func (a accessControl) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	existing, err := a.Service.GetThing(ctx, uuid)
+	switch {
+	case err == db.ErrThingNotFound:
+		input.Owner = owner(ctx)
+	case err != nil:
+		return db.Thing{}, false, err
+	default:
+		if err := checkAccess(ctx, existing, db.WriteAccess); err != nil {
+			return db.Thing{}, false, err
+		}
+	}
+	if err := a.parent(ctx, input); err != nil {
+		return db.Thing{}, false, err
+	}
+	return a.Service.UpsertThing(ctx, uuid, input)
+}
+
+// DeleteThing requires write access to the thing only, its descendants are deleted with it
+func (a accessControl) DeleteThing(ctx context.Context, uuid string, policy db.DeletePolicy) ([]db.Attachment, error) {
+	if _, err := a.thing(ctx, uuid, db.WriteAccess); err != nil {
+		return nil, err
+	}
+	return a.Service.DeleteThing(ctx, uuid, policy)
+}
+
+func (a accessControl) GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, _ *db.Viewer) ([]db.Thing, int, error) {
+	return a.Service.GetThings(ctx, offset, limit, selector, viewer(ctx))
+}
+
+func (a accessControl) GetChildren(ctx context.Context, uuid string, offset int, limit int, _ *db.Viewer) ([]db.Thing, int, error) {
+	if _, err := a.thing(ctx, uuid, db.ReadAccess); err != nil {
+		return nil, 0, err
+	}
+	return a.Service.GetChildren(ctx, uuid, offset, limit, viewer(ctx))
+}
+
+// GetAncestors leaves out the ancestors the viewer cannot read
+func (a accessControl) GetAncestors(ctx context.Context, uuid string) ([]db.Thing, error) {
+	if _, err := a.thing(ctx, uuid, db.ReadAccess); err != nil {
+		return nil, err
+	}
+	ancestors, err := a.Service.GetAncestors(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	v := viewer(ctx)
+	readable := []db.Thing{}
+	for _, ancestor := range ancestors {
+		if v.CanRead(ancestor) {
+			readable = append(readable, ancestor)
+		}
+	}
+	return readable, nil
+}
+
+// SetThingACL is only allowed for the owner of a thing
+func (a accessControl) SetThingACL(ctx context.Context, uuid string, acl db.ACL) (db.Thing, error) {
+	thing, err := a.thing(ctx, uuid, db.ReadAccess)
+	if err != nil {
+		return db.Thing{}, err
+	}
+	if v := viewer(ctx); v != nil && v.Principal != thing.Owner {
+		return db.Thing{}, errForbidden
+	}
+	return a.Service.SetThingACL(ctx, uuid, acl)
+}
+
+func (a accessControl) CreateAttachment(ctx context.Context, attachment db.Attachment) (db.Attachment, error) {
+	if _, err := a.thing(ctx, attachment.ThingUUID, db.WriteAccess); err != nil {
+		return db.Attachment{}, err
+	}
+	return a.Service.CreateAttachment(ctx, attachment)
+}
+
+func (a accessControl) GetAttachment(ctx context.Context, thingUUID string, uuid string) (db.Attachment, error) {
+	if _, err := a.thing(ctx, thingUUID, db.ReadAccess); err == db.ErrThingNotFound {
+		return db.Attachment{}, db.ErrAttachmentNotFound
+	} else if err != nil {
+		return db.Attachment{}, err
+	}
+	return a.Service.GetAttachment(ctx, thingUUID, uuid)
+}
+
+func (a accessControl) GetAttachments(ctx context.Context, thingUUID string) ([]db.Attachment, error) {
+	if _, err := a.thing(ctx, thingUUID, db.ReadAccess); err != nil {
+		return nil, err
+	}
+	return a.Service.GetAttachments(ctx, thingUUID)
+}
+
+func (a accessControl) DeleteAttachment(ctx context.Context, thingUUID string, uuid string) error {
+	if _, err := a.thing(ctx, thingUUID, db.WriteAccess); err != nil {
+		return err
+	}
+	return a.Service.DeleteAttachment(ctx, thingUUID, uuid)
+}
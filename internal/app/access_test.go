@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestAccessControl(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "public", Name: "public"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	owner := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	reader := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	writer := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	stranger := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	admin := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite, ScopeThingsAdmin)
+	ownerID := principalID(owner)
+	readerID := principalID(reader)
+	writerID := principalID(writer)
+
+	w := doAuthenticated(s, http.MethodPost, "/v1/thing/new", owner, `{"name":"private","value":"value"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created ThingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, ownerID, created.Owner)
+	thing := "/v1/thing/" + created.UUID
+
+	w = doAuthenticated(s, http.MethodPut, thing+"/acl", owner, `{"grants":[{"principal":"`+readerID+`","level":"read"},{"principal":"`+writerID+`","level":"write"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var acl ACLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &acl))
+	assert.Equal(t, ownerID, acl.Owner)
+	assert.Len(t, acl.Grants, 2)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		body   string
+		code   int
+	}{
+		{"owner reads", http.MethodGet, thing, owner, "", http.StatusOK},
+		{"reader reads", http.MethodGet, thing, reader, "", http.StatusOK},
+		{"stranger cannot read", http.MethodGet, thing, stranger, "", http.StatusNotFound},
+		{"stranger reads public", http.MethodGet, "/v1/thing/public", stranger, "", http.StatusOK},
+		{"stranger cannot delete public", http.MethodDelete, "/v1/thing/public", stranger, "", http.StatusForbidden},
+		{"admin reads", http.MethodGet, thing, admin, "", http.StatusOK},
+		{"reader cannot write", http.MethodPut, thing, reader, `{"value":"changed"}`, http.StatusForbidden},
+		{"stranger cannot write", http.MethodPut, thing, stranger, `{"value":"changed"}`, http.StatusNotFound},
+		{"writer writes", http.MethodPut, thing, writer, `{"value":"changed"}`, http.StatusOK},
+		{"writer cannot share", http.MethodPut, thing + "/acl", writer, `{"grants":[]}`, http.StatusForbidden},
+		{"stranger cannot see acl", http.MethodGet, thing + "/acl", stranger, "", http.StatusNotFound},
+		{"grant without principal or group", http.MethodPut, thing + "/acl", owner, `{"grants":[{"level":"read"}]}`, http.StatusBadRequest},
+		{"grant with unknown level", http.MethodPut, thing + "/acl", owner, `{"grants":[{"group":"ops","level":"admin"}]}`, http.StatusBadRequest},
+		{"reader cannot delete", http.MethodDelete, thing, reader, "", http.StatusForbidden},
+		{"stranger cannot delete", http.MethodDelete, "/v2/thing/" + created.UUID, stranger, "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doAuthenticated(s, test.method, test.target, test.key, test.body)
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+		})
+	}
+
+	list := func(key string) []string {
+		w := doAuthenticated(s, http.MethodGet, "/v1/thing", key, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response ThingsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var uuids []string
+		for _, thing := range response.Things {
+			uuids = append(uuids, thing.UUID)
+		}
+		return uuids
+	}
+	assert.Equal(t, []string{"public", created.UUID}, list(reader))
+	assert.Equal(t, []string{"public"}, list(stranger))
+	assert.Equal(t, []string{"public", created.UUID}, list(admin))
+
+	w = doAuthenticated(s, http.MethodDelete, thing, admin, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestViewerAccess(t *testing.T) {
+	thing := db.Thing{
+		Owner: "owner",
+		ACL: db.ACL{
+			{Principal: "reader", Level: db.ReadAccess},
+			{Group: "editors", Level: db.WriteAccess},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		viewer *db.Viewer
+		thing  db.Thing
+		access db.AccessLevel
+	}{
+		{"no viewer", nil, thing, db.WriteAccess},
+		{"owner", &db.Viewer{Principal: "owner"}, thing, db.WriteAccess},
+		{"principal grant", &db.Viewer{Principal: "reader"}, thing, db.ReadAccess},
+		{"group grant", &db.Viewer{Principal: "someone", Groups: []string{"ops", "editors"}}, thing, db.WriteAccess},
+		{"best grant", &db.Viewer{Principal: "reader", Groups: []string{"editors"}}, thing, db.WriteAccess},
+		{"stranger", &db.Viewer{Principal: "stranger"}, thing, db.NoAccess},
+		{"without owner", &db.Viewer{Principal: "stranger"}, db.Thing{}, db.ReadAccess},
+		{"without owner and viewer", nil, db.Thing{}, db.WriteAccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.access, test.viewer.Access(test.thing))
+		})
+	}
+
+	assert.Equal(t, []string{"principal:owner", "principal:reader", "group:editors"}, thing.Readers())
+	assert.Equal(t, []string{"*"}, db.Thing{}.Readers())
+	assert.Equal(t, []string{"*", "principal:someone", "group:ops"}, (&db.Viewer{Principal: "someone", Groups: []string{"ops"}}).Subjects())
+}
+
+func TestACLValidate(t *testing.T) {
+	assert.NoError(t, db.ACL{{Principal: "reader", Level: db.ReadAccess}, {Group: "editors", Level: db.WriteAccess}}.Validate())
+	assert.NoError(t, db.ACL{}.Validate())
+	for name, grant := range map[string]db.Grant{
+		"no subject":    {Level: db.ReadAccess},
+		"both subjects": {Principal: "reader", Group: "editors", Level: db.ReadAccess},
+		"no level":      {Principal: "reader"},
+		"unknown level": {Principal: "reader", Level: "admin"},
+	} {
+		assert.Equal(t, db.ErrInvalidGrant, db.ACL{grant}.Validate(), name)
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+// Grant shares a thing with a principal or with the members of a group
+type Grant struct {
+	Principal string `json:"principal,omitempty" validate:"required_without=Group,excluded_with=Group"`
+	Group     string `json:"group,omitempty"`
+	// Level is read or write, write access includes read access
+	Level string `json:"level" validate:"required,oneof=read write"`
+}
+
+type ACLResponse struct {
+	// Owner is the principal which created the thing, everyone can read things without owner
+	Owner  string  `json:"owner"`
+	Grants []Grant `json:"grants"`
+}
+
+type SetACL struct {
+	// Grants replace the grants of the thing, an empty list makes the thing private to its owner
+	Grants []Grant `json:"grants" validate:"dive"`
+}
+
+type setACLRequest struct {
+	UUID string `path:"uuid"`
+	Body SetACL
+}
+
+// GetThingACL godoc
+// @Summary Get the ACL of a thing
+// @Description Get the owner of a thing and the principals and groups it is shared with
+// @ID get-thing-acl
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Success 200 {object} ACLResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/acl [get]
+func (s *Server) GetThingACL() *httpx.Handler[thingRequest, ACLResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req thingRequest) (ACLResponse, error) {
+		thing, err := s.db.GetThing(ctx, req.UUID)
+		if err != nil {
+			return ACLResponse{}, err
+		}
+		return thingToACLResponse(thing), nil
+	})
+}
+
+// SetThingACL godoc
+// @Summary Share a thing
+// @Description Replace the principals and groups a thing is shared with, only its owner can share a thing
+// @ID set-thing-acl
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param Body body SetACL true "The grants of the thing"
+// @Success 200 {object} ACLResponse
+// @Failure 400,401,403,404,413,415,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/acl [put]
+func (s *Server) SetThingACL() *httpx.Handler[setACLRequest, ACLResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req setACLRequest) (ACLResponse, error) {
+		acl := db.ACL{}
+		for _, grant := range req.Body.Grants {
+			acl = append(acl, db.Grant{
+				Principal: grant.Principal,
+				Group:     grant.Group,
+				Level:     db.AccessLevel(grant.Level),
+			})
+		}
+		thing, err := s.db.SetThingACL(ctx, req.UUID, acl)
+		if err != nil {
+			return ACLResponse{}, err
+		}
+		return thingToACLResponse(thing), nil
+	})
+}
+
+// aclRoutes share things in /v1, they were added after the unversioned routes were deprecated
+func (s *Server) aclRoutes(r chi.Router) {
+	r.With(s.requireScope(ScopeThingsRead)).Get("/thing/{uuid}/acl", s.GetThingACL().ServeHTTP)
+	r.With(s.requireScope(ScopeThingsWrite)).Put("/thing/{uuid}/acl", s.SetThingACL().ServeHTTP)
+}
+
+func thingToACLResponse(thing db.Thing) ACLResponse {
+	grants := []Grant{}
+	for _, grant := range thing.ACL {
+		grants = append(grants, Grant{
+			Principal: grant.Principal,
+			Group:     grant.Group,
+			Level:     string(grant.Level),
+		})
+	}
+	return ACLResponse{Owner: thing.Owner, Grants: grants}
+}
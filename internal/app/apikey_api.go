@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+const (
+	// ScopeThingsRead allows reading things, kinds and attachments
+	ScopeThingsRead = "things:read"
+	// ScopeThingsWrite allows creating, updating and deleting things, kinds and attachments
+	ScopeThingsWrite = "things:write"
+	// ScopeThingsAdmin allows access to all things regardless of their owner and ACL
+	ScopeThingsAdmin = "things:admin"
+	// ScopeAPIKeysManage allows issuing, rotating and revoking API keys
+	ScopeAPIKeysManage = "apikeys:manage"
+)
+
+// apiKeyAuthenticator authenticates API keys stored in the database
+type apiKeyAuthenticator struct {
+	db db.Service
+}
+
+func (a apiKeyAuthenticator) Authenticate(ctx context.Context, token string) (auth.Principal, error) {
+	id, secret, ok := auth.ParseAPIKey(token)
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	key, err := a.db.GetAPIKey(ctx, id)
+	if err == db.ErrAPIKeyNotFound {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if key.Revoked || !auth.VerifySecret(secret, key.Hash) {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	p := auth.Principal{ID: auth.APIKeyPrincipalID(key.ID), Scopes: key.Scopes}
+	if key.Tenant != "" {
+		p.Claims = map[string]interface{}{tenant.KeyClaim: key.Tenant}
+	}
+	return p, nil
+}
+
+// errInvalidTenant is returned when an API key is issued for an invalid tenant id
+var errInvalidTenant = httpx.Error(http.StatusBadRequest, tenant.ErrInvalidTenant)
+
+// IssueAPIKey creates an API key with scopes bound to keyTenant and returns the key, it cannot be
+// retrieved later. A key without tenant is rejected on the routes of things when tenancy is enabled.
+func IssueAPIKey(ctx context.Context, service db.Service, name string, scopes []string, keyTenant string) (db.APIKey, string, error) {
+	if keyTenant != "" && !tenant.Valid(keyTenant) {
+		return db.APIKey{}, "", errInvalidTenant
+	}
+	id := db.RandomID()
+	key, hash, err := auth.NewAPIKey(id)
+	if err != nil {
+		return db.APIKey{}, "", err
+	}
+	apiKey, err := service.CreateAPIKey(ctx, db.APIKey{ID: id, Name: name, Hash: hash, Scopes: scopes, Tenant: keyTenant})
+	if err != nil {
+		return db.APIKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+type APIKeyResponse struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Revoked bool      `json:"revoked"`
+	Tenant  string    `json:"tenant,omitempty"`
+	Updated time.Time `json:"updated"`
+	Created time.Time `json:"created"`
+}
+
+// IssuedAPIKeyResponse contains the key, it is only returned when the key is created or rotated
+type IssuedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type apiKeyRequest struct {
+	ID string `path:"id"`
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List all API keys including revoked keys, the keys themselves are not included
+// @ID list-api-keys
+// @Tags APIKey
+// @Produce json,application/yaml,application/msgpack
+// @Success 200 {array} APIKeyResponse
+// @Failure 401,403,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/apikey [get]
+func (s *Server) ListAPIKeys() *httpx.Handler[struct{}, []APIKeyResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, _ struct{}) ([]APIKeyResponse, error) {
+		keys, err := s.db.GetAPIKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response := []APIKeyResponse{}
+		for _, key := range keys {
+			response = append(response, apiKeyToAPIKeyResponse(key))
+		}
+		return response, nil
+	})
+}
+
+type CreateAPIKey struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=things:read things:write things:admin apikeys:manage"`
+	// Tenant binds the key to a tenant, keys without tenant cannot access things when tenancy is enabled
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type createAPIKeyRequest struct {
+	Body CreateAPIKey
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create an API key with scopes bound to a tenant, the key is only included in this response
+// @ID create-api-key
+// @Tags APIKey
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param Body body CreateAPIKey true "The body to create an API key"
+// @Success 201 {object} IssuedAPIKeyResponse
+// @Failure 400,401,403,413,415,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/apikey/new [post]
+func (s *Server) CreateAPIKey() *httpx.Handler[createAPIKeyRequest, IssuedAPIKeyResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req createAPIKeyRequest) (IssuedAPIKeyResponse, error) {
+		apiKey, key, err := IssueAPIKey(ctx, s.db, req.Body.Name, req.Body.Scopes, req.Body.Tenant)
+		if err != nil {
+			return IssuedAPIKeyResponse{}, err
+		}
+		return IssuedAPIKeyResponse{APIKeyResponse: apiKeyToAPIKeyResponse(apiKey), Key: key}, nil
+	}, httpx.WithStatus(http.StatusCreated))
+}
+
+// GetAPIKey godoc
+// @Summary Get an API key
+// @Description get API key by id, the key itself is not included
+// @ID get-api-key-by-id
+// @Tags APIKey
+// @Produce json,application/yaml,application/msgpack
+// @Param id path string true "ID"
+// @Success 200 {object} APIKeyResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/apikey/{id} [get]
+func (s *Server) GetAPIKey() *httpx.Handler[apiKeyRequest, APIKeyResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req apiKeyRequest) (APIKeyResponse, error) {
+		key, err := s.db.GetAPIKey(ctx, req.ID)
+		if err != nil {
+			return APIKeyResponse{}, err
+		}
+		return apiKeyToAPIKeyResponse(key), nil
+	})
+}
+
+// RotateAPIKey godoc
+// @Summary Rotate an API key
+// @Description Replace the secret of an API key, the previous key stops working immediately
+// @ID rotate-api-key
+// @Tags APIKey
+// @Produce json,application/yaml,application/msgpack
+// @Param id path string true "ID"
+// @Success 200 {object} IssuedAPIKeyResponse
+// @Failure 401,403,404,409,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/apikey/{id}/rotate [post]
+func (s *Server) RotateAPIKey() *httpx.Handler[apiKeyRequest, IssuedAPIKeyResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req apiKeyRequest) (IssuedAPIKeyResponse, error) {
+		key, hash, err := auth.NewAPIKey(req.ID)
+		if err != nil {
+			return IssuedAPIKeyResponse{}, err
+		}
+		apiKey, err := s.db.RotateAPIKey(ctx, req.ID, hash)
+		if err != nil {
+			return IssuedAPIKeyResponse{}, err
+		}
+		return IssuedAPIKeyResponse{APIKeyResponse: apiKeyToAPIKeyResponse(apiKey), Key: key}, nil
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key for good, revoking a revoked key succeeds
+// @ID revoke-api-key
+// @Tags APIKey
+// @Produce json,application/yaml,application/msgpack
+// @Param id path string true "ID"
+// @Success 200 {object} APIKeyResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/apikey/{id}/revoke [post]
+func (s *Server) RevokeAPIKey() *httpx.Handler[apiKeyRequest, APIKeyResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req apiKeyRequest) (APIKeyResponse, error) {
+		key, err := s.db.RevokeAPIKey(ctx, req.ID)
+		if err != nil {
+			return APIKeyResponse{}, err
+		}
+		return apiKeyToAPIKeyResponse(key), nil
+	})
+}
+
+func apiKeyToAPIKeyResponse(key db.APIKey) APIKeyResponse {
+	scopes := []string(key.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return APIKeyResponse{
+		ID:      key.ID,
+		Name:    key.Name,
+		Scopes:  scopes,
+		Revoked: key.Revoked,
+		Tenant:  key.Tenant,
+		Updated: key.Updated,
+		Created: key.Created,
+	}
+}
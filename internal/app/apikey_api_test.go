@@ -0,0 +1,237 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+)
+
+// issueAPIKey issues an API key with scopes in fake and returns the key
+func issueAPIKey(t *testing.T, fake *fakeDB, scopes ...string) string {
+	return issueTenantAPIKey(t, fake, "", scopes...)
+}
+
+// issueTenantAPIKey issues an API key with scopes bound to keyTenant in fake and returns the key
+func issueTenantAPIKey(t *testing.T, fake *fakeDB, keyTenant string, scopes ...string) string {
+	_, key, err := IssueAPIKey(context.Background(), fake, strings.Join(scopes, " "), scopes, keyTenant)
+	require.NoError(t, err)
+	return key
+}
+
+// principalID returns the ID of the principal authenticated with key
+func principalID(key string) string {
+	id, _, _ := auth.ParseAPIKey(key)
+	return auth.APIKeyPrincipalID(id)
+}
+
+func doAuthenticated(s *Server, method string, target string, key string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	var logs bytes.Buffer
+	s, err := NewServer(log.NewJSONLogger(&logs, "", false), fake, nil, WithAuthentication(), WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	reader := issueAPIKey(t, fake, ScopeThingsRead)
+	writer := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	admin := issueAPIKey(t, fake, ScopeAPIKeysManage)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		body   string
+		code   int
+	}{
+		{"no key", http.MethodGet, "/v1/thing/abc", "", "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/v1/thing/abc", "ak_unknown_secret", "", http.StatusUnauthorized},
+		{"wrong secret", http.MethodGet, "/v1/thing/abc", reader + "0", "", http.StatusUnauthorized},
+		{"read", http.MethodGet, "/v1/thing/abc", reader, "", http.StatusOK},
+		{"read v2", http.MethodGet, "/v2/thing/abc", reader, "", http.StatusOK},
+		{"read legacy", http.MethodGet, "/thing/abc", reader, "", http.StatusOK},
+		{"write without scope", http.MethodPost, "/v1/thing/new", reader, `{"name":"new","value":"value"}`, http.StatusForbidden},
+		{"write", http.MethodPost, "/v1/thing/new", writer, `{"name":"new","value":"value"}`, http.StatusOK},
+		{"delete without scope", http.MethodDelete, "/v2/thing/abc", reader, "", http.StatusForbidden},
+		{"kinds without scope", http.MethodGet, "/v1/kind", admin, "", http.StatusForbidden},
+		{"api keys without scope", http.MethodGet, "/v1/apikey", writer, "", http.StatusForbidden},
+		{"api keys", http.MethodGet, "/v1/apikey", admin, "", http.StatusOK},
+		{"graphql without key", http.MethodPost, "/graphql", "", `{"query":"{ thing(uuid: \"abc\") { name } }"}`, http.StatusUnauthorized},
+		{"graphql", http.MethodPost, "/graphql", reader, `{"query":"{ thing(uuid: \"abc\") { name } }"}`, http.StatusOK},
+		{"openapi", http.MethodGet, "/openapi.json", "", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doAuthenticated(s, test.method, test.target, test.key, test.body)
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+		})
+	}
+
+	// the key identity is added to log entries
+	logs.Reset()
+	doAuthenticated(s, http.MethodGet, "/thing/abc", reader, "")
+	var line struct {
+		Principal string `json:"principal"`
+	}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, auth.APIKeyPrincipalID(fake.apiKeys[0].ID), line.Principal)
+}
+
+func TestGraphQLMutationScope(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication())
+	require.NoError(t, err)
+
+	reader := issueAPIKey(t, fake, ScopeThingsRead)
+	w := doAuthenticated(s, http.MethodPost, "/graphql", reader, `{"query":"mutation { deleteThing(uuid: \"abc\") }"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response graphQLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "FORBIDDEN", response.Errors[0].Extensions["code"])
+	assert.Len(t, fake.things, 1)
+}
+
+func TestAPIKeyRotation(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithOpenAPIValidation(true))
+	require.NoError(t, err)
+	admin := issueAPIKey(t, fake, ScopeAPIKeysManage)
+
+	w := doAuthenticated(s, http.MethodPost, "/v1/apikey/new", admin, `{"name":"ci","scopes":["unknown"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/new", admin, `{"name":"ci","scopes":["things:read"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created IssuedAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, []string{ScopeThingsRead}, created.Scopes)
+	assert.NotContains(t, fake.apiKeys[1].Hash, created.Key)
+	assert.Equal(t, http.StatusOK, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", created.Key, "").Code)
+
+	// the key is never returned again
+	w = doAuthenticated(s, http.MethodGet, "/v1/apikey/"+created.ID, admin, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/"+created.ID+"/rotate", admin, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rotated IssuedAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.Key, rotated.Key)
+	assert.Equal(t, http.StatusUnauthorized, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", created.Key, "").Code)
+	assert.Equal(t, http.StatusOK, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", rotated.Key, "").Code)
+
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/"+created.ID+"/revoke", admin, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", rotated.Key, "").Code)
+
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/"+created.ID+"/rotate", admin, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/missing/revoke", admin, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	client := newGRPCClient(t, fake, WithAuthentication())
+	reader := issueAPIKey(t, fake, ScopeThingsRead)
+
+	_, err := client.GetThing(context.Background(), &thingpb.GetThingRequest{Uuid: "abc"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+reader)
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "abc"})
+	assert.NoError(t, err)
+
+	_, err = client.DeleteThing(ctx, &thingpb.DeleteThingRequest{Uuid: "abc"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.StreamThings(ctx, &thingpb.StreamThingsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "sso",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0600))
+
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	var logs bytes.Buffer
+	s, err := NewServer(log.NewJSONLogger(&logs, "", false), fake, nil, WithJWTAuthentication(auth.JWTConfig{
+		Issuer:   "https://sso.ldej.nl/",
+		Audience: "api.ldej.nl",
+		Keys:     auth.NewFileKeySet(path),
+	}))
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   "https://sso.ldej.nl/",
+		"aud":   "api.ldej.nl",
+		"sub":   "laurence",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "openid things:read",
+	})
+	token.Header["kid"] = "sso"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, doAuthenticated(s, http.MethodGet, "/thing/abc", signed, "").Code)
+	var line struct {
+		Principal string `json:"principal"`
+	}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, auth.JWTPrincipalID("https://sso.ldej.nl/", "laurence"), line.Principal)
+
+	assert.Equal(t, http.StatusForbidden, doAuthenticated(s, http.MethodDelete, "/v1/thing/abc", signed, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", signed+"x", "").Code)
+
+	// API keys are accepted next to tokens
+	reader := issueAPIKey(t, fake, ScopeThingsRead)
+	assert.Equal(t, http.StatusOK, doAuthenticated(s, http.MethodGet, "/v1/thing/abc", reader, "").Code)
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/blob"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+const (
+	// maxAttachmentSize is the maximum size of a single attachment
+	maxAttachmentSize = 32 << 20
+	// maxAttachmentsPerUpload is the maximum number of files in a single upload
+	maxAttachmentsPerUpload = 10
+	// maxUploadOverhead is the room for boundaries, part headers and other form fields in an upload
+	maxUploadOverhead = 1 << 20
+	// maxUploadSize is the maximum size of a whole multipart body
+	maxUploadSize = maxAttachmentsPerUpload*maxAttachmentSize + maxUploadOverhead
+	// attachmentFormField is the name of the multipart form field containing files
+	attachmentFormField = "file"
+)
+
+var (
+	errNotMultipart         = errors.New("expected a multipart/form-data body")
+	errNoAttachments        = fmt.Errorf("no files found in form field %q", attachmentFormField)
+	errTooManyAttachments   = fmt.Errorf("at most %d files can be uploaded at once", maxAttachmentsPerUpload)
+	errAttachmentTooLarge   = fmt.Errorf("attachments can be at most %d bytes", maxAttachmentSize)
+	errUploadTooLarge       = fmt.Errorf("uploads can be at most %d bytes", maxUploadSize)
+	errInvalidMultipartBody = errors.New("invalid multipart body")
+)
+
+type AttachmentResponse struct {
+	UUID        string `json:"uuid"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+
+	Created time.Time `json:"created"`
+}
+
+type AttachmentsResponse struct {
+	Attachments []AttachmentResponse `json:"attachments"`
+}
+
+// UploadAttachments godoc
+// @Summary Upload attachments
+// @Description Upload one or more files as multipart/form-data in the form field "file".
+// @Description The content type is sniffed from the content, files can be at most 32MB.
+// @Description Either all files are stored or, when one of them is rejected, none.
+// @ID upload-attachments
+// @Tags Attachment
+// @Accept multipart/form-data
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param file formData file true "The files to attach"
+// @Success 200 {object} AttachmentsResponse
+// @Failure 400,401,403,404,413,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/attachments [post]
+func (s *Server) UploadAttachments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	thingUUID := chi.URLParam(r, "uuid")
+
+	thing, err := s.db.GetThing(ctx, thingUUID)
+	if err == nil {
+		err = checkAccess(ctx, thing, db.WriteAccess)
+	}
+	if err == db.ErrThingNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err == errForbidden {
+		httpx.AbortJSON(w, r, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.ContentLength > maxUploadSize {
+		httpx.AbortJSON(w, r, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, errNotMultipart)
+		return
+	}
+
+	// the attachments stored so far are deleted when a later file is rejected
+	var stored []db.Attachment
+	abort := func(status int, err error) {
+		s.deleteAttachments(ctx, stored)
+		httpx.AbortJSON(w, r, status, err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if isBodyTooLarge(err) {
+			abort(http.StatusRequestEntityTooLarge, errUploadTooLarge)
+			return
+		}
+		if err != nil {
+			abort(http.StatusBadRequest, errInvalidMultipartBody)
+			return
+		}
+		if part.FormName() != attachmentFormField || part.FileName() == "" {
+			continue
+		}
+		if len(stored) == maxAttachmentsPerUpload {
+			abort(http.StatusBadRequest, errTooManyAttachments)
+			return
+		}
+
+		attachment, err := s.storeAttachment(r, thingUUID, part.FileName(), part)
+		if err == errAttachmentTooLarge {
+			abort(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if isBodyTooLarge(err) {
+			abort(http.StatusRequestEntityTooLarge, errUploadTooLarge)
+			return
+		}
+		if err == db.ErrThingNotFound {
+			abort(http.StatusNotFound, err)
+			return
+		}
+		if err == errForbidden {
+			abort(http.StatusForbidden, err)
+			return
+		}
+		if err != nil {
+			abort(http.StatusInternalServerError, err)
+			return
+		}
+		stored = append(stored, attachment)
+	}
+
+	if len(stored) == 0 {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, errNoAttachments)
+		return
+	}
+	response := AttachmentsResponse{Attachments: []AttachmentResponse{}}
+	for _, attachment := range stored {
+		response.Attachments = append(response.Attachments, attachmentToAttachmentResponse(attachment))
+	}
+	httpx.JSON(w, r, response)
+}
+
+// storeAttachment streams content into the blob store while sniffing its content type,
+// counting its size and calculating its checksum, then stores the metadata
+func (s *Server) storeAttachment(r *http.Request, thingUUID string, filename string, content io.Reader) (db.Attachment, error) {
+	ctx := r.Context()
+
+	// http.DetectContentType considers at most the first 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return db.Attachment{}, err
+	}
+	head = head[:n]
+
+	attachment := db.Attachment{
+		UUID:        uuid.New().String(),
+		ThingUUID:   thingUUID,
+		Filename:    filename,
+		ContentType: http.DetectContentType(head),
+		Created:     time.Now().UTC(),
+	}
+	key := attachmentBlobKey(thingUUID, attachment.UUID)
+
+	hash := sha256.New()
+	counter := &limitedCounter{r: io.MultiReader(bytes.NewReader(head), content), max: maxAttachmentSize}
+	err = s.blobs.Put(ctx, key, io.TeeReader(counter, hash))
+	if err != nil {
+		s.deleteBlob(ctx, key)
+		return db.Attachment{}, err
+	}
+	attachment.Size = counter.n
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	attachment, err = s.db.CreateAttachment(ctx, attachment)
+	if err != nil {
+		s.deleteBlob(ctx, key)
+		return db.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// ListAttachments godoc
+// @Summary List attachments
+// @Description List the attachments of a thing
+// @ID list-attachments
+// @Tags Attachment
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param uuid path string true "UUID"
+// @Success 200 {object} AttachmentsResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/attachments [get]
+func (s *Server) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	thingUUID := chi.URLParam(r, "uuid")
+
+	attachments, err := s.db.GetAttachments(ctx, thingUUID)
+	if err == db.ErrThingNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := AttachmentsResponse{Attachments: []AttachmentResponse{}}
+	for _, attachment := range attachments {
+		response.Attachments = append(response.Attachments, attachmentToAttachmentResponse(attachment))
+	}
+	httpx.JSON(w, r, response)
+}
+
+// GetAttachment godoc
+// @Summary Download an attachment
+// @Description Download the content of an attachment
+// @ID get-attachment
+// @Tags Attachment
+// @Produce octet-stream
+// @Param uuid path string true "UUID"
+// @Param attachment path string true "Attachment UUID"
+// @Success 200 {file} file
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/attachments/{attachment} [get]
+func (s *Server) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	thingUUID := chi.URLParam(r, "uuid")
+	attachmentUUID := chi.URLParam(r, "attachment")
+
+	attachment, err := s.db.GetAttachment(ctx, thingUUID, attachmentUUID)
+	if err == db.ErrAttachmentNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	content, err := s.blobs.Get(ctx, attachmentBlobKey(thingUUID, attachmentUUID))
+	if err == blob.ErrNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, db.ErrAttachmentNotFound)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", strconv.Quote(attachment.SHA256))
+
+	if _, err := io.Copy(w, content); err != nil {
+		s.log.Error(ctx, err, log.KV("attachment", attachmentUUID))
+	}
+}
+
+// DeleteAttachment godoc
+// @Summary Delete an attachment
+// @Description Delete an attachment and its content
+// @ID delete-attachment
+// @Tags Attachment
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param attachment path string true "Attachment UUID"
+// @Success 200 "Empty response"
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/attachments/{attachment} [delete]
+func (s *Server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	thingUUID := chi.URLParam(r, "uuid")
+	attachmentUUID := chi.URLParam(r, "attachment")
+
+	err := s.db.DeleteAttachment(ctx, thingUUID, attachmentUUID)
+	if err == db.ErrThingNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err == errForbidden {
+		httpx.AbortJSON(w, r, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	// the attachment is gone with its metadata, a failure to delete its content is only logged
+	s.deleteBlob(ctx, attachmentBlobKey(thingUUID, attachmentUUID))
+}
+
+// deleteAttachmentBlobs deletes the content of attachments, failures are logged as
+// the metadata of the attachments is already gone
+func (s *Server) deleteAttachmentBlobs(ctx context.Context, attachments []db.Attachment) {
+	for _, attachment := range attachments {
+		s.deleteBlob(ctx, attachmentBlobKey(attachment.ThingUUID, attachment.UUID))
+	}
+}
+
+// deleteAttachments deletes the metadata and the content of attachments, failures are logged
+func (s *Server) deleteAttachments(ctx context.Context, attachments []db.Attachment) {
+	for _, attachment := range attachments {
+		if err := s.db.DeleteAttachment(ctx, attachment.ThingUUID, attachment.UUID); err != nil {
+			s.log.Error(ctx, err, log.KV("attachment", attachment.UUID))
+			continue
+		}
+		s.deleteBlob(ctx, attachmentBlobKey(attachment.ThingUUID, attachment.UUID))
+	}
+}
+
+func (s *Server) deleteBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		s.log.Error(ctx, err, log.KV("blob", key))
+	}
+}
+
+func attachmentBlobKey(thingUUID string, attachmentUUID string) string {
+	return thingUUID + "/" + attachmentUUID
+}
+
+func attachmentToAttachmentResponse(attachment db.Attachment) AttachmentResponse {
+	return AttachmentResponse{
+		UUID:        attachment.UUID,
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		SHA256:      attachment.SHA256,
+		Created:     attachment.Created,
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading beyond the limit of the upload route
+func isBodyTooLarge(err error) bool {
+	return errors.Is(err, httpx.ErrBodyTooLarge)
+}
+
+// limitedCounter counts the bytes read from r and fails once more than max bytes are read
+type limitedCounter struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitedCounter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return n, errAttachmentTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/blob"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+// pngHeader is the signature http.DetectContentType recognizes as image/png
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+// uploadFile is a file in a multipart upload
+type uploadFile struct {
+	filename string
+	content  io.Reader
+}
+
+// upload posts content as a single file named filename
+func upload(s *Server, thingUUID string, filename string, content io.Reader) *httptest.ResponseRecorder {
+	return uploadFiles(s, thingUUID, uploadFile{filename: filename, content: content})
+}
+
+// uploadFiles posts files in a single multipart body
+func uploadFiles(s *Server, thingUUID string, files ...uploadFile) *httptest.ResponseRecorder {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		var err error
+		for _, file := range files {
+			var part io.Writer
+			part, err = form.CreateFormFile(attachmentFormField, file.filename)
+			if err == nil {
+				_, err = io.Copy(part, file.content)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/thing/"+thingUUID+"/attachments", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func newAttachmentServer(t *testing.T, fake *fakeDB) *Server {
+	blobs, err := blob.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, blobs)
+	require.NoError(t, err)
+	return s
+}
+
+func TestAttachments(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s := newAttachmentServer(t, fake)
+
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+	}{
+		{"png", append(pngHeader, make([]byte, 1024)...), "image/png"},
+		{"text", []byte("hello world"), "text/plain; charset=utf-8"},
+		{"empty", []byte{}, "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the filename does not influence the content type
+			w := upload(s, "abc", "file.exe", bytes.NewReader(test.content))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var response AttachmentsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Attachments, 1)
+
+			attachment := response.Attachments[0]
+			sum := sha256.Sum256(test.content)
+			assert.Equal(t, test.contentType, attachment.ContentType)
+			assert.Equal(t, hex.EncodeToString(sum[:]), attachment.SHA256)
+			assert.Equal(t, int64(len(test.content)), attachment.Size)
+			assert.Equal(t, "file.exe", attachment.Filename)
+
+			w = serve(s, http.MethodGet, "/v1/thing/abc/attachments/"+attachment.UUID, "")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, string(test.content), w.Body.String())
+			assert.Equal(t, test.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, strconv.Itoa(len(test.content)), w.Header().Get("Content-Length"))
+			assert.Equal(t, `attachment; filename=file.exe`, w.Header().Get("Content-Disposition"))
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, strconv.Quote(attachment.SHA256), w.Header().Get("ETag"))
+		})
+	}
+
+	w := serve(s, http.MethodGet, "/v1/thing/abc/attachments", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response AttachmentsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Attachments, len(tests))
+
+	// deleting removes the metadata and the content, deleting again is a no-op
+	attachment := response.Attachments[0]
+	w = serve(s, http.MethodDelete, "/v1/thing/abc/attachments/"+attachment.UUID, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(s, http.MethodGet, "/v1/thing/abc/attachments/"+attachment.UUID, "")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	_, err := s.blobs.Get(context.Background(), attachmentBlobKey("abc", attachment.UUID))
+	assert.Equal(t, blob.ErrNotFound, err)
+	w = serve(s, http.MethodDelete, "/v1/thing/abc/attachments/"+attachment.UUID, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = serve(s, http.MethodGet, "/v1/thing/abc/attachments/missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	// metadata without content is reported as missing
+	fake.attachments = append(fake.attachments, db.Attachment{UUID: "orphan", ThingUUID: "abc"})
+	w = serve(s, http.MethodGet, "/v1/thing/abc/attachments/orphan", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = upload(s, "missing", "file.txt", bytes.NewReader([]byte("hello")))
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = serve(s, http.MethodPost, "/v1/thing/abc/attachments", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+// undeletableBlobs fails to delete any blob
+type undeletableBlobs struct {
+	blob.Store
+}
+
+func (undeletableBlobs) Delete(ctx context.Context, key string) error {
+	return errors.New("storage unavailable")
+}
+
+func TestDeleteAttachmentUndeletableContent(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	blobs, err := blob.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	logs := &bytes.Buffer{}
+	s, err := NewServer(log.NewJSONLogger(logs, "", false), fake, undeletableBlobs{blobs})
+	require.NoError(t, err)
+
+	w := upload(s, "abc", "file.txt", bytes.NewReader([]byte("hello")))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response AttachmentsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// the attachment is deleted with its metadata, the content left behind is logged
+	w = serve(s, http.MethodDelete, "/v1/thing/abc/attachments/"+response.Attachments[0].UUID, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, fake.attachments)
+	assert.Contains(t, logs.String(), "storage unavailable")
+}
+
+func TestAttachmentTooLarge(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s := newAttachmentServer(t, fake)
+
+	w := upload(s, "abc", "large.bin", io.LimitReader(zeros{}, maxAttachmentSize))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = upload(s, "abc", "too-large.bin", io.LimitReader(zeros{}, maxAttachmentSize+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), errAttachmentTooLarge.Error())
+	assert.Len(t, fake.attachments, 1, "the metadata of a rejected attachment is not stored")
+
+	// the files stored before a rejected file are deleted
+	w = uploadFiles(s, "abc",
+		uploadFile{filename: "small.txt", content: bytes.NewReader([]byte("hello"))},
+		uploadFile{filename: "too-large.bin", content: io.LimitReader(zeros{}, maxAttachmentSize+1)},
+	)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.Len(t, fake.attachments, 1)
+	w = serve(s, http.MethodGet, "/v1/thing/abc/attachments", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response AttachmentsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Attachments, 1)
+	assert.Equal(t, "large.bin", response.Attachments[0].Filename)
+
+	// bodies announcing more than all files together are rejected before they are read
+	r := httptest.NewRequest(http.MethodPost, "/v1/thing/abc/attachments", bytes.NewReader(nil))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	r.ContentLength = maxUploadSize + 1
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), errUploadTooLarge.Error())
+}
+
+// zeros reads an endless stream of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
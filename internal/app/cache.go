@@ -0,0 +1,65 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+// route returns the method and route pattern of r, like "GET /v1/thing/{uuid}", before r is routed
+func (s *Server) route(r *http.Request) string {
+	rctx := chi.NewRouteContext()
+	s.router.Match(rctx, r.Method, r.URL.Path)
+	return r.Method + " " + rctx.RoutePattern()
+}
+
+// cacheControl sets the Cache-Control header of successful responses to the routes configured with
+// WithCacheControl, errors are not cached. The responses vary by the credentials and the tenant header
+// besides Accept, so shared caches do not serve the things of one principal or tenant to another.
+func (s *Server) cacheControl(next http.Handler) http.Handler {
+	if len(s.cacheDirectives) == 0 {
+		return next
+	}
+	var vary []string
+	if s.authenticator != nil {
+		vary = append(vary, "Authorization")
+	}
+	vary = append(vary, tenant.Headers(s.tenants...)...)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if directives, ok := s.cacheDirectives[s.route(r)]; ok {
+			if len(vary) > 0 {
+				w.Header().Add("Vary", strings.Join(vary, ", "))
+			}
+			w = &cacheControlWriter{ResponseWriter: w, directives: directives}
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// cacheControlWriter sets Cache-Control when the status code is 200 OK or 304 Not Modified
+type cacheControlWriter struct {
+	http.ResponseWriter
+	directives  string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code == http.StatusOK || code == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.directives)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	updated := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name", Updated: updated}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithCacheControl(map[string]string{
+		"GET /v1/thing/{uuid}": "private, max-age=60",
+	}))
+	require.NoError(t, err)
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/v1/thing/abc", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/".+"$`, etag)
+	assert.Equal(t, "Mon, 19 Oct 2026 12:00:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+
+	w = get("/v1/thing/abc", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+	w = get("/v2/thing/abc", http.Header{"If-Modified-Since": {"Mon, 19 Oct 2026 12:00:00 GMT"}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	// errors are not cached
+	w = get("/v1/thing/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	w = get("/v1/thing", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	list := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/".+"$`, list)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusNotModified, get("/v1/thing", http.Header{"If-None-Match": {list}}).Code)
+
+	// updating a thing changes the version of the thing and the pages it is on
+	fake.things[0].Updated = updated.Add(time.Millisecond)
+	w = get("/v1/thing/abc", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, get("/v1/thing", http.Header{"If-None-Match": {list}}).Code)
+
+	// as are deleted things
+	fake.things = append(fake.things, db.Thing{UUID: "def", Name: "other", Updated: updated})
+	w = get("/v1/thing", nil)
+	list = w.Header().Get("ETag")
+	fake.things = fake.things[:1]
+	assert.Equal(t, http.StatusOK, get("/v1/thing", http.Header{"If-None-Match": {list}}).Code)
+}
+
+func TestCacheControlVary(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithTenancy(tenant.Header("x-tenant")), WithCacheControl(map[string]string{
+		"GET /v1/thing/{uuid}": "public, s-maxage=60",
+	}))
+	require.NoError(t, err)
+	key := issueTenantAPIKey(t, fake, "acme", ScopeThingsRead)
+
+	// responses depend on the credentials and the tenant, shared caches must not serve them to others
+	w := doTenant(s, "/v1/thing/abc", key, "acme")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "public, s-maxage=60", w.Header().Get("Cache-Control"))
+	assert.ElementsMatch(t, []string{"Authorization, X-Tenant", "Accept"}, w.Header().Values("Vary"))
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The list responses implement httpx.CSVMarshaler so they can be downloaded as text/csv,
+// nested values such as labels and data are written as a single column.
+
+var thingsCSVHeader = []string{"uuid", "name", "value", "labels", "parent", "kind", "kindVersion", "data", "updated", "created"}
+
+func (t ThingResponse) csvRecord() []string {
+	kindVersion := ""
+	if t.KindVersion != 0 {
+		kindVersion = strconv.Itoa(t.KindVersion)
+	}
+	return []string{
+		t.UUID,
+		t.Name,
+		t.Value,
+		formatLabels(t.Labels),
+		t.Parent,
+		t.Kind,
+		kindVersion,
+		string(t.Data),
+		t.Updated.Format(time.RFC3339Nano),
+		t.Created.Format(time.RFC3339Nano),
+	}
+}
+
+func (t ThingsResponse) MarshalCSV() ([]string, [][]string) {
+	return thingResponses(t.Things).MarshalCSV()
+}
+
+// thingResponses is a list of things without pagination
+type thingResponses []ThingResponse
+
+func (t thingResponses) MarshalCSV() ([]string, [][]string) {
+	records := make([][]string, 0, len(t))
+	for _, thing := range t {
+		records = append(records, thing.csvRecord())
+	}
+	return thingsCSVHeader, records
+}
+
+func (k KindsResponse) MarshalCSV() ([]string, [][]string) {
+	records := make([][]string, 0, len(k.Kinds))
+	for _, kind := range k.Kinds {
+		records = append(records, []string{
+			kind.Name,
+			kind.Description,
+			strconv.Itoa(kind.Version),
+			string(kind.Schema),
+			kind.Updated.Format(time.RFC3339Nano),
+			kind.Created.Format(time.RFC3339Nano),
+		})
+	}
+	return []string{"name", "description", "version", "schema", "updated", "created"}, records
+}
+
+func (k KindSchemasResponse) MarshalCSV() ([]string, [][]string) {
+	records := make([][]string, 0, len(k.Schemas))
+	for _, schema := range k.Schemas {
+		records = append(records, []string{
+			k.Kind,
+			strconv.Itoa(schema.Version),
+			string(schema.Schema),
+			schema.Created.Format(time.RFC3339Nano),
+		})
+	}
+	return []string{"kind", "version", "schema", "created"}, records
+}
+
+func (a AttachmentsResponse) MarshalCSV() ([]string, [][]string) {
+	records := make([][]string, 0, len(a.Attachments))
+	for _, attachment := range a.Attachments {
+		records = append(records, []string{
+			attachment.UUID,
+			attachment.Filename,
+			attachment.ContentType,
+			strconv.FormatInt(attachment.Size, 10),
+			attachment.SHA256,
+			attachment.Created.Format(time.RFC3339Nano),
+		})
+	}
+	return []string{"uuid", "filename", "contentType", "size", "sha256", "created"}, records
+}
+
+// formatLabels formats labels as sorted key=value pairs separated by commas
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
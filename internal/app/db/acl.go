@@ -0,0 +1,148 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// AccessLevel is the access a principal has to a thing
+type AccessLevel string
+
+const (
+	NoAccess    AccessLevel = ""
+	ReadAccess  AccessLevel = "read"
+	WriteAccess AccessLevel = "write"
+)
+
+// Grant gives a principal, or the members of a group, access to a thing
+type Grant struct {
+	Principal string      `json:"principal,omitempty"`
+	Group     string      `json:"group,omitempty"`
+	Level     AccessLevel `json:"level"`
+}
+
+// ACL are the grants of a thing, stored as JSON
+type ACL []Grant
+
+// Validate returns ErrInvalidGrant when a grant has neither or both a principal and a group, or a level
+// other than read or write
+func (a ACL) Validate() error {
+	for _, grant := range a {
+		if (grant.Principal == "") == (grant.Group == "") {
+			return ErrInvalidGrant
+		}
+		if grant.Level != ReadAccess && grant.Level != WriteAccess {
+			return ErrInvalidGrant
+		}
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (a ACL) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]Grant(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (a *ACL) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*a = ACL{}
+		return nil
+	case []byte:
+		return json.Unmarshal(src, (*[]Grant)(a))
+	case string:
+		return json.Unmarshal([]byte(src), (*[]Grant)(a))
+	}
+	return fmt.Errorf("cannot scan %T into ACL", src)
+}
+
+// Everyone is the reader of things without owner, they have no other readers
+const Everyone = "*"
+
+// Readers are the subjects which can read a thing: its owner and the principals and groups it is
+// shared with, or everyone for a thing without owner, like the things stored before owners were
+// recorded. They are stored with the thing so things can be filtered on the Subjects of a Viewer.
+func (t Thing) Readers() []string {
+	if t.Owner == "" {
+		return []string{Everyone}
+	}
+	readers := []string{principalSubject(t.Owner)}
+	for _, grant := range t.ACL {
+		if grant.Principal != "" {
+			readers = append(readers, principalSubject(grant.Principal))
+		}
+		if grant.Group != "" {
+			readers = append(readers, groupSubject(grant.Group))
+		}
+	}
+	return readers
+}
+
+// Viewer is the principal things are retrieved for
+type Viewer struct {
+	Principal string
+	Groups    []string
+}
+
+// Subjects are the readers matching the viewer
+func (v *Viewer) Subjects() []string {
+	subjects := []string{Everyone, principalSubject(v.Principal)}
+	for _, group := range v.Groups {
+		subjects = append(subjects, groupSubject(group))
+	}
+	return subjects
+}
+
+// Access returns the access level of the viewer to thing, the owner has write access and a nil
+// viewer has write access to all things. Everyone can read a thing without owner, but only a nil
+// viewer can change it.
+func (v *Viewer) Access(thing Thing) AccessLevel {
+	if v == nil || (thing.Owner != "" && thing.Owner == v.Principal) {
+		return WriteAccess
+	}
+	if thing.Owner == "" {
+		return ReadAccess
+	}
+	level := NoAccess
+	for _, grant := range thing.ACL {
+		matches := (grant.Principal != "" && grant.Principal == v.Principal) || (grant.Group != "" && v.inGroup(grant.Group))
+		if matches {
+			if grant.Level == WriteAccess {
+				return WriteAccess
+			}
+			level = ReadAccess
+		}
+	}
+	return level
+}
+
+// CanRead reports whether the viewer can read thing
+func (v *Viewer) CanRead(thing Thing) bool {
+	return v.Access(thing) != NoAccess
+}
+
+func (v *Viewer) inGroup(group string) bool {
+	for _, g := range v.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func principalSubject(id string) string {
+	return "principal:" + id
+}
+
+func groupSubject(group string) string {
+	return "group:" + group
+}
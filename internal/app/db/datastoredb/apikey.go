@@ -0,0 +1,107 @@
+package datastoredb
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const apiKeyKind = "api_key"
+
+func apiKeyKey(id string) *datastore.Key {
+	return datastore.NameKey(apiKeyKind, id, nil)
+}
+
+func (s *service) CreateAPIKey(ctx context.Context, key db.APIKey) (db.APIKey, error) {
+	now := time.Now().UTC()
+	key.Revoked = false
+	key.Updated = now
+	key.Created = now
+
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing db.APIKey
+		err := tx.Get(apiKeyKey(key.ID), &existing)
+		if err == nil {
+			return db.ErrAPIKeyAlreadyExists
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		_, err = tx.Put(apiKeyKey(key.ID), &key)
+		return err
+	})
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *service) GetAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	var key db.APIKey
+	err := s.datastoreClient.Get(ctx, apiKeyKey(id), &key)
+	if err == datastore.ErrNoSuchEntity {
+		return db.APIKey{}, db.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *service) GetAPIKeys(ctx context.Context) ([]db.APIKey, error) {
+	var keys []db.APIKey
+	query := datastore.NewQuery(apiKeyKind).Order("Created").Order("__key__")
+	_, err := s.datastoreClient.GetAll(ctx, query, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *service) RotateAPIKey(ctx context.Context, id string, hash string) (db.APIKey, error) {
+	return s.updateAPIKey(ctx, id, func(key *db.APIKey) error {
+		if key.Revoked {
+			return db.ErrAPIKeyRevoked
+		}
+		key.Hash = hash
+		key.Updated = time.Now().UTC()
+		return nil
+	})
+}
+
+func (s *service) RevokeAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	return s.updateAPIKey(ctx, id, func(key *db.APIKey) error {
+		if !key.Revoked {
+			key.Revoked = true
+			key.Updated = time.Now().UTC()
+		}
+		return nil
+	})
+}
+
+// updateAPIKey applies update to an API key in a transaction
+func (s *service) updateAPIKey(ctx context.Context, id string, update func(key *db.APIKey) error) (db.APIKey, error) {
+	var key db.APIKey
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		key = db.APIKey{}
+		err := tx.Get(apiKeyKey(id), &key)
+		if err == datastore.ErrNoSuchEntity {
+			return db.ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := update(&key); err != nil {
+			return err
+		}
+		_, err = tx.Put(apiKeyKey(id), &key)
+		return err
+	})
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,86 @@
+package datastoredb
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const attachmentKind = "attachment"
+
+// attachmentKey stores attachments as children of their thing
+func attachmentKey(thingKey *datastore.Key, uuid string) *datastore.Key {
+	key := datastore.NameKey(attachmentKind, uuid, thingKey)
+	key.Namespace = thingKey.Namespace
+	return key
+}
+
+func (s *service) CreateAttachment(ctx context.Context, attachment db.Attachment) (db.Attachment, error) {
+	thingKey, err := s.thingKey(ctx, attachment.ThingUUID)
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	_, err = s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var thing entity
+		err := tx.Get(thingKey, &thing)
+		if err == datastore.ErrNoSuchEntity {
+			return db.ErrThingNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Put(attachmentKey(thingKey, attachment.UUID), &attachment)
+		return err
+	})
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (s *service) GetAttachment(ctx context.Context, thingUUID string, uuid string) (db.Attachment, error) {
+	thingKey, err := s.thingKey(ctx, thingUUID)
+	if err == db.ErrThingNotFound {
+		return db.Attachment{}, db.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	var attachment db.Attachment
+	err = s.datastoreClient.Get(ctx, attachmentKey(thingKey, uuid), &attachment)
+	if err == datastore.ErrNoSuchEntity {
+		return db.Attachment{}, db.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (s *service) GetAttachments(ctx context.Context, thingUUID string) ([]db.Attachment, error) {
+	thingKey, err := s.thingKey(ctx, thingUUID)
+	if err != nil {
+		return nil, err
+	}
+	// an ancestor query includes the attachments of descendants
+	var attachments []db.Attachment
+	query := tenantQuery(ctx, attachmentKind).Ancestor(thingKey).Filter("ThingUUID =", thingUUID).Order("__key__")
+	_, err = s.datastoreClient.GetAll(ctx, query, &attachments)
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (s *service) DeleteAttachment(ctx context.Context, thingUUID string, uuid string) error {
+	thingKey, err := s.thingKey(ctx, thingUUID)
+	if err == db.ErrThingNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.datastoreClient.Delete(ctx, attachmentKey(thingKey, uuid))
+}
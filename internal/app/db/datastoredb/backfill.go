@@ -0,0 +1,108 @@
+package datastoredb
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+// backfillBatchSize is the number of things rewritten per transaction by BackfillReaders
+const backfillBatchSize = 100
+
+// BackfillReaders stores the Readers property of the things in all namespaces which were stored before
+// it existed, things without it are left out of the listings of viewers. Every thing is rewritten in a
+// transaction, so concurrent updates are not lost. It returns the number of rewritten things.
+func BackfillReaders(ctx context.Context, dbService db.Service) (int, error) {
+	s, ok := dbService.(*service)
+	if !ok {
+		return 0, errors.New("readers can only be backfilled on Datastore")
+	}
+	namespaces, err := s.namespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+	backfilled := 0
+	for _, ns := range namespaces {
+		keys, err := s.keysWithoutReaders(ctx, ns)
+		if err != nil {
+			return backfilled, err
+		}
+		for start := 0; start < len(keys); start += backfillBatchSize {
+			end := start + backfillBatchSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+			n, err := s.rewriteThings(ctx, keys[start:end])
+			if err != nil {
+				return backfilled, err
+			}
+			backfilled += n
+		}
+	}
+	return backfilled, nil
+}
+
+// keysWithoutReaders returns the keys of the things in namespace without the Readers property
+func (s *service) keysWithoutReaders(ctx context.Context, namespace string) ([]*datastore.Key, error) {
+	var keys []*datastore.Key
+	it := s.datastoreClient.Run(ctx, datastore.NewQuery(thingKind).Namespace(namespace))
+	for {
+		var properties datastore.PropertyList
+		key, err := it.Next(&properties)
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !hasProperty(properties, readersProperty) {
+			keys = append(keys, key)
+		}
+	}
+}
+
+// rewriteThings loads and saves the things with keys in a transaction, which stores all properties
+// derived from a thing, things deleted in the meantime are skipped
+func (s *service) rewriteThings(ctx context.Context, keys []*datastore.Key) (int, error) {
+	var rewritten int
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		entities := make([]entity, len(keys))
+		err := tx.GetMulti(keys, entities)
+		existing, existingEntities := keys, entities
+		if errs, ok := err.(datastore.MultiError); ok {
+			existing, existingEntities = nil, nil
+			for i, err := range errs {
+				switch err {
+				case nil:
+					existing = append(existing, keys[i])
+					existingEntities = append(existingEntities, entities[i])
+				case datastore.ErrNoSuchEntity:
+				default:
+					return err
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+		rewritten = len(existing)
+		_, err = tx.PutMulti(existing, existingEntities)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rewritten, nil
+}
+
+func hasProperty(properties datastore.PropertyList, name string) bool {
+	for _, p := range properties {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,12 +2,13 @@ package datastoredb
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"cloud.google.com/go/datastore"
-	"github.com/google/uuid"
 
 	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
 )
 
 var _ db.Service = (*service)(nil)
@@ -16,85 +17,335 @@ const thingKind = "thing"
 
 type service struct {
 	datastoreClient *datastore.Client
+	options         db.Options
 }
 
-func NewService(ctx context.Context, projectID string) (db.Service, error) {
+func NewService(ctx context.Context, projectID string, opts ...db.Option) (db.Service, error) {
 	datastoreClient, err := datastore.NewClient(ctx, projectID)
 	if err != nil {
 		return nil, err
 	}
-	return &service{datastoreClient: datastoreClient}, nil
+	return &service{datastoreClient: datastoreClient, options: db.NewOptions(opts...)}, nil
 }
 
 func (s *service) GetThing(ctx context.Context, uuid string) (db.Thing, error) {
-	var thing db.Thing
-	key := datastore.NameKey(thingKind, uuid, nil)
-	err := s.datastoreClient.Get(ctx, key, &thing)
+	key, err := s.thingKey(ctx, uuid)
+	if err != nil {
+		return db.Thing{}, err
+	}
+	var thing entity
+	err = s.datastoreClient.Get(ctx, key, &thing)
 	if err == datastore.ErrNoSuchEntity {
 		return db.Thing{}, db.ErrThingNotFound
 	}
 	if err != nil {
 		return db.Thing{}, err
 	}
-	return thing, nil
+	return thing.Thing, nil
 }
 
-func (s *service) CreateThing(ctx context.Context, name string, value string) (db.Thing, error) {
-	now := time.Now().UTC()
-	thing := db.Thing{
-		UUID:    uuid.New().String(),
-		Name:    name,
-		Value:   value,
-		Updated: now,
-		Created: now,
+// GetThingsByUUID looks up the keys of the things in their paths, as their ancestors are not known,
+// and gets all things at once
+func (s *service) GetThingsByUUID(ctx context.Context, uuids []string) ([]db.Thing, error) {
+	keys, err := s.thingKeys(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]entity, len(keys))
+	err = s.datastoreClient.GetMulti(ctx, keys, entities)
+	if err != nil {
+		return nil, err
 	}
+	return toThings(entities), nil
+}
 
-	key := datastore.NameKey(thingKind, thing.UUID, nil)
-	_, err := s.datastoreClient.Put(ctx, key, &thing)
+func (s *service) CreateThing(ctx context.Context, input db.ThingInput) (db.Thing, error) {
+	thing, _, err := s.create(ctx, s.options.NewID(), input)
+	return thing, err
+}
+
+func (s *service) UpdateThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, error) {
+	key, err := s.thingKey(ctx, uuid)
 	if err != nil {
 		return db.Thing{}, err
 	}
-	return thing, nil
+	return s.update(ctx, key, input)
+}
+
+func (s *service) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	key, err := s.thingKey(ctx, uuid)
+	if err == db.ErrThingNotFound {
+		if input.Name == "" {
+			return db.Thing{}, false, db.ErrThingNotFound
+		}
+		return s.create(ctx, uuid, input)
+	}
+	if err != nil {
+		return db.Thing{}, false, err
+	}
+	thing, err := s.update(ctx, key, input)
+	return thing, false, err
 }
 
-func (s *service) UpdateThing(ctx context.Context, uuid string, value string) (db.Thing, error) {
-	now := time.Now().UTC()
+// errExists is returned by a create transaction when the path of the thing points to another key,
+// because the thing has been created below another parent in the meantime
+var errExists = errors.New("created concurrently")
 
-	var thing db.Thing
-	key := datastore.NameKey(thingKind, uuid, nil)
-	err := s.datastoreClient.Get(ctx, key, &thing)
-	if err == datastore.ErrNoSuchEntity {
-		return db.Thing{}, db.ErrThingNotFound
+// create stores a new thing below its parent, when a thing with the same UUID has been created
+// in the meantime that thing is updated instead. The returned bool reports whether the thing was created.
+func (s *service) create(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	var parentKey *datastore.Key
+	parentUUID := ""
+	if input.ParentUUID != nil && *input.ParentUUID != "" {
+		parentUUID = *input.ParentUUID
+		var err error
+		parentKey, err = s.thingKey(ctx, parentUUID)
+		if err == db.ErrThingNotFound {
+			return db.Thing{}, false, db.ErrParentNotFound
+		}
+		if err != nil {
+			return db.Thing{}, false, err
+		}
+	}
+
+	var thing entity
+	var created bool
+	var existingKey *datastore.Key
+	key := newThingKey(ctx, uuid, parentKey)
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		now := time.Now().UTC()
+
+		var path thingPath
+		err := tx.Get(thingPathKey(ctx, uuid), &path)
+		if err == nil && !path.Key.Equal(key) {
+			existingKey = path.Key
+			return errExists
+		}
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		thing = entity{}
+		err = tx.Get(key, &thing)
+		created = err == datastore.ErrNoSuchEntity
+		if created {
+			thing = entity{db.Thing{
+				UUID:       uuid,
+				Labels:     db.Labels{},
+				ParentUUID: parentUUID,
+				Kind:       input.Kind,
+				Owner:      input.Owner,
+				ACL:        db.ACL{},
+				Created:    now,
+			}}
+		} else if err != nil {
+			return err
+		}
+
+		update(&thing.Thing, input, now)
+
+		if _, err := tx.Put(key, &thing); err != nil {
+			return err
+		}
+		_, err = tx.Put(thingPathKey(ctx, uuid), &thingPath{Key: key})
+		return err
+	})
+	if err == errExists {
+		updated, err := s.update(ctx, existingKey, input)
+		return updated, false, err
 	}
+	if err != nil {
+		return db.Thing{}, false, err
+	}
+	return thing.Thing, created, nil
+}
+
+func (s *service) update(ctx context.Context, key *datastore.Key, input db.ThingInput) (db.Thing, error) {
+	if input.ParentUUID != nil && *input.ParentUUID != parentUUID(key) {
+		return s.move(ctx, key, *input.ParentUUID, input)
+	}
+
+	var thing entity
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		thing = entity{}
+		err := tx.Get(key, &thing)
+		if err == datastore.ErrNoSuchEntity {
+			return db.ErrThingNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		update(&thing.Thing, input, time.Now().UTC())
+
+		_, err = tx.Put(key, &thing)
+		return err
+	})
 	if err != nil {
 		return db.Thing{}, err
 	}
+	return thing.Thing, nil
+}
 
-	thing.Value = value
+// update applies input to thing, keeping the name, labels and kind version when they are not set
+func update(thing *db.Thing, input db.ThingInput, now time.Time) {
+	if input.Name != "" {
+		thing.Name = input.Name
+	}
+	thing.Value = input.Value
+	thing.Data = input.Data
+	if input.KindVersion != 0 {
+		thing.KindVersion = input.KindVersion
+	}
+	if input.Labels != nil {
+		thing.Labels = input.Labels
+	}
 	thing.Updated = now
+}
 
-	_, err = s.datastoreClient.Put(ctx, key, &thing)
+func (s *service) DeleteThing(ctx context.Context, uuid string, policy db.DeletePolicy) ([]db.Attachment, error) {
+	key, err := s.thingKey(ctx, uuid)
 	if err != nil {
-		return db.Thing{}, err
+		return nil, err
+	}
+
+	var attachments []db.Attachment
+	_, err = s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		// the descendants of a thing are all entities with its key as ancestor, including itself
+		query := tenantQuery(ctx, "").Ancestor(key).KeysOnly().Transaction(tx)
+		keys, err := s.datastoreClient.GetAll(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		if policy == db.Restrict {
+			for _, k := range keys {
+				if k.Kind == thingKind && !k.Equal(key) {
+					return db.ErrThingHasChildren
+				}
+			}
+		}
+
+		attachments = nil
+		query = tenantQuery(ctx, attachmentKind).Ancestor(key).Transaction(tx)
+		_, err = s.datastoreClient.GetAll(ctx, query, &attachments)
+		if err != nil {
+			return err
+		}
+		return tx.DeleteMulti(append(keys, thingPathKeys(ctx, keys)...))
+	})
+	if err != nil {
+		return nil, err
 	}
-	return thing, nil
+	return attachments, nil
 }
 
-func (s *service) DeleteThing(ctx context.Context, uuid string) error {
-	key := datastore.NameKey(thingKind, uuid, nil)
-	return s.datastoreClient.Delete(ctx, key)
+func (s *service) CountThings(ctx context.Context, owner string) (int, error) {
+	return s.datastoreClient.Count(ctx, tenantQuery(ctx, thingKind).Filter("Owner =", owner).KeysOnly())
 }
 
-func (s *service) GetThings(ctx context.Context, offset int, limit int) ([]db.Thing, int, error) {
-	var things []db.Thing
-	query := datastore.NewQuery(thingKind).Offset(offset).Limit(limit)
-	_, err := s.datastoreClient.GetAll(ctx, query, &things)
+// GetThings filters on label equality and existence in the query, when the selector contains
+// other requirements all things matching the query are retrieved and filtered and paginated in memory.
+// Things are ordered by their UUID property, their keys start at the key of their root and would order
+// them by hierarchy. The composite indexes for the filters are in index.yaml.
+func (s *service) GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, viewer *db.Viewer) ([]db.Thing, int, error) {
+	query := tenantQuery(ctx, thingKind).Order("UUID")
+
+	filteredInMemory := false
+	for _, r := range selector {
+		switch r.Operator {
+		case labels.Equals:
+			query = query.Filter(labelsProperty+" =", labelPair(r.Key, r.Values[0]))
+		case labels.Exists:
+			query = query.Filter(labelKeysProperty+" =", r.Key)
+		default:
+			filteredInMemory = true
+		}
+	}
+
+	var filter func(db.Thing) bool
+	if filteredInMemory {
+		filter = func(thing db.Thing) bool { return selector.Matches(thing.Labels) }
+	}
+	if viewer != nil {
+		return s.viewerThings(ctx, query, offset, limit, viewer, filter)
+	}
+	if filter != nil {
+		return s.filterInMemory(ctx, query, offset, limit, filter)
+	}
+
+	var entities []entity
+	_, err := s.datastoreClient.GetAll(ctx, query.Offset(offset).Limit(limit), &entities)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := s.datastoreClient.Count(ctx, query)
 	if err != nil {
 		return nil, 0, err
 	}
-	count, err := s.datastoreClient.Count(ctx, datastore.NewQuery(thingKind))
+	return toThings(entities), count, nil
+}
+
+// filterInMemory retrieves all things matching query and paginates the things matching filter
+func (s *service) filterInMemory(ctx context.Context, query *datastore.Query, offset int, limit int, filter func(db.Thing) bool) ([]db.Thing, int, error) {
+	var entities []entity
+	_, err := s.datastoreClient.GetAll(ctx, query, &entities)
 	if err != nil {
 		return nil, 0, err
 	}
-	return things, count, nil
+	var things []db.Thing
+	for _, e := range entities {
+		if filter(e.Thing) {
+			things = append(things, e.Thing)
+		}
+	}
+	count := len(things)
+	if offset > count {
+		offset = count
+	}
+	end := offset + limit
+	if end > count {
+		end = count
+	}
+	return things[offset:end], count, nil
+}
+
+func (s *service) SetThingACL(ctx context.Context, uuid string, acl db.ACL) (db.Thing, error) {
+	if err := acl.Validate(); err != nil {
+		return db.Thing{}, err
+	}
+	key, err := s.thingKey(ctx, uuid)
+	if err != nil {
+		return db.Thing{}, err
+	}
+
+	var thing entity
+	_, err = s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		thing = entity{}
+		err := tx.Get(key, &thing)
+		if err == datastore.ErrNoSuchEntity {
+			return db.ErrThingNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		thing.ACL = acl
+		thing.Updated = time.Now().UTC()
+
+		_, err = tx.Put(key, &thing)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing.Thing, nil
+}
+
+func toThings(entities []entity) []db.Thing {
+	things := make([]db.Thing, len(entities))
+	for i, e := range entities {
+		things[i] = e.Thing
+	}
+	return things
 }
@@ -1,3 +1,4 @@
+//go:build integration
 // +build integration
 
 package datastoredb
@@ -7,12 +8,17 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/datastore"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
 )
 
 type Suite struct {
@@ -43,7 +49,7 @@ func TestIntegrationSuite(t *testing.T) {
 }
 
 func (s *Suite) TestThing() {
-	thing, err := s.db.CreateThing(s.ctx, "name", "value")
+	thing, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "name", Value: "value"})
 	s.NoError(err)
 
 	retrievedThing, err := s.db.GetThing(s.ctx, thing.UUID)
@@ -51,7 +57,11 @@ func (s *Suite) TestThing() {
 	s.Equal("value", retrievedThing.Value)
 	s.Equal("name", retrievedThing.Name)
 
-	_, err = s.db.UpdateThing(s.ctx, thing.UUID, "updated")
+	retrievedByUUID, err := s.db.GetThingsByUUID(s.ctx, []string{thing.UUID, db.RandomID()})
+	s.NoError(err)
+	s.Len(retrievedByUUID, 1)
+
+	_, err = s.db.UpdateThing(s.ctx, thing.UUID, db.ThingInput{Value: "updated"})
 	s.NoError(err)
 
 	retrievedThing, err = s.db.GetThing(s.ctx, thing.UUID)
@@ -59,22 +69,641 @@ func (s *Suite) TestThing() {
 	s.Equal("updated", retrievedThing.Value)
 	s.Equal("name", retrievedThing.Name)
 
-	retrievedThings, count, err := s.db.GetThings(s.ctx, 0, 10)
+	retrievedThings, count, err := s.db.GetThings(s.ctx, 0, 10, nil, nil)
 	s.NoError(err)
 	s.Equal(count, len(retrievedThings))
 	s.Equal(1, count)
 
-	err = s.db.DeleteThing(s.ctx, thing.UUID)
+	_, err = s.db.DeleteThing(s.ctx, thing.UUID, db.Restrict)
 	s.NoError(err)
 
 	_, err = s.db.GetThing(s.ctx, thing.UUID)
 	s.Equal(db.ErrThingNotFound, err)
+
+	_, err = s.db.DeleteThing(s.ctx, thing.UUID, db.Restrict)
+	s.Equal(db.ErrThingNotFound, err)
 }
 
 func (s *Suite) TestThingNotFound() {
 	_, err := s.db.GetThing(s.ctx, "does-not-exist")
 	s.Equal(db.ErrThingNotFound, err)
 
-	_, err = s.db.UpdateThing(s.ctx, "does-not-exist", "updated")
+	_, err = s.db.UpdateThing(s.ctx, "does-not-exist", db.ThingInput{Value: "updated"})
+	s.Equal(db.ErrThingNotFound, err)
+}
+
+// things are listed in the order of their uuid on every page, regardless of their depth in the hierarchy
+func (s *Suite) TestThingOrder() {
+	var expected []string
+	var parentUUID *string
+	for _, name := range []string{"project", "environment", "config"} {
+		thing, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: name, Value: "value", ParentUUID: parentUUID})
+		s.Require().NoError(err)
+		expected = append(expected, thing.UUID)
+		parentUUID = &thing.UUID
+	}
+	for _, name := range []string{"other", "another"} {
+		thing, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: name, Value: "value"})
+		s.Require().NoError(err)
+		expected = append(expected, thing.UUID)
+	}
+	sort.Strings(expected)
+
+	for _, viewer := range []*db.Viewer{nil, {Principal: "alice"}} {
+		var listed []string
+		for offset := 0; offset < len(expected); offset += 2 {
+			things, count, err := s.db.GetThings(s.ctx, offset, 2, nil, viewer)
+			s.Require().NoError(err)
+			s.Equal(len(expected), count)
+			for _, thing := range things {
+				listed = append(listed, thing.UUID)
+			}
+		}
+		s.Equal(expected, listed)
+	}
+
+	for _, uuid := range expected {
+		_, err := s.db.DeleteThing(s.ctx, uuid, db.Cascade)
+		s.True(err == nil || err == db.ErrThingNotFound)
+	}
+}
+
+func (s *Suite) TestUpsertThing() {
+	id := db.TimeSortableID()
+
+	_, _, err := s.db.UpsertThing(s.ctx, id, db.ThingInput{Value: "value"})
 	s.Equal(db.ErrThingNotFound, err)
+
+	thing, created, err := s.db.UpsertThing(s.ctx, id, db.ThingInput{Name: "name", Value: "value"})
+	s.NoError(err)
+	s.True(created)
+	s.Equal(id, thing.UUID)
+	s.Equal("name", thing.Name)
+
+	thing, created, err = s.db.UpsertThing(s.ctx, id, db.ThingInput{Value: "updated"})
+	s.NoError(err)
+	s.False(created)
+	s.Equal("name", thing.Name)
+	s.Equal("updated", thing.Value)
+
+	retrievedThing, err := s.db.GetThing(s.ctx, id)
+	s.NoError(err)
+	s.Equal("updated", retrievedThing.Value)
+
+	_, err = s.db.DeleteThing(s.ctx, id, db.Restrict)
+	s.NoError(err)
+}
+
+func (s *Suite) TestLabels() {
+	prod, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "prod", Value: "value", Labels: db.Labels{"env": "prod", "team": "a"}})
+	s.NoError(err)
+	s.Equal(db.Labels{"env": "prod", "team": "a"}, prod.Labels)
+
+	test, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "test", Value: "value", Labels: db.Labels{"env": "test", "deprecated": ""}})
+	s.NoError(err)
+
+	retrievedThing, err := s.db.GetThing(s.ctx, prod.UUID)
+	s.NoError(err)
+	s.Equal(prod.Labels, retrievedThing.Labels)
+
+	for selector, expected := range map[string][]string{
+		"env=prod":                  {prod.UUID},
+		"env!=prod":                 {test.UUID},
+		"team":                      {prod.UUID},
+		"!deprecated":               {prod.UUID},
+		"env in (prod,test)":        {prod.UUID, test.UUID},
+		"team notin (a)":            {test.UUID},
+		"env=prod,team in (b)":      {},
+		"env=test,deprecated,!team": {test.UUID},
+	} {
+		sel, err := labels.Parse(selector)
+		s.NoError(err)
+
+		things, count, err := s.db.GetThings(s.ctx, 0, 10, sel, nil)
+		s.NoError(err)
+		s.Equal(len(expected), count, selector)
+
+		var uuids []string
+		for _, thing := range things {
+			uuids = append(uuids, thing.UUID)
+		}
+		s.ElementsMatch(expected, uuids, selector)
+	}
+
+	updatedThing, err := s.db.UpdateThing(s.ctx, test.UUID, db.ThingInput{Value: "updated"})
+	s.NoError(err)
+	s.Equal(test.Labels, updatedThing.Labels)
+
+	updatedThing, err = s.db.UpdateThing(s.ctx, test.UUID, db.ThingInput{Value: "updated", Labels: db.Labels{"env": "prod"}})
+	s.NoError(err)
+	s.Equal(db.Labels{"env": "prod"}, updatedThing.Labels)
+
+	_, err = s.db.DeleteThing(s.ctx, prod.UUID, db.Restrict)
+	s.NoError(err)
+	_, err = s.db.DeleteThing(s.ctx, test.UUID, db.Restrict)
+	s.NoError(err)
+}
+
+func (s *Suite) TestKinds() {
+	schema := db.JSON(`{"type": "object"}`)
+
+	kind, err := s.db.CreateKind(s.ctx, "config", "A config", schema)
+	s.NoError(err)
+	s.Equal(1, kind.Version)
+
+	_, err = s.db.CreateKind(s.ctx, "config", "A config", schema)
+	s.Equal(db.ErrKindAlreadyExists, err)
+
+	kind, err = s.db.AddKindSchema(s.ctx, "config", db.JSON(`{"type": "object", "required": ["port"]}`))
+	s.NoError(err)
+	s.Equal(2, kind.Version)
+
+	retrievedKind, err := s.db.GetKind(s.ctx, "config")
+	s.NoError(err)
+	s.Equal(2, retrievedKind.Version)
+	s.Equal("A config", retrievedKind.Description)
+	s.JSONEq(`{"type": "object", "required": ["port"]}`, string(retrievedKind.Schema))
+
+	kinds, err := s.db.GetKinds(s.ctx)
+	s.NoError(err)
+	s.Len(kinds, 1)
+
+	schemas, err := s.db.GetKindSchemas(s.ctx, "config")
+	s.NoError(err)
+	s.Len(schemas, 2)
+	s.Equal(1, schemas[0].Version)
+	s.JSONEq(string(schema), string(schemas[0].Schema))
+
+	thing, err := s.db.CreateThing(s.ctx, db.ThingInput{Kind: "config", KindVersion: 2, Name: "name", Data: db.JSON(`{"port": 80}`)})
+	s.NoError(err)
+
+	retrievedThing, err := s.db.GetThing(s.ctx, thing.UUID)
+	s.NoError(err)
+	s.Equal("config", retrievedThing.Kind)
+	s.Equal(2, retrievedThing.KindVersion)
+	s.JSONEq(`{"port": 80}`, string(retrievedThing.Data))
+
+	err = s.db.DeleteKind(s.ctx, "config")
+	s.Equal(db.ErrKindInUse, err)
+
+	_, err = s.db.DeleteThing(s.ctx, thing.UUID, db.Restrict)
+	s.NoError(err)
+	s.NoError(s.db.DeleteKind(s.ctx, "config"))
+
+	_, err = s.db.GetKind(s.ctx, "config")
+	s.Equal(db.ErrKindNotFound, err)
+
+	_, err = s.db.GetKindSchemas(s.ctx, "config")
+	s.Equal(db.ErrKindNotFound, err)
+}
+
+func (s *Suite) TestAttachments() {
+	thing, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "name", Value: "value"})
+	s.NoError(err)
+
+	attachment, err := s.db.CreateAttachment(s.ctx, db.Attachment{
+		UUID:        db.RandomID(),
+		ThingUUID:   thing.UUID,
+		Filename:    "image.png",
+		ContentType: "image/png",
+		Size:        3,
+		SHA256:      "checksum",
+		Created:     time.Now().UTC().Truncate(time.Millisecond),
+	})
+	s.NoError(err)
+
+	_, err = s.db.CreateAttachment(s.ctx, db.Attachment{UUID: db.RandomID(), ThingUUID: "does-not-exist"})
+	s.Equal(db.ErrThingNotFound, err)
+
+	retrievedAttachment, err := s.db.GetAttachment(s.ctx, thing.UUID, attachment.UUID)
+	s.NoError(err)
+	s.Equal(attachment.Filename, retrievedAttachment.Filename)
+	s.Equal(attachment.Size, retrievedAttachment.Size)
+
+	attachments, err := s.db.GetAttachments(s.ctx, thing.UUID)
+	s.NoError(err)
+	s.Len(attachments, 1)
+
+	s.NoError(s.db.DeleteAttachment(s.ctx, thing.UUID, attachment.UUID))
+	_, err = s.db.GetAttachment(s.ctx, thing.UUID, attachment.UUID)
+	s.Equal(db.ErrAttachmentNotFound, err)
+
+	attachment, err = s.db.CreateAttachment(s.ctx, db.Attachment{UUID: db.RandomID(), ThingUUID: thing.UUID})
+	s.NoError(err)
+
+	deletedAttachments, err := s.db.DeleteThing(s.ctx, thing.UUID, db.Restrict)
+	s.NoError(err)
+	s.Len(deletedAttachments, 1)
+	_, err = s.db.GetAttachments(s.ctx, thing.UUID)
+	s.Equal(db.ErrThingNotFound, err)
+
+	_, err = s.db.GetAttachments(s.ctx, db.RandomID())
+	s.Equal(db.ErrThingNotFound, err)
+}
+
+func (s *Suite) TestHierarchy() {
+	project, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "project", Value: "value"})
+	s.NoError(err)
+	s.Equal("", project.ParentUUID)
+
+	parentUUID := project.UUID
+	environment, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "environment", Value: "value", ParentUUID: &parentUUID})
+	s.NoError(err)
+	s.Equal(project.UUID, environment.ParentUUID)
+
+	parentUUID = environment.UUID
+	config, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "config", Value: "value", ParentUUID: &parentUUID})
+	s.NoError(err)
+
+	missing := db.RandomID()
+	_, err = s.db.CreateThing(s.ctx, db.ThingInput{Name: "orphan", Value: "value", ParentUUID: &missing})
+	s.Equal(db.ErrParentNotFound, err)
+
+	children, count, err := s.db.GetChildren(s.ctx, project.UUID, 0, 10, nil)
+	s.NoError(err)
+	s.Equal(1, count)
+	s.Equal(environment.UUID, children[0].UUID)
+
+	// children are ordered by uuid, not by when they were created
+	parentUUID = environment.UUID
+	secrets, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "secrets", Value: "value", ParentUUID: &parentUUID})
+	s.NoError(err)
+	children, count, err = s.db.GetChildren(s.ctx, environment.UUID, 0, 10, nil)
+	s.NoError(err)
+	s.Equal(2, count)
+	s.Require().Len(children, 2)
+	expected := []string{config.UUID, secrets.UUID}
+	sort.Strings(expected)
+	s.Equal(expected, []string{children[0].UUID, children[1].UUID})
+
+	_, _, err = s.db.GetChildren(s.ctx, missing, 0, 10, nil)
+	s.Equal(db.ErrThingNotFound, err)
+
+	ancestors, err := s.db.GetAncestors(s.ctx, config.UUID)
+	s.NoError(err)
+	s.Len(ancestors, 2)
+	s.Equal(project.UUID, ancestors[0].UUID)
+	s.Equal(environment.UUID, ancestors[1].UUID)
+
+	parentUUID = config.UUID
+	_, err = s.db.UpdateThing(s.ctx, project.UUID, db.ThingInput{Value: "value", ParentUUID: &parentUUID})
+	s.Equal(db.ErrCycle, err)
+
+	// moving environment to the root keeps config below it
+	root := ""
+	movedEnvironment, err := s.db.UpdateThing(s.ctx, environment.UUID, db.ThingInput{Value: "moved", ParentUUID: &root})
+	s.NoError(err)
+	s.Equal("", movedEnvironment.ParentUUID)
+	s.Equal("moved", movedEnvironment.Value)
+
+	ancestors, err = s.db.GetAncestors(s.ctx, config.UUID)
+	s.NoError(err)
+	s.Len(ancestors, 1)
+	s.Equal(environment.UUID, ancestors[0].UUID)
+
+	moved, err := s.db.GetThingsByUUID(s.ctx, []string{environment.UUID, config.UUID})
+	s.NoError(err)
+	s.Len(moved, 2)
+
+	_, err = s.db.DeleteThing(s.ctx, environment.UUID, db.Restrict)
+	s.Equal(db.ErrThingHasChildren, err)
+
+	_, err = s.db.DeleteThing(s.ctx, environment.UUID, db.Cascade)
+	s.NoError(err)
+
+	_, err = s.db.GetThing(s.ctx, config.UUID)
+	s.Equal(db.ErrThingNotFound, err)
+
+	deleted, err := s.db.GetThingsByUUID(s.ctx, []string{environment.UUID, config.UUID})
+	s.NoError(err)
+	s.Len(deleted, 0)
+
+	_, err = s.db.DeleteThing(s.ctx, project.UUID, db.Restrict)
+	s.NoError(err)
+}
+
+func (s *Suite) TestConcurrentMoves() {
+	a, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "a", Value: "value"})
+	s.Require().NoError(err)
+	b, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "b", Value: "value"})
+	s.Require().NoError(err)
+
+	// moving a below b and b below a at the same time cannot both succeed
+	errs := make(chan error, 2)
+	move := func(uuid string, parentUUID string) {
+		_, err := s.db.UpdateThing(s.ctx, uuid, db.ThingInput{Value: "value", ParentUUID: &parentUUID})
+		errs <- err
+	}
+	go move(a.UUID, b.UUID)
+	go move(b.UUID, a.UUID)
+	moved := 0
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			moved++
+		}
+	}
+	s.Equal(1, moved)
+
+	a, err = s.db.GetThing(s.ctx, a.UUID)
+	s.Require().NoError(err)
+	b, err = s.db.GetThing(s.ctx, b.UUID)
+	s.Require().NoError(err)
+	s.True((a.ParentUUID == b.UUID) != (b.ParentUUID == a.UUID), "a and b do not form a cycle")
+
+	root := a
+	if a.ParentUUID == b.UUID {
+		root = b
+	}
+	ancestors, err := s.db.GetAncestors(s.ctx, a.UUID)
+	s.NoError(err)
+	s.LessOrEqual(len(ancestors), 1)
+
+	_, err = s.db.DeleteThing(s.ctx, root.UUID, db.Cascade)
+	s.NoError(err)
+}
+
+func (s *Suite) TestConcurrentUpserts() {
+	a, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "a", Value: "value"})
+	s.Require().NoError(err)
+	b, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "b", Value: "value"})
+	s.Require().NoError(err)
+
+	// upserting a new thing below a and below b at the same time creates it once
+	uuid := db.RandomID()
+	created := make(chan bool, 2)
+	upsert := func(parentUUID string) {
+		_, ok, err := s.db.UpsertThing(s.ctx, uuid, db.ThingInput{Name: "c", Value: "value", ParentUUID: &parentUUID})
+		s.NoError(err)
+		created <- ok
+	}
+	go upsert(a.UUID)
+	go upsert(b.UUID)
+	s.True(<-created != <-created, "the thing is created once")
+
+	children := 0
+	for _, parent := range []db.Thing{a, b} {
+		_, count, err := s.db.GetChildren(s.ctx, parent.UUID, 0, 10, nil)
+		s.NoError(err)
+		children += count
+	}
+	s.Equal(1, children)
+
+	for _, parent := range []db.Thing{a, b} {
+		_, err = s.db.DeleteThing(s.ctx, parent.UUID, db.Cascade)
+		s.NoError(err)
+	}
+	_, err = s.db.GetThing(s.ctx, uuid)
+	s.Equal(db.ErrThingNotFound, err)
+}
+
+func (s *Suite) TestBackfillReaders() {
+	// things stored before owners were recorded have no Readers property
+	uuid := db.RandomID()
+	key := newThingKey(s.ctx, uuid, nil)
+	now := time.Now().UTC()
+	legacy := datastore.PropertyList{
+		{Name: "UUID", Value: uuid},
+		{Name: "Name", Value: "legacy"},
+		{Name: "Value", Value: "value"},
+		{Name: "Updated", Value: now},
+		{Name: "Created", Value: now},
+	}
+	_, err := s.db.(*service).datastoreClient.Put(s.ctx, key, &legacy)
+	s.Require().NoError(err)
+
+	viewer := &db.Viewer{Principal: "alice"}
+	listed := func() bool {
+		things, _, err := s.db.GetThings(s.ctx, 0, 100, nil, viewer)
+		s.Require().NoError(err)
+		for _, thing := range things {
+			if thing.UUID == uuid {
+				return true
+			}
+		}
+		return false
+	}
+	s.False(listed())
+
+	n, err := BackfillReaders(s.ctx, s.db)
+	s.NoError(err)
+	s.Equal(1, n)
+	s.True(listed())
+
+	n, err = BackfillReaders(s.ctx, s.db)
+	s.NoError(err)
+	s.Equal(0, n)
+
+	_, err = s.db.DeleteThing(s.ctx, uuid, db.Restrict)
+	s.NoError(err)
+}
+
+func (s *Suite) TestThingACL() {
+	// a label keeps things created by other tests out of the listings
+	marker := db.Labels{"acl": db.RandomID()}
+	private, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "private", Value: "value", Labels: marker, Owner: "alice"})
+	s.NoError(err)
+	s.Equal("alice", private.Owner)
+	s.Empty(private.ACL)
+
+	public, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "public", Value: "value", Labels: marker})
+	s.NoError(err)
+
+	parentUUID := private.UUID
+	child, err := s.db.CreateThing(s.ctx, db.ThingInput{Name: "child", Value: "value", ParentUUID: &parentUUID, Owner: "alice"})
+	s.NoError(err)
+
+	acl := db.ACL{{Principal: "bob", Level: db.ReadAccess}, {Group: "editors", Level: db.WriteAccess}}
+	shared, err := s.db.SetThingACL(s.ctx, private.UUID, acl)
+	s.NoError(err)
+	s.Equal(acl, shared.ACL)
+
+	retrievedThing, err := s.db.GetThing(s.ctx, private.UUID)
+	s.NoError(err)
+	s.Equal("alice", retrievedThing.Owner)
+	s.Equal(acl, retrievedThing.ACL)
+
+	_, err = s.db.SetThingACL(s.ctx, db.RandomID(), acl)
+	s.Equal(db.ErrThingNotFound, err)
+
+	_, err = s.db.SetThingACL(s.ctx, private.UUID, db.ACL{{Principal: "bob", Level: "admin"}})
+	s.Equal(db.ErrInvalidGrant, err)
+
+	sel, err := labels.Parse("acl=" + marker["acl"])
+	s.NoError(err)
+	for name, test := range map[string]struct {
+		viewer   *db.Viewer
+		expected []string
+	}{
+		"no viewer": {nil, []string{private.UUID, public.UUID}},
+		"owner":     {&db.Viewer{Principal: "alice"}, []string{private.UUID, public.UUID}},
+		"principal": {&db.Viewer{Principal: "bob"}, []string{private.UUID, public.UUID}},
+		"group":     {&db.Viewer{Principal: "carol", Groups: []string{"editors"}}, []string{private.UUID, public.UUID}},
+		"stranger":  {&db.Viewer{Principal: "mallory"}, []string{public.UUID}},
+		// a thing shared with the principal and a group of the viewer is listed once
+		"principal and group": {&db.Viewer{Principal: "bob", Groups: []string{"editors"}}, []string{private.UUID, public.UUID}},
+	} {
+		things, count, err := s.db.GetThings(s.ctx, 0, 10, sel, test.viewer)
+		s.NoError(err)
+		s.Equal(len(test.expected), count, name)
+
+		var uuids []string
+		for _, thing := range things {
+			uuids = append(uuids, thing.UUID)
+		}
+		s.ElementsMatch(test.expected, uuids, name)
+	}
+
+	first, count, err := s.db.GetThings(s.ctx, 0, 1, sel, &db.Viewer{Principal: "bob"})
+	s.NoError(err)
+	s.Equal(2, count)
+	second, _, err := s.db.GetThings(s.ctx, 1, 1, sel, &db.Viewer{Principal: "bob"})
+	s.NoError(err)
+	s.Require().Len(first, 1)
+	s.Require().Len(second, 1)
+	s.NotEqual(first[0].UUID, second[0].UUID)
+
+	_, count, err = s.db.GetChildren(s.ctx, private.UUID, 0, 10, &db.Viewer{Principal: "bob"})
+	s.NoError(err)
+	s.Equal(0, count)
+	_, count, err = s.db.GetChildren(s.ctx, private.UUID, 0, 10, &db.Viewer{Principal: "alice"})
+	s.NoError(err)
+	s.Equal(1, count)
+
+	_, err = s.db.DeleteThing(s.ctx, child.UUID, db.Restrict)
+	s.NoError(err)
+	_, err = s.db.DeleteThing(s.ctx, private.UUID, db.Restrict)
+	s.NoError(err)
+	_, err = s.db.DeleteThing(s.ctx, public.UUID, db.Restrict)
+	s.NoError(err)
+}
+
+func (s *Suite) TestTenancy() {
+	acme := tenant.NewContext(s.ctx, "acme-"+db.RandomID()[:8])
+	globex := tenant.NewContext(s.ctx, "globex-"+db.RandomID()[:8])
+
+	owner := db.RandomID()
+	thing, err := s.db.CreateThing(acme, db.ThingInput{Name: "acme", Value: "value", Owner: owner})
+	s.NoError(err)
+	_, err = s.db.CreateThing(acme, db.ThingInput{Name: "acme", Value: "value", Owner: owner})
+	s.NoError(err)
+	_, err = s.db.CreateThing(globex, db.ThingInput{Name: "globex", Value: "value", Owner: owner})
+	s.NoError(err)
+
+	count, err := s.db.CountThings(acme, owner)
+	s.NoError(err)
+	s.Equal(2, count)
+	count, err = s.db.CountThings(globex, owner)
+	s.NoError(err)
+	s.Equal(1, count)
+
+	retrievedThing, err := s.db.GetThing(acme, thing.UUID)
+	s.NoError(err)
+	s.Equal(thing.UUID, retrievedThing.UUID)
+
+	_, err = s.db.GetThing(globex, thing.UUID)
+	s.Equal(db.ErrThingNotFound, err)
+	_, err = s.db.GetThing(s.ctx, thing.UUID)
+	s.Equal(db.ErrThingNotFound, err)
+	_, err = s.db.UpdateThing(globex, thing.UUID, db.ThingInput{Value: "changed"})
+	s.Equal(db.ErrThingNotFound, err)
+
+	parentUUID := thing.UUID
+	_, err = s.db.CreateThing(globex, db.ThingInput{Name: "child", Value: "value", ParentUUID: &parentUUID})
+	s.Equal(db.ErrParentNotFound, err)
+
+	// a uuid used by another tenant does not exist in this tenant
+	_, err = s.db.CreateAttachment(globex, db.Attachment{UUID: db.RandomID(), ThingUUID: thing.UUID, Created: time.Now().UTC()})
+	s.Equal(db.ErrThingNotFound, err)
+	upserted, created, err := s.db.UpsertThing(globex, thing.UUID, db.ThingInput{Name: "globex", Value: "upserted"})
+	s.NoError(err)
+	s.True(created)
+	s.Equal(thing.UUID, upserted.UUID)
+	retrievedThing, err = s.db.GetThing(acme, thing.UUID)
+	s.NoError(err)
+	s.Equal("value", retrievedThing.Value)
+	_, err = s.db.DeleteThing(globex, thing.UUID, db.Restrict)
+	s.NoError(err)
+
+	things, count, err := s.db.GetThings(acme, 0, 10, nil, nil)
+	s.NoError(err)
+	s.Len(things, 2)
+	s.Equal(2, count)
+
+	things, count, err = s.db.GetThings(globex, 0, 10, nil, nil)
+	s.NoError(err)
+	s.Len(things, 1)
+	s.Equal(1, count)
+	s.Equal("globex", things[0].Name)
+
+	_, err = s.db.DeleteThing(globex, thing.UUID, db.Cascade)
+	s.Equal(db.ErrThingNotFound, err)
+	_, err = s.db.DeleteThing(acme, thing.UUID, db.Cascade)
+	s.NoError(err)
+}
+
+func (s *Suite) TestPing() {
+	s.NoError(s.db.Ping(s.ctx))
+}
+
+func (s *Suite) TestShareLinkUses() {
+	id := db.RandomID()
+	expires := time.Now().Add(time.Hour)
+	s.NoError(s.db.UseShareLink(s.ctx, id, 2, expires))
+	s.NoError(s.db.UseShareLink(s.ctx, id, 2, expires))
+	s.Equal(db.ErrShareLinkUsedUp, s.db.UseShareLink(s.ctx, id, 2, expires))
+
+	s.NoError(s.db.UseShareLink(s.ctx, db.RandomID(), 1, expires))
+
+	// the count of an expired link is deleted, expired links are rejected before they are used
+	expired := db.RandomID()
+	s.NoError(s.db.UseShareLink(s.ctx, expired, 1, time.Now().Add(-time.Hour)))
+	s.NoError(s.db.UseShareLink(s.ctx, db.RandomID(), 1, expires))
+	s.NoError(s.db.UseShareLink(s.ctx, expired, 1, time.Now().Add(-time.Hour)))
+}
+
+func (s *Suite) TestAPIKeys() {
+	key, err := s.db.CreateAPIKey(s.ctx, db.APIKey{
+		ID:     db.RandomID(),
+		Name:   "ci",
+		Hash:   "hash",
+		Scopes: db.Scopes{"things:read", "things:write"},
+		Tenant: "acme",
+	})
+	s.NoError(err)
+	s.False(key.Revoked)
+
+	_, err = s.db.CreateAPIKey(s.ctx, db.APIKey{ID: key.ID, Name: "duplicate", Hash: "hash"})
+	s.Equal(db.ErrAPIKeyAlreadyExists, err)
+
+	retrievedKey, err := s.db.GetAPIKey(s.ctx, key.ID)
+	s.NoError(err)
+	s.Equal("ci", retrievedKey.Name)
+	s.Equal("hash", retrievedKey.Hash)
+	s.Equal(db.Scopes{"things:read", "things:write"}, retrievedKey.Scopes)
+	s.Equal("acme", retrievedKey.Tenant)
+
+	keys, err := s.db.GetAPIKeys(s.ctx)
+	s.NoError(err)
+	s.Len(keys, 1)
+
+	rotatedKey, err := s.db.RotateAPIKey(s.ctx, key.ID, "rotated")
+	s.NoError(err)
+	s.Equal("rotated", rotatedKey.Hash)
+
+	revokedKey, err := s.db.RevokeAPIKey(s.ctx, key.ID)
+	s.NoError(err)
+	s.True(revokedKey.Revoked)
+
+	_, err = s.db.RevokeAPIKey(s.ctx, key.ID)
+	s.NoError(err)
+
+	_, err = s.db.RotateAPIKey(s.ctx, key.ID, "again")
+	s.Equal(db.ErrAPIKeyRevoked, err)
+
+	_, err = s.db.GetAPIKey(s.ctx, "does-not-exist")
+	s.Equal(db.ErrAPIKeyNotFound, err)
+	_, err = s.db.RotateAPIKey(s.ctx, "does-not-exist", "hash")
+	s.Equal(db.ErrAPIKeyNotFound, err)
+	_, err = s.db.RevokeAPIKey(s.ctx, "does-not-exist")
+	s.Equal(db.ErrAPIKeyNotFound, err)
 }
@@ -0,0 +1,94 @@
+package datastoredb
+
+import (
+	"encoding/json"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const (
+	labelsProperty    = "Labels"
+	labelKeysProperty = "LabelKeys"
+	aclProperty       = "ACL"
+	readersProperty   = "Readers"
+)
+
+var _ datastore.PropertyLoadSaver = (*entity)(nil)
+
+// entity is the datastore representation of a db.Thing
+// Labels are stored as the repeated properties Labels ("key=value") and LabelKeys ("key"),
+// so that things can be filtered on label values and on the existence of labels.
+// The ACL is stored as JSON next to the repeated property Readers.
+type entity struct {
+	db.Thing
+}
+
+func (e *entity) Load(properties []datastore.Property) error {
+	e.Labels = db.Labels{}
+	e.ACL = db.ACL{}
+
+	var rest []datastore.Property
+	for _, p := range properties {
+		switch p.Name {
+		case labelsProperty:
+			values, _ := p.Value.([]interface{})
+			for _, v := range values {
+				pair, _ := v.(string)
+				parts := strings.SplitN(pair, "=", 2)
+				if len(parts) == 2 {
+					e.Labels[parts[0]] = parts[1]
+				}
+			}
+		case aclProperty:
+			data, _ := p.Value.(string)
+			if err := json.Unmarshal([]byte(data), &e.ACL); err != nil {
+				return err
+			}
+		case labelKeysProperty, readersProperty:
+		default:
+			rest = append(rest, p)
+		}
+	}
+	return datastore.LoadStruct(&e.Thing, rest)
+}
+
+func (e *entity) Save() ([]datastore.Property, error) {
+	properties, err := datastore.SaveStruct(&e.Thing)
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := json.Marshal(e.ACL)
+	if err != nil {
+		return nil, err
+	}
+	var readers []interface{}
+	for _, reader := range e.Readers() {
+		readers = append(readers, reader)
+	}
+	properties = append(properties,
+		datastore.Property{Name: aclProperty, Value: string(acl), NoIndex: true},
+		datastore.Property{Name: readersProperty, Value: readers},
+	)
+
+	if len(e.Labels) == 0 {
+		return properties, nil
+	}
+
+	var pairs, keys []interface{}
+	for key, value := range e.Labels {
+		pairs = append(pairs, labelPair(key, value))
+		keys = append(keys, key)
+	}
+	return append(properties,
+		datastore.Property{Name: labelsProperty, Value: pairs},
+		datastore.Property{Name: labelKeysProperty, Value: keys},
+	), nil
+}
+
+func labelPair(key string, value string) string {
+	return key + "=" + value
+}
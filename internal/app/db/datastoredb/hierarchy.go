@@ -0,0 +1,291 @@
+package datastoredb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+// thingKey finds the key of a thing in its path, the key of a thing is a child of the key of its parent
+func (s *service) thingKey(ctx context.Context, uuid string) (*datastore.Key, error) {
+	keys, err := s.thingKeys(ctx, []string{uuid})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, db.ErrThingNotFound
+	}
+	return keys[0], nil
+}
+
+// queryThingKey finds the key of a thing stored before paths existed, the query is eventually consistent
+func (s *service) queryThingKey(ctx context.Context, uuid string) (*datastore.Key, error) {
+	query := tenantQuery(ctx, thingKind).Filter("UUID =", uuid).KeysOnly().Limit(1)
+	keys, err := s.datastoreClient.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, db.ErrThingNotFound
+	}
+	return keys[0], nil
+}
+
+// thingPathKind is the kind of the entities mapping the UUID of a thing to its key, which allows
+// looking up the keys of many things at once by their UUID
+const thingPathKind = "thing_path"
+
+// thingPath is stored in the same transaction as every thing that is created or moved, and deleted
+// with it. Unlike a query on the UUID property, getting it is strongly consistent.
+type thingPath struct {
+	Key *datastore.Key `datastore:",noindex"`
+}
+
+// thingPathKey returns the key of the path of a thing in the namespace of the tenant of ctx
+func thingPathKey(ctx context.Context, uuid string) *datastore.Key {
+	key := datastore.NameKey(thingPathKind, uuid, nil)
+	key.Namespace = namespace(ctx)
+	return key
+}
+
+// thingPathKeys returns the keys of the paths of the things among keys
+func thingPathKeys(ctx context.Context, keys []*datastore.Key) []*datastore.Key {
+	var pathKeys []*datastore.Key
+	for _, k := range keys {
+		if k.Kind == thingKind {
+			pathKeys = append(pathKeys, thingPathKey(ctx, k.Name))
+		}
+	}
+	return pathKeys
+}
+
+// putThingPaths stores the paths of the things among keys in tx
+func putThingPaths(ctx context.Context, tx *datastore.Transaction, keys []*datastore.Key) error {
+	var pathKeys []*datastore.Key
+	var paths []thingPath
+	for _, k := range keys {
+		if k.Kind == thingKind {
+			pathKeys = append(pathKeys, thingPathKey(ctx, k.Name))
+			paths = append(paths, thingPath{Key: k})
+		}
+	}
+	_, err := tx.PutMulti(pathKeys, paths)
+	return err
+}
+
+// thingKeys returns the keys of the things with uuids that exist, in the order of uuids. The keys are
+// read from the paths of the things at once, the key of a thing stored before paths existed is queried.
+func (s *service) thingKeys(ctx context.Context, uuids []string) ([]*datastore.Key, error) {
+	pathKeys := make([]*datastore.Key, len(uuids))
+	for i, uuid := range uuids {
+		pathKeys[i] = thingPathKey(ctx, uuid)
+	}
+	paths := make([]thingPath, len(uuids))
+	err := s.datastoreClient.GetMulti(ctx, pathKeys, paths)
+	errs, _ := err.(datastore.MultiError)
+	if err != nil && errs == nil {
+		return nil, err
+	}
+
+	var keys []*datastore.Key
+	for i, uuid := range uuids {
+		if errs == nil || errs[i] == nil {
+			keys = append(keys, paths[i].Key)
+			continue
+		}
+		if errs[i] != datastore.ErrNoSuchEntity {
+			return nil, errs[i]
+		}
+		key, err := s.queryThingKey(ctx, uuid)
+		if err == db.ErrThingNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// newThingKey returns the key of a thing below parent in the namespace of the tenant of ctx
+func newThingKey(ctx context.Context, uuid string, parent *datastore.Key) *datastore.Key {
+	key := datastore.NameKey(thingKind, uuid, parent)
+	key.Namespace = namespace(ctx)
+	return key
+}
+
+func parentUUID(key *datastore.Key) string {
+	if key.Parent == nil {
+		return ""
+	}
+	return key.Parent.Name
+}
+
+// maxMoveAttempts limits how often a move is attempted when the thing or its new parent is moved or
+// deleted while it is moved
+const maxMoveAttempts = 3
+
+// errMoved is returned by a move transaction when the key of the thing or of an ancestor of its new
+// parent no longer exists, because it was moved or deleted since the keys were looked up
+var errMoved = errors.New("moved concurrently")
+
+// move gives the thing with key and all its descendants and attachments new keys below the new parent,
+// the whole subtree and the paths of its things are moved in a single transaction which limits it to
+// 500 entities. The keys are
+// looked up again when the thing or the new parent was moved or deleted in the meantime.
+func (s *service) move(ctx context.Context, key *datastore.Key, newParentUUID string, input db.ThingInput) (db.Thing, error) {
+	for attempt := 1; ; attempt++ {
+		thing, err := s.moveOnce(ctx, key, newParentUUID, input)
+		if err != errMoved {
+			return thing, err
+		}
+		if attempt == maxMoveAttempts {
+			return db.Thing{}, datastore.ErrConcurrentTransaction
+		}
+		if key, err = s.thingKey(ctx, key.Name); err != nil {
+			return db.Thing{}, err
+		}
+		if parentUUID(key) == newParentUUID {
+			return s.update(ctx, key, input)
+		}
+	}
+}
+
+func (s *service) moveOnce(ctx context.Context, key *datastore.Key, newParentUUID string, input db.ThingInput) (db.Thing, error) {
+	var newParentKey *datastore.Key
+	var ancestors []*datastore.Key
+	if newParentUUID != "" {
+		var err error
+		newParentKey, err = s.thingKey(ctx, newParentUUID)
+		if err == db.ErrThingNotFound {
+			return db.Thing{}, db.ErrParentNotFound
+		}
+		if err != nil {
+			return db.Thing{}, err
+		}
+		for k := newParentKey; k != nil; k = k.Parent {
+			if k.Equal(key) {
+				return db.Thing{}, db.ErrCycle
+			}
+			ancestors = append(ancestors, k)
+		}
+	}
+	newKey := newThingKey(ctx, key.Name, newParentKey)
+
+	var thing entity
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		// the new parent and its ancestors are read in the transaction, so a concurrent move or delete
+		// of any of them aborts this move instead of creating a cycle or an orphan
+		if len(ancestors) > 0 {
+			err := tx.GetMulti(ancestors, make([]entity, len(ancestors)))
+			if errs, ok := err.(datastore.MultiError); ok {
+				for _, err := range errs {
+					if err == datastore.ErrNoSuchEntity {
+						return errMoved
+					}
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		var subtree []datastore.PropertyList
+		query := tenantQuery(ctx, "").Ancestor(key).Transaction(tx)
+		keys, err := s.datastoreClient.GetAll(ctx, query, &subtree)
+		if err != nil {
+			return err
+		}
+
+		thing = entity{}
+		newKeys := make([]*datastore.Key, len(keys))
+		for i, k := range keys {
+			newKeys[i] = rebase(k, key, newKey)
+			if !k.Equal(key) {
+				continue
+			}
+			if err := thing.Load(subtree[i]); err != nil {
+				return err
+			}
+			update(&thing.Thing, input, time.Now().UTC())
+			thing.ParentUUID = newParentUUID
+			if subtree[i], err = thing.Save(); err != nil {
+				return err
+			}
+		}
+		if thing.UUID == "" {
+			return errMoved
+		}
+
+		if _, err := tx.PutMulti(newKeys, subtree); err != nil {
+			return err
+		}
+		if err := putThingPaths(ctx, tx, newKeys); err != nil {
+			return err
+		}
+		return tx.DeleteMulti(keys)
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing.Thing, nil
+}
+
+// rebase replaces the ancestor oldRoot of key with newRoot
+func rebase(key *datastore.Key, oldRoot *datastore.Key, newRoot *datastore.Key) *datastore.Key {
+	if key == nil || key.Equal(oldRoot) {
+		return newRoot
+	}
+	return &datastore.Key{
+		Kind:      key.Kind,
+		ID:        key.ID,
+		Name:      key.Name,
+		Parent:    rebase(key.Parent, oldRoot, newRoot),
+		Namespace: key.Namespace,
+	}
+}
+
+func (s *service) GetChildren(ctx context.Context, uuid string, offset int, limit int, viewer *db.Viewer) ([]db.Thing, int, error) {
+	if _, err := s.thingKey(ctx, uuid); err != nil {
+		return nil, 0, err
+	}
+
+	query := tenantQuery(ctx, thingKind).Filter("ParentUUID =", uuid).Order("UUID")
+	if viewer != nil {
+		return s.viewerThings(ctx, query, offset, limit, viewer, nil)
+	}
+
+	var entities []entity
+	_, err := s.datastoreClient.GetAll(ctx, query.Offset(offset).Limit(limit), &entities)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := s.datastoreClient.Count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return toThings(entities), count, nil
+}
+
+func (s *service) GetAncestors(ctx context.Context, uuid string) ([]db.Thing, error) {
+	key, err := s.thingKey(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*datastore.Key
+	for k := key.Parent; k != nil; k = k.Parent {
+		keys = append([]*datastore.Key{k}, keys...)
+	}
+	entities := make([]entity, len(keys))
+	err = s.datastoreClient.GetMulti(ctx, keys, entities)
+	if err != nil {
+		return nil, err
+	}
+	return toThings(entities), nil
+}
@@ -0,0 +1,156 @@
+package datastoredb
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const (
+	kindKind       = "kind"
+	kindSchemaKind = "kind_schema"
+)
+
+func kindKey(name string) *datastore.Key {
+	return datastore.NameKey(kindKind, name, nil)
+}
+
+// kindSchemaKey stores the schema versions of a kind as its children
+func kindSchemaKey(name string, version int) *datastore.Key {
+	return datastore.IDKey(kindSchemaKind, int64(version), kindKey(name))
+}
+
+func (s *service) GetKind(ctx context.Context, name string) (db.Kind, error) {
+	var kind db.Kind
+	err := s.datastoreClient.Get(ctx, kindKey(name), &kind)
+	if err == datastore.ErrNoSuchEntity {
+		return db.Kind{}, db.ErrKindNotFound
+	}
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return kind, nil
+}
+
+func (s *service) GetKinds(ctx context.Context) ([]db.Kind, error) {
+	var kinds []db.Kind
+	query := datastore.NewQuery(kindKind).Order("__key__")
+	_, err := s.datastoreClient.GetAll(ctx, query, &kinds)
+	if err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+func (s *service) CreateKind(ctx context.Context, name string, description string, schema db.JSON) (db.Kind, error) {
+	now := time.Now().UTC()
+	kind := db.Kind{
+		Name:        name,
+		Description: description,
+		Version:     1,
+		Schema:      schema,
+		Updated:     now,
+		Created:     now,
+	}
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var existing db.Kind
+		err := tx.Get(kindKey(name), &existing)
+		if err == nil {
+			return db.ErrKindAlreadyExists
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		return putKind(tx, kind)
+	})
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return kind, nil
+}
+
+func (s *service) AddKindSchema(ctx context.Context, name string, schema db.JSON) (db.Kind, error) {
+	var kind db.Kind
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		kind = db.Kind{}
+		err := tx.Get(kindKey(name), &kind)
+		if err == datastore.ErrNoSuchEntity {
+			return db.ErrKindNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		kind.Version++
+		kind.Schema = schema
+		kind.Updated = time.Now().UTC()
+		return putKind(tx, kind)
+	})
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return kind, nil
+}
+
+func (s *service) GetKindSchemas(ctx context.Context, name string) ([]db.KindSchema, error) {
+	var schemas []db.KindSchema
+	query := datastore.NewQuery(kindSchemaKind).Ancestor(kindKey(name)).Order("__key__")
+	_, err := s.datastoreClient.GetAll(ctx, query, &schemas)
+	if err != nil {
+		return nil, err
+	}
+	// every kind has at least one schema
+	if len(schemas) == 0 {
+		return nil, db.ErrKindNotFound
+	}
+	return schemas, nil
+}
+
+// DeleteKind checks that no thing of any tenant uses the kind before it deletes the kind in a transaction.
+// A transaction cannot query the things of all namespaces, a thing created with the kind in the meantime
+// is left with a deleted kind.
+func (s *service) DeleteKind(ctx context.Context, name string) error {
+	// kinds are shared by all tenants
+	namespaces, err := s.namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces {
+		query := datastore.NewQuery(thingKind).Namespace(namespace).Filter("Kind =", name).KeysOnly().Limit(1)
+		keys, err := s.datastoreClient.GetAll(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			return db.ErrKindInUse
+		}
+	}
+
+	_, err = s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		query := datastore.NewQuery(kindSchemaKind).Ancestor(kindKey(name)).KeysOnly().Transaction(tx)
+		keys, err := s.datastoreClient.GetAll(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		return tx.DeleteMulti(append(keys, kindKey(name)))
+	})
+	return err
+}
+
+// putKind stores the kind together with its latest schema
+func putKind(tx *datastore.Transaction, kind db.Kind) error {
+	schema := db.KindSchema{
+		Kind:    kind.Name,
+		Version: kind.Version,
+		Schema:  kind.Schema,
+		Created: kind.Updated,
+	}
+	_, err := tx.PutMulti(
+		[]*datastore.Key{kindKey(kind.Name), kindSchemaKey(kind.Name, kind.Version)},
+		[]interface{}{&kind, &schema},
+	)
+	return err
+}
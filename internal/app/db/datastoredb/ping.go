@@ -0,0 +1,19 @@
+package datastoredb
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// pingKind is never stored, looking up an entity of it is the cheapest round trip to Datastore
+const pingKind = "ping"
+
+// Ping looks up an entity which does not exist, Datastore has no ping of its own
+func (s *service) Ping(ctx context.Context) error {
+	err := s.datastoreClient.Get(ctx, datastore.NameKey(pingKind, "ping", nil), &struct{}{})
+	if err == datastore.ErrNoSuchEntity {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package datastoredb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const (
+	shareLinkUseKind = "share_link_use"
+	// maxExpiredShareLinkUses is the number of expired entities deleted per use, the maximum of DeleteMulti
+	maxExpiredShareLinkUses = 500
+)
+
+// shareLinkUse counts the uses of a share link, entities of expired links are deleted
+type shareLinkUse struct {
+	Uses    int
+	Expires time.Time
+}
+
+// UseShareLink counts the use in a transaction and deletes the entities of expired links afterwards,
+// failing to delete them is logged as the use is already counted
+func (s *service) UseShareLink(ctx context.Context, id string, maxUses int, expires time.Time) error {
+	key := datastore.NameKey(shareLinkUseKind, id, nil)
+	_, err := s.datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		use := shareLinkUse{Expires: expires.UTC()}
+		err := tx.Get(key, &use)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if use.Uses >= maxUses {
+			return db.ErrShareLinkUsedUp
+		}
+		use.Uses++
+		_, err = tx.Put(key, &use)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.deleteExpiredShareLinkUses(ctx); err != nil {
+		s.options.Log.Error(ctx, fmt.Errorf("deleting expired share link uses: %w", err))
+	}
+	return nil
+}
+
+func (s *service) deleteExpiredShareLinkUses(ctx context.Context) error {
+	query := datastore.NewQuery(shareLinkUseKind).
+		Filter("Expires <", time.Now().UTC()).
+		Limit(maxExpiredShareLinkUses).
+		KeysOnly()
+	keys, err := s.datastoreClient.GetAll(ctx, query, nil)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return s.datastoreClient.DeleteMulti(ctx, keys)
+}
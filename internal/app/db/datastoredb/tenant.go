@@ -0,0 +1,37 @@
+package datastoredb
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+// namespaceKind is the kind of the metadata query listing all namespaces
+const namespaceKind = "__namespace__"
+
+// namespace returns the namespace of the tenant of ctx, the things and attachments of every tenant
+// are stored in its own namespace while kinds and API keys are shared in the default namespace
+func namespace(ctx context.Context) string {
+	return tenant.FromContext(ctx)
+}
+
+// tenantQuery queries the entities of kind in the namespace of the tenant of ctx
+func tenantQuery(ctx context.Context, kind string) *datastore.Query {
+	return datastore.NewQuery(kind).Namespace(namespace(ctx))
+}
+
+// namespaces returns all namespaces, including the default namespace
+func (s *service) namespaces(ctx context.Context) ([]string, error) {
+	keys, err := s.datastoreClient.GetAll(ctx, datastore.NewQuery(namespaceKind).KeysOnly(), nil)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// the default namespace has an ID instead of a name
+		namespaces = append(namespaces, key.Name)
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,145 @@
+package datastoredb
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+// maxFilteredThings limits the things a viewer can read which are retrieved to be filtered in memory
+const maxFilteredThings = 10000
+
+// viewerThings retrieves the page of things matching query which viewer can read. A query cannot match
+// multiple readers at once, so the things are queried with a keys only query on Readers per subject of
+// the viewer. Only the first offset+limit keys of every subject are needed for the merged page, and only
+// the things of the page are retrieved. Things which have to be filtered in memory as well are all
+// retrieved, up to maxFilteredThings.
+func (s *service) viewerThings(ctx context.Context, query *datastore.Query, offset int, limit int, viewer *db.Viewer, filter func(db.Thing) bool) ([]db.Thing, int, error) {
+	if filter != nil {
+		return s.filterViewerThings(ctx, query, offset, limit, viewer, filter)
+	}
+
+	var keys [][]*datastore.Key
+	for _, subject := range viewer.Subjects() {
+		subjectKeys, err := s.datastoreClient.GetAll(ctx, readerQuery(query, subject).KeysOnly().Limit(offset+limit), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		keys = append(keys, subjectKeys)
+	}
+	page, _ := pageKeys(keys, offset, limit)
+
+	count, err := s.countViewerThings(ctx, query, viewer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entities := make([]entity, len(page))
+	if err := s.datastoreClient.GetMulti(ctx, page, entities); err != nil {
+		return nil, 0, err
+	}
+	return toThings(entities), count, nil
+}
+
+// countViewerThings counts the distinct things matching query which viewer can read. Things without owner
+// have no other readers, they are counted without retrieving their keys.
+func (s *service) countViewerThings(ctx context.Context, query *datastore.Query, viewer *db.Viewer) (int, error) {
+	count := 0
+	var keys [][]*datastore.Key
+	for _, subject := range viewer.Subjects() {
+		if subject == db.Everyone {
+			n, err := s.datastoreClient.Count(ctx, readerQuery(query, subject))
+			if err != nil {
+				return 0, err
+			}
+			count += n
+			continue
+		}
+		subjectKeys, err := s.datastoreClient.GetAll(ctx, readerQuery(query, subject).KeysOnly(), nil)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, subjectKeys)
+	}
+	return count + len(mergeKeys(keys)), nil
+}
+
+// filterViewerThings retrieves the things matching query which viewer can read and paginates the things
+// matching filter, ErrTooManyThings is returned when the viewer can read more than maxFilteredThings of them
+func (s *service) filterViewerThings(ctx context.Context, query *datastore.Query, offset int, limit int, viewer *db.Viewer, filter func(db.Thing) bool) ([]db.Thing, int, error) {
+	var keys [][]*datastore.Key
+	entities := map[string]entity{}
+	for _, subject := range viewer.Subjects() {
+		var subjectEntities []entity
+		subjectKeys, err := s.datastoreClient.GetAll(ctx, readerQuery(query, subject).Limit(maxFilteredThings+1), &subjectEntities)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(subjectKeys) > maxFilteredThings {
+			return nil, 0, db.ErrTooManyThings
+		}
+		for i, key := range subjectKeys {
+			entities[key.String()] = subjectEntities[i]
+		}
+		keys = append(keys, subjectKeys)
+	}
+
+	merged := mergeKeys(keys)
+	if len(merged) > maxFilteredThings {
+		return nil, 0, db.ErrTooManyThings
+	}
+	var things []db.Thing
+	for _, key := range merged {
+		if thing := entities[key.String()].Thing; filter(thing) {
+			things = append(things, thing)
+		}
+	}
+	count := len(things)
+	if offset > count {
+		offset = count
+	}
+	end := offset + limit
+	if end > count {
+		end = count
+	}
+	return things[offset:end], count, nil
+}
+
+// readerQuery restricts query to the things subject can read
+func readerQuery(query *datastore.Query, subject string) *datastore.Query {
+	return query.Filter(readersProperty+" =", subject)
+}
+
+// pageKeys merges the keys of the queries per subject and returns the keys of the page with the number
+// of distinct keys
+func pageKeys(keys [][]*datastore.Key, offset int, limit int) ([]*datastore.Key, int) {
+	merged := mergeKeys(keys)
+	count := len(merged)
+	if offset > count {
+		offset = count
+	}
+	end := offset + limit
+	if end > count {
+		end = count
+	}
+	return merged[offset:end], count
+}
+
+// mergeKeys returns the distinct keys of all lists ordered by their name, which is the UUID of the thing
+func mergeKeys(lists [][]*datastore.Key) []*datastore.Key {
+	seen := map[string]bool{}
+	var merged []*datastore.Key
+	for _, keys := range lists {
+		for _, key := range keys {
+			if !seen[key.String()] {
+				seen[key.String()] = true
+				merged = append(merged, key)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name < merged[j].Name })
+	return merged
+}
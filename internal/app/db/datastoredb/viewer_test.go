@@ -0,0 +1,36 @@
+package datastoredb
+
+import (
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageKeys(t *testing.T) {
+	project := datastore.NameKey(thingKind, "b", nil)
+	environment := datastore.NameKey(thingKind, "a", project)
+	config := datastore.NameKey(thingKind, "d", environment)
+	other := datastore.NameKey(thingKind, "c", nil)
+
+	// the things of a viewer and its groups overlap
+	keys := [][]*datastore.Key{
+		{environment, project, other},
+		{environment, config},
+		{datastore.NameKey(thingKind, "c", nil)},
+	}
+
+	// keys are ordered by uuid, not by their place in the hierarchy
+	page, count := pageKeys(keys, 0, 2)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []*datastore.Key{environment, project}, page)
+
+	// only the keys of the requested page are retrieved
+	page, count = pageKeys(keys, 2, 2)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []*datastore.Key{other, config}, page)
+
+	page, count = pageKeys(keys, 10, 2)
+	assert.Equal(t, 4, count)
+	assert.Empty(t, page)
+}
@@ -2,27 +2,343 @@ package db
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
 	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+	"github.com/ldej/api-ldej-nl/pkg/log"
 )
 
 type Service interface {
 	GetThing(ctx context.Context, uuid string) (Thing, error)
-	CreateThing(ctx context.Context, name string, value string) (Thing, error)
-	UpdateThing(ctx context.Context, uuid string, value string) (Thing, error)
-	DeleteThing(ctx context.Context, uuid string) error
-	GetThings(ctx context.Context, offset int, limit int) ([]Thing, int, error)
+	// GetThingsByUUID returns the things with the given uuids in a single lookup, missing things are left out
+	GetThingsByUUID(ctx context.Context, uuids []string) ([]Thing, error)
+	CreateThing(ctx context.Context, input ThingInput) (Thing, error)
+	// UpdateThing updates the value and data of a thing, its name and labels are kept when empty or nil
+	UpdateThing(ctx context.Context, uuid string, input ThingInput) (Thing, error)
+	// UpsertThing updates the thing with the given uuid like UpdateThing, or creates it when it does not exist yet.
+	// The returned bool reports whether the thing was created.
+	// Creating a thing requires a name, without one ErrThingNotFound is returned.
+	UpsertThing(ctx context.Context, uuid string, input ThingInput) (Thing, bool, error)
+	// DeleteThing deletes a thing with its attachments, a thing with children is only deleted with the Cascade policy
+	// which deletes all its descendants as well. The metadata of all deleted attachments is returned.
+	// ErrThingNotFound is returned when the thing does not exist.
+	DeleteThing(ctx context.Context, uuid string, policy DeletePolicy) ([]Attachment, error)
+	// GetThings returns the things matching selector ordered by UUID and the total number of matching things,
+	// a viewer restricts them to the things it can read. ErrTooManyThings is returned when a backend has to
+	// filter too many things in memory for a viewer.
+	GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, viewer *Viewer) ([]Thing, int, error)
+	// GetChildren returns the direct children of a thing ordered by UUID and the total number of children,
+	// a viewer restricts them to the children it can read
+	GetChildren(ctx context.Context, uuid string, offset int, limit int, viewer *Viewer) ([]Thing, int, error)
+	// GetAncestors returns the ancestors of a thing, starting at the root
+	GetAncestors(ctx context.Context, uuid string) ([]Thing, error)
+	// CountThings returns the number of things owned by owner
+	CountThings(ctx context.Context, owner string) (int, error)
+	// SetThingACL replaces the grants of a thing, ErrThingNotFound is returned when the thing does not exist
+	// and ErrInvalidGrant when a grant is invalid
+	SetThingACL(ctx context.Context, uuid string, acl ACL) (Thing, error)
+
+	GetKind(ctx context.Context, name string) (Kind, error)
+	GetKinds(ctx context.Context) ([]Kind, error)
+	// CreateKind creates a kind with schema as version 1
+	CreateKind(ctx context.Context, name string, description string, schema JSON) (Kind, error)
+	// AddKindSchema adds schema as the next version of a kind
+	AddKindSchema(ctx context.Context, name string, schema JSON) (Kind, error)
+	// GetKindSchemas returns all schema versions of a kind, oldest first
+	GetKindSchemas(ctx context.Context, name string) ([]KindSchema, error)
+	// DeleteKind deletes a kind and its schemas, a kind still used by things cannot be deleted
+	DeleteKind(ctx context.Context, name string) error
+
+	// CreateAttachment stores the metadata of an attachment, the content is stored in a blob.Store
+	CreateAttachment(ctx context.Context, attachment Attachment) (Attachment, error)
+	GetAttachment(ctx context.Context, thingUUID string, uuid string) (Attachment, error)
+	// GetAttachments returns the attachments of a thing, ErrThingNotFound is returned when the thing does not exist
+	GetAttachments(ctx context.Context, thingUUID string) ([]Attachment, error)
+	DeleteAttachment(ctx context.Context, thingUUID string, uuid string) error
+
+	// CreateAPIKey stores an API key, ErrAPIKeyAlreadyExists is returned when its ID is taken
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+	// GetAPIKeys returns all API keys, including revoked keys, oldest first
+	GetAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RotateAPIKey replaces the hash of an API key, the previous secret stops working.
+	// ErrAPIKeyRevoked is returned for a revoked key.
+	RotateAPIKey(ctx context.Context, id string, hash string) (APIKey, error)
+	// RevokeAPIKey revokes an API key for good, revoking a revoked key is not an error
+	RevokeAPIKey(ctx context.Context, id string) (APIKey, error)
+
+	// UseShareLink counts a use of the share link with id, ErrShareLinkUsedUp is returned when it was
+	// used maxUses times already. The count is kept until the link expires, the counts of expired links
+	// are deleted.
+	UseShareLink(ctx context.Context, id string, maxUses int, expires time.Time) error
+
+	// Ping returns an error when the database cannot be reached
+	Ping(ctx context.Context) error
 }
 
 type Thing struct {
-	UUID  string `db:"uuid"`
-	Name  string `db:"name"`
-	Value string `db:"value"`
+	UUID   string `db:"uuid"`
+	Name   string `db:"name"`
+	Value  string `db:"value"`
+	Labels Labels `db:"labels" datastore:"-"`
+	// ParentUUID is empty for things at the root of the hierarchy
+	ParentUUID string `db:"parent_uuid"`
+
+	// Kind is empty for untyped things, kinded things store their value as Data
+	Kind        string `db:"kind"`
+	KindVersion int    `db:"kind_version"`
+	Data        JSON   `db:"data" datastore:",noindex"`
+
+	// Owner is the principal which created the thing, things without owner are accessible to everyone
+	Owner string `db:"owner"`
+	// ACL shares the thing with other principals and groups
+	ACL ACL `db:"acl" datastore:"-"`
+
+	Updated time.Time `db:"updated"`
+	Created time.Time `db:"created"`
+}
+
+// ThingInput holds the fields of a thing which are set on creation or update
+// Kind is only used when a thing is created
+type ThingInput struct {
+	Kind        string
+	KindVersion int
+	Name        string
+	Value       string
+	Data        JSON
+	Labels      Labels
+	// ParentUUID moves a thing to another parent unless it is nil, an empty string moves it to the root
+	ParentUUID *string
+	// Owner is only used when a thing is created
+	Owner string
+}
+
+// DeletePolicy determines what happens to the children of a deleted thing
+type DeletePolicy int
+
+const (
+	// Restrict refuses to delete a thing which has children
+	Restrict DeletePolicy = iota
+	// Cascade deletes all descendants of a thing
+	Cascade
+)
+
+// Kind is a registered type of thing, the data of things of this kind is validated against Schema
+type Kind struct {
+	Name        string `db:"name"`
+	Description string `db:"description"`
+	// Version is the version of Schema, the latest schema of the kind
+	Version int  `db:"version"`
+	Schema  JSON `db:"schema" datastore:",noindex"`
+
+	Updated time.Time `db:"updated"`
+	Created time.Time `db:"created"`
+}
+
+type KindSchema struct {
+	Kind    string `db:"kind"`
+	Version int    `db:"version"`
+	Schema  JSON   `db:"schema" datastore:",noindex"`
+
+	Created time.Time `db:"created"`
+}
+
+// Attachment is the metadata of a file attached to a thing
+type Attachment struct {
+	UUID        string `db:"uuid"`
+	ThingUUID   string `db:"thing_uuid"`
+	Filename    string `db:"filename"`
+	ContentType string `db:"content_type"`
+	Size        int64  `db:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the content
+	SHA256 string `db:"sha256"`
+
+	Created time.Time `db:"created"`
+}
+
+// APIKey grants access to the API within its scopes, only a hash of its secret is stored
+type APIKey struct {
+	ID   string `db:"id"`
+	Name string `db:"name"`
+	// Hash is the hex encoded SHA-256 hash of the secret of the key
+	Hash    string `db:"hash" datastore:",noindex"`
+	Scopes  Scopes `db:"scopes"`
+	Revoked bool   `db:"revoked"`
+	// Tenant is the tenant the key is bound to, it is required when tenancy is enabled
+	Tenant string `db:"tenant"`
 
 	Updated time.Time `db:"updated"`
 	Created time.Time `db:"created"`
 }
 
 var (
-	ErrThingNotFound = errors.New("thing not found")
+	ErrThingNotFound       = errors.New("thing not found")
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrParentNotFound      = errors.New("parent thing not found")
+	ErrCycle               = errors.New("a thing cannot be moved below itself")
+	ErrThingHasChildren    = errors.New("thing has children")
+	ErrKindNotFound        = errors.New("kind not found")
+	ErrKindAlreadyExists   = errors.New("kind already exists")
+	ErrKindInUse           = errors.New("kind is used by things")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrAPIKeyAlreadyExists = errors.New("api key already exists")
+	ErrAPIKeyRevoked       = errors.New("api key is revoked")
+	ErrShareLinkUsedUp     = errors.New("the share link is used up")
+	ErrInvalidGrant        = errors.New("a grant needs either a principal or a group and the read or write level")
+	ErrTooManyThings       = errors.New("too many things match the label selector, use equality or existence requirements")
 )
+
+// JSON is a raw JSON document, stored as jsonb or a blob
+type JSON []byte
+
+// MarshalJSON implements json.Marshaler
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[0:0], data...)
+	return nil
+}
+
+// Value implements driver.Valuer
+func (j JSON) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner
+func (j *JSON) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*j = nil
+		return nil
+	case []byte:
+		*j = append(JSON(nil), src...)
+		return nil
+	case string:
+		*j = JSON(src)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into JSON", src)
+}
+
+// Labels are the key/value pairs used to categorise a thing, stored as JSON
+type Labels map[string]string
+
+// Value implements driver.Valuer
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (l *Labels) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*l = Labels{}
+		return nil
+	case []byte:
+		return json.Unmarshal(src, l)
+	case string:
+		return json.Unmarshal([]byte(src), l)
+	}
+	return fmt.Errorf("cannot scan %T into Labels", src)
+}
+
+// Scopes are the scopes granted to an API key, stored as JSON
+type Scopes []string
+
+// Value implements driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(s))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (s *Scopes) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*s = Scopes{}
+		return nil
+	case []byte:
+		return json.Unmarshal(src, (*[]string)(s))
+	case string:
+		return json.Unmarshal([]byte(src), (*[]string)(s))
+	}
+	return fmt.Errorf("cannot scan %T into Scopes", src)
+}
+
+// IDGenerator generates the identifier of a newly created thing
+type IDGenerator func() string
+
+// RandomID generates a random (version 4) UUID
+func RandomID() string {
+	return uuid.New().String()
+}
+
+// TimeSortableID generates a time-ordered (version 7) UUID,
+// sorting things by their identifier sorts them by creation time
+func TimeSortableID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// Options are the options shared by all Service implementations
+type Options struct {
+	NewID IDGenerator
+	// Log logs the errors of work done after an operation succeeded, like cleaning up
+	Log *log.Logger
+}
+
+type Option func(*Options)
+
+// WithIDGenerator sets the generator used for the identifiers of created things, defaults to RandomID
+func WithIDGenerator(newID IDGenerator) Option {
+	return func(o *Options) {
+		o.NewID = newID
+	}
+}
+
+// WithLogger sets the logger of errors which do not fail an operation, defaults to a logger writing to stderr
+func WithLogger(logger *log.Logger) Option {
+	return func(o *Options) {
+		o.Log = logger
+	}
+}
+
+// NewOptions applies the given options on top of the defaults
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		NewID: RandomID,
+		Log:   log.NewJSONLogger(os.Stderr, "", false),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -0,0 +1,97 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const apiKeyColumns = `id, name, hash, scopes, revoked, tenant, updated, created`
+
+func (s *service) CreateAPIKey(ctx context.Context, key db.APIKey) (db.APIKey, error) {
+	now := time.Now().UTC()
+	key.Revoked = false
+	key.Updated = now
+	key.Created = now
+
+	result, err := s.pg.NamedExecContext(
+		ctx,
+		`INSERT INTO api_keys (`+apiKeyColumns+`)
+		    VALUES (:id, :name, :hash, :scopes, :revoked, :tenant, :updated, :created) ON CONFLICT (id) DO NOTHING`,
+		key,
+	)
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return db.APIKey{}, err
+	} else if inserted == 0 {
+		return db.APIKey{}, db.ErrAPIKeyAlreadyExists
+	}
+	return key, nil
+}
+
+func (s *service) GetAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	var key db.APIKey
+	err := s.pg.GetContext(ctx, &key, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return db.APIKey{}, db.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *service) GetAPIKeys(ctx context.Context) ([]db.APIKey, error) {
+	var keys []db.APIKey
+	err := s.pg.SelectContext(ctx, &keys, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created, id`)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *service) RotateAPIKey(ctx context.Context, id string, hash string) (db.APIKey, error) {
+	var key db.APIKey
+	err := s.pg.GetContext(
+		ctx,
+		&key,
+		`UPDATE api_keys SET hash = $1, updated = $2 WHERE id = $3 AND NOT revoked RETURNING `+apiKeyColumns,
+		hash,
+		time.Now().UTC(),
+		id,
+	)
+	if err == sql.ErrNoRows {
+		// either the key does not exist or it is revoked
+		if _, err := s.GetAPIKey(ctx, id); err != nil {
+			return db.APIKey{}, err
+		}
+		return db.APIKey{}, db.ErrAPIKeyRevoked
+	}
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *service) RevokeAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	var key db.APIKey
+	err := s.pg.GetContext(
+		ctx,
+		&key,
+		`UPDATE api_keys SET revoked = true, updated = CASE WHEN revoked THEN updated ELSE $1 END
+		    WHERE id = $2 RETURNING `+apiKeyColumns,
+		time.Now().UTC(),
+		id,
+	)
+	if err == sql.ErrNoRows {
+		return db.APIKey{}, db.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	return key, nil
+}
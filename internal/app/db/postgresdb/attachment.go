@@ -0,0 +1,88 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+func (s *service) CreateAttachment(ctx context.Context, attachment db.Attachment) (db.Attachment, error) {
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(
+			ctx,
+			`INSERT INTO attachments (uuid, thing_uuid, filename, content_type, size, sha256, created)
+			    VALUES (:uuid, :thing_uuid, :filename, :content_type, :size, :sha256, :created)`,
+			attachment,
+		)
+		if isForeignKeyViolation(err) {
+			return db.ErrThingNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (s *service) GetAttachment(ctx context.Context, thingUUID string, uuid string) (db.Attachment, error) {
+	var attachment db.Attachment
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(
+			ctx,
+			&attachment,
+			`SELECT `+attachmentColumns+` FROM attachments WHERE thing_uuid = $1 AND uuid = $2`,
+			thingUUID,
+			uuid,
+		)
+	})
+	if err == sql.ErrNoRows {
+		return db.Attachment{}, db.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (s *service) GetAttachments(ctx context.Context, thingUUID string) ([]db.Attachment, error) {
+	var attachments []db.Attachment
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.SelectContext(
+			ctx,
+			&attachments,
+			`SELECT `+attachmentColumns+` FROM attachments WHERE thing_uuid = $1 ORDER BY created, uuid`,
+			thingUUID,
+		)
+		if err != nil || len(attachments) > 0 {
+			return err
+		}
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM things WHERE uuid = $1)`, thingUUID); err != nil {
+			return err
+		}
+		if !exists {
+			return db.ErrThingNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (s *service) DeleteAttachment(ctx context.Context, thingUUID string, uuid string) error {
+	return s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM attachments WHERE thing_uuid = $1 AND uuid = $2`,
+			thingUUID,
+			uuid,
+		)
+		return err
+	})
+}
@@ -3,36 +3,78 @@ package postgresdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
 )
 
 var _ db.Service = (*service)(nil)
 
 type service struct {
-	pg *sqlx.DB
+	pg      *sqlx.DB
+	options db.Options
 }
 
-func NewService(ctx context.Context, host string, port int, user string, pass string, name string) (db.Service, error) {
+func NewService(ctx context.Context, host string, port int, user string, pass string, name string, opts ...db.Option) (db.Service, error) {
 	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, pass, name)
 	pg, err := sqlx.Connect("postgres", psqlInfo)
 	if err != nil {
 		return nil, err
 	}
-	return &service{pg: pg}, nil
+	return &service{pg: pg, options: db.NewOptions(opts...)}, nil
 }
 
+// inTx runs fn in a transaction which is committed when fn succeeds and rolled back otherwise
+func (s *service) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.pg.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// thingColumns selects all columns of things, the nullable parent_uuid as an empty string
+const thingColumns = `uuid, name, value, labels, COALESCE(parent_uuid, '') AS parent_uuid, kind, kind_version, data, owner, acl, updated, created`
+
+// attachmentColumns selects all columns of attachments but their tenant
+const attachmentColumns = `uuid, thing_uuid, filename, content_type, size, sha256, created`
+
+// foreignKeyViolation is the Postgres error code for a violated foreign key constraint
+const foreignKeyViolation = "23503"
+
+// moveLock is the advisory lock serializing moves of things, so concurrent moves cannot create a cycle
+const moveLock = 1
+
 func (s *service) GetThing(ctx context.Context, uuid string) (db.Thing, error) {
 	var thing db.Thing
-	err := s.pg.GetContext(
-		ctx, &thing, `SELECT * FROM things WHERE uuid = $1`, uuid)
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		thing, err = getThing(ctx, tx, uuid)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing, nil
+}
+
+func getThing(ctx context.Context, tx *sqlx.Tx, uuid string) (db.Thing, error) {
+	var thing db.Thing
+	err := tx.GetContext(
+		ctx, &thing, `SELECT `+thingColumns+` FROM things WHERE uuid = $1`, uuid)
 	if err == sql.ErrNoRows {
 		return db.Thing{}, db.ErrThingNotFound
 	}
@@ -42,69 +84,406 @@ func (s *service) GetThing(ctx context.Context, uuid string) (db.Thing, error) {
 	return thing, nil
 }
 
-func (s *service) CreateThing(ctx context.Context, name string, value string) (db.Thing, error) {
+func (s *service) CreateThing(ctx context.Context, input db.ThingInput) (db.Thing, error) {
+	var thing db.Thing
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		thing, err = s.insert(ctx, tx, s.options.NewID(), input)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing, nil
+}
+
+func (s *service) UpdateThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, error) {
+	var thing db.Thing
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		thing, err = s.update(ctx, tx, uuid, input)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing, nil
+}
+
+func (s *service) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	var thing db.Thing
+	var created bool
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if input.Name != "" {
+			thing, err = s.insert(ctx, tx, uuid, input)
+			if err != errAlreadyExists {
+				created = err == nil
+				return err
+			}
+		}
+		thing, err = s.update(ctx, tx, uuid, input)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, false, err
+	}
+	return thing, created, nil
+}
+
+// thingRow is a thing with its readers, which are only written
+type thingRow struct {
+	db.Thing
+	Readers pq.StringArray `db:"readers"`
+}
+
+// errAlreadyExists is returned by insert when a thing with the uuid already exists
+var errAlreadyExists = errors.New("thing already exists")
+
+func (s *service) insert(ctx context.Context, tx *sqlx.Tx, uuid string, input db.ThingInput) (db.Thing, error) {
 	now := time.Now().UTC()
+	if input.Labels == nil {
+		input.Labels = db.Labels{}
+	}
 	thing := db.Thing{
-		UUID:    uuid.New().String(),
-		Name:    name,
-		Value:   value,
-		Updated: now,
-		Created: now,
+		UUID:        uuid,
+		Name:        input.Name,
+		Value:       input.Value,
+		Labels:      input.Labels,
+		Kind:        input.Kind,
+		KindVersion: input.KindVersion,
+		Data:        input.Data,
+		Owner:       input.Owner,
+		ACL:         db.ACL{},
+		Updated:     now,
+		Created:     now,
 	}
-	_, err := s.pg.NamedExecContext(
-		ctx,
-		`INSERT INTO things (uuid, name, value, updated, created) 
-		    VALUES (:uuid, :name, :value, :updated, :created)`,
-		thing,
+	if input.ParentUUID != nil {
+		thing.ParentUUID = *input.ParentUUID
+	}
+	query, args, err := sqlx.Named(
+		`INSERT INTO things (uuid, name, value, labels, parent_uuid, kind, kind_version, data, owner, acl, readers, updated, created) 
+		    VALUES (:uuid, :name, :value, :labels, NULLIF(:parent_uuid, ''), :kind, :kind_version, :data, :owner, :acl, :readers, :updated, :created)
+		    ON CONFLICT (tenant, uuid) DO NOTHING`,
+		thingRow{Thing: thing, Readers: thing.Readers()},
 	)
 	if err != nil {
 		return db.Thing{}, err
 	}
+	result, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+	if isForeignKeyViolation(err) {
+		return db.Thing{}, db.ErrParentNotFound
+	}
+	if err != nil {
+		return db.Thing{}, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return db.Thing{}, err
+	} else if inserted == 0 {
+		return db.Thing{}, errAlreadyExists
+	}
 	return thing, nil
 }
 
-func (s *service) UpdateThing(ctx context.Context, uuid string, value string) (db.Thing, error) {
-	_, err := s.pg.ExecContext(
+func (s *service) update(ctx context.Context, tx *sqlx.Tx, uuid string, input db.ThingInput) (db.Thing, error) {
+	if input.ParentUUID != nil {
+		if err := s.move(ctx, tx, uuid, *input.ParentUUID); err != nil {
+			return db.Thing{}, err
+		}
+	}
+
+	var thing db.Thing
+	err := tx.GetContext(
 		ctx,
-		`UPDATE things SET value = $1 WHERE uuid = $2`,
-		value,
+		&thing,
+		`UPDATE things SET
+		    name = COALESCE(NULLIF($1, ''), name),
+		    value = $2,
+		    data = $3,
+		    kind_version = COALESCE(NULLIF($4, 0), kind_version),
+		    labels = COALESCE($5::jsonb, labels),
+		    updated = $6
+		    WHERE uuid = $7 RETURNING `+thingColumns,
+		input.Name,
+		input.Value,
+		input.Data,
+		input.KindVersion,
+		optionalLabels(input.Labels),
+		time.Now().UTC(),
 		uuid,
 	)
+	if err == sql.ErrNoRows {
+		return db.Thing{}, db.ErrThingNotFound
+	}
 	if err != nil {
 		return db.Thing{}, err
 	}
-	return s.GetThing(ctx, uuid)
+	return thing, nil
 }
 
-func (s *service) DeleteThing(ctx context.Context, uuid string) error {
-	_, err := s.pg.ExecContext(
-		ctx,
-		`DELETE FROM things WHERE uuid = $1`,
-		uuid,
-	)
+// move changes the parent of a thing, a thing cannot be moved below itself or one of its descendants
+func (s *service) move(ctx context.Context, tx *sqlx.Tx, uuid string, parentUUID string) error {
+	if parentUUID != "" {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, moveLock); err != nil {
+			return err
+		}
+
+		var cycle bool
+		err := tx.GetContext(
+			ctx,
+			&cycle,
+			`WITH RECURSIVE ancestors AS (
+			        SELECT uuid, parent_uuid FROM things WHERE uuid = $1
+			    UNION
+			        SELECT t.uuid, t.parent_uuid FROM things t JOIN ancestors a ON t.uuid = a.parent_uuid
+			    )
+			    SELECT EXISTS(SELECT 1 FROM ancestors WHERE uuid = $2)`,
+			parentUUID,
+			uuid,
+		)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return db.ErrCycle
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE things SET parent_uuid = NULLIF($1, '') WHERE uuid = $2`, parentUUID, uuid)
+	if isForeignKeyViolation(err) {
+		return db.ErrParentNotFound
+	}
 	return err
 }
 
-func (s *service) GetThings(ctx context.Context, offset int, limit int) ([]db.Thing, int, error) {
+func (s *service) DeleteThing(ctx context.Context, uuid string, policy db.DeletePolicy) ([]db.Attachment, error) {
+	var attachments []db.Attachment
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		if policy == db.Restrict {
+			var hasChildren bool
+			err := tx.GetContext(ctx, &hasChildren, `SELECT EXISTS(SELECT 1 FROM things WHERE parent_uuid = $1)`, uuid)
+			if err != nil {
+				return err
+			}
+			if hasChildren {
+				return db.ErrThingHasChildren
+			}
+		}
+
+		const descendants = `WITH RECURSIVE descendants AS (
+		        SELECT uuid FROM things WHERE uuid = $1
+		    UNION
+		        SELECT t.uuid FROM things t JOIN descendants d ON t.parent_uuid = d.uuid
+		    )`
+		err := tx.SelectContext(
+			ctx,
+			&attachments,
+			descendants+` SELECT `+attachmentColumns+` FROM attachments WHERE thing_uuid IN (SELECT uuid FROM descendants)`,
+			uuid,
+		)
+		if err != nil {
+			return err
+		}
+		// the attachments are deleted by their foreign key
+		result, err := tx.ExecContext(
+			ctx,
+			descendants+` DELETE FROM things WHERE uuid IN (SELECT uuid FROM descendants)`,
+			uuid,
+		)
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return db.ErrThingNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (s *service) GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, viewer *db.Viewer) ([]db.Thing, int, error) {
+	where, args := selectorToSQL(selector)
+	if viewer != nil {
+		args = append(args, pq.Array(viewer.Subjects()))
+		where = andWhere(where, fmt.Sprintf("readers && $%d", len(args)))
+	}
+
+	return s.selectThings(ctx, where, args, offset, limit)
+}
+
+// selectThings selects a page of the things of the tenant matching where, and counts all of them
+func (s *service) selectThings(ctx context.Context, where string, args []interface{}, offset int, limit int) ([]db.Thing, int, error) {
 	var things []db.Thing
-	err := s.pg.SelectContext(
-		ctx,
-		&things,
-		`SELECT * FROM things OFFSET $1 LIMIT $2`,
-		offset,
-		limit,
-	)
+	var count int
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.SelectContext(
+			ctx,
+			&things,
+			fmt.Sprintf(`SELECT `+thingColumns+` FROM things %s ORDER BY uuid OFFSET $%d LIMIT $%d`, where, len(args)+1, len(args)+2),
+			append(args, offset, limit)...,
+		)
+		if err != nil {
+			return err
+		}
+		return tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM things `+where, args...)
+	})
 	if err != nil {
 		return nil, 0, err
 	}
-	row := s.pg.QueryRowContext(
-		ctx,
-		`SELECT COUNT(*) as count FROM things`,
-	)
+	return things, count, nil
+}
+
+func (s *service) CountThings(ctx context.Context, owner string) (int, error) {
 	var count int
-	err = row.Scan(&count)
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &count, `SELECT count(*) FROM things WHERE owner = $1`, owner)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *service) GetThingsByUUID(ctx context.Context, uuids []string) ([]db.Thing, error) {
+	var things []db.Thing
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(
+			ctx,
+			&things,
+			`SELECT `+thingColumns+` FROM things WHERE uuid = ANY($1)`,
+			pq.Array(uuids),
+		)
+	})
 	if err != nil {
+		return nil, err
+	}
+	return things, nil
+}
+
+func (s *service) GetChildren(ctx context.Context, uuid string, offset int, limit int, viewer *db.Viewer) ([]db.Thing, int, error) {
+	if _, err := s.GetThing(ctx, uuid); err != nil {
 		return nil, 0, err
 	}
-	return things, count, nil
+
+	where, args := `WHERE parent_uuid = $1`, []interface{}{uuid}
+	if viewer != nil {
+		args = append(args, pq.Array(viewer.Subjects()))
+		where = andWhere(where, `readers && $2`)
+	}
+	return s.selectThings(ctx, where, args, offset, limit)
+}
+
+func (s *service) GetAncestors(ctx context.Context, uuid string) ([]db.Thing, error) {
+	var things []db.Thing
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(
+			ctx,
+			&things,
+			`WITH RECURSIVE ancestors AS (
+			        SELECT *, 0 AS depth FROM things WHERE uuid = $1
+			    UNION ALL
+			        SELECT t.*, a.depth + 1 FROM things t JOIN ancestors a ON t.uuid = a.parent_uuid
+			    )
+			    SELECT `+thingColumns+` FROM ancestors ORDER BY depth DESC`,
+			uuid,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(things) == 0 {
+		return nil, db.ErrThingNotFound
+	}
+	// the last thing is the thing itself
+	return things[:len(things)-1], nil
+}
+
+func (s *service) SetThingACL(ctx context.Context, uuid string, acl db.ACL) (db.Thing, error) {
+	if err := acl.Validate(); err != nil {
+		return db.Thing{}, err
+	}
+	var thing db.Thing
+	err := s.tenantTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(
+			ctx,
+			&thing,
+			`UPDATE things SET acl = $1, updated = $2 WHERE uuid = $3 RETURNING `+thingColumns,
+			acl,
+			time.Now().UTC(),
+			uuid,
+		)
+		if err == sql.ErrNoRows {
+			return db.ErrThingNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE things SET readers = $1 WHERE uuid = $2`, pq.Array(thing.Readers()), uuid)
+		return err
+	})
+	if err != nil {
+		return db.Thing{}, err
+	}
+	return thing, nil
+}
+
+// andWhere adds condition to a WHERE clause, which may be empty
+func andWhere(where string, condition string) string {
+	if where == "" {
+		return "WHERE " + condition
+	}
+	return where + " AND " + condition
+}
+
+func isForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == foreignKeyViolation
+}
+
+// optionalLabels turns nil labels into NULL, so they can be kept with COALESCE
+func optionalLabels(labels db.Labels) interface{} {
+	if labels == nil {
+		return nil
+	}
+	return labels
+}
+
+// selectorToSQL translates a label selector into a WHERE clause on the labels column,
+// equality and existence checks use operators supported by the GIN index
+func selectorToSQL(selector labels.Selector) (string, []interface{}) {
+	if selector.Empty() {
+		return "", nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	for _, r := range selector {
+		switch r.Operator {
+		case labels.Equals:
+			conditions = append(conditions, fmt.Sprintf("labels @> %s::jsonb", arg(db.Labels{r.Key: r.Values[0]})))
+		case labels.NotEquals:
+			conditions = append(conditions, fmt.Sprintf("NOT labels @> %s::jsonb", arg(db.Labels{r.Key: r.Values[0]})))
+		case labels.In:
+			conditions = append(conditions, fmt.Sprintf("labels ->> %s = ANY(%s)", arg(r.Key), arg(pq.Array(r.Values))))
+		case labels.NotIn:
+			conditions = append(conditions, fmt.Sprintf("COALESCE(labels ->> %s <> ALL(%s), true)", arg(r.Key), arg(pq.Array(r.Values))))
+		case labels.Exists:
+			conditions = append(conditions, fmt.Sprintf("labels ? %s", arg(r.Key)))
+		case labels.DoesNotExist:
+			conditions = append(conditions, fmt.Sprintf("NOT labels ? %s", arg(r.Key)))
+		}
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
 }
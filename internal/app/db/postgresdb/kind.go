@@ -0,0 +1,143 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+const selectKinds = `SELECT k.name, k.description, k.version, s.schema, k.updated, k.created
+    FROM kinds k JOIN kind_schemas s ON s.kind = k.name AND s.version = k.version`
+
+func (s *service) GetKind(ctx context.Context, name string) (db.Kind, error) {
+	var kind db.Kind
+	err := s.pg.GetContext(ctx, &kind, selectKinds+` WHERE k.name = $1`, name)
+	if err == sql.ErrNoRows {
+		return db.Kind{}, db.ErrKindNotFound
+	}
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return kind, nil
+}
+
+func (s *service) GetKinds(ctx context.Context) ([]db.Kind, error) {
+	var kinds []db.Kind
+	err := s.pg.SelectContext(ctx, &kinds, selectKinds+` ORDER BY k.name`)
+	if err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+func (s *service) CreateKind(ctx context.Context, name string, description string, schema db.JSON) (db.Kind, error) {
+	now := time.Now().UTC()
+	kind := db.Kind{
+		Name:        name,
+		Description: description,
+		Version:     1,
+		Schema:      schema,
+		Updated:     now,
+		Created:     now,
+	}
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO kinds (name, description, version, updated, created)
+			    VALUES ($1, $2, $3, $4, $4) ON CONFLICT (name) DO NOTHING`,
+			kind.Name,
+			kind.Description,
+			kind.Version,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		if inserted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if inserted == 0 {
+			return db.ErrKindAlreadyExists
+		}
+		return insertKindSchema(ctx, tx, name, kind.Version, schema, now)
+	})
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return kind, nil
+}
+
+func (s *service) AddKindSchema(ctx context.Context, name string, schema db.JSON) (db.Kind, error) {
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+
+		var version int
+		err := tx.GetContext(
+			ctx,
+			&version,
+			`UPDATE kinds SET version = version + 1, updated = $1 WHERE name = $2 RETURNING version`,
+			now,
+			name,
+		)
+		if err == sql.ErrNoRows {
+			return db.ErrKindNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return insertKindSchema(ctx, tx, name, version, schema, now)
+	})
+	if err != nil {
+		return db.Kind{}, err
+	}
+	return s.GetKind(ctx, name)
+}
+
+func (s *service) GetKindSchemas(ctx context.Context, name string) ([]db.KindSchema, error) {
+	var schemas []db.KindSchema
+	err := s.pg.SelectContext(
+		ctx,
+		&schemas,
+		`SELECT * FROM kind_schemas WHERE kind = $1 ORDER BY version`,
+		name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// every kind has at least one schema
+	if len(schemas) == 0 {
+		return nil, db.ErrKindNotFound
+	}
+	return schemas, nil
+}
+
+func (s *service) DeleteKind(ctx context.Context, name string) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var inUse bool
+		// outside of a tenant transaction the things of all tenants are checked
+		err := tx.GetContext(ctx, &inUse, `SELECT EXISTS(SELECT 1 FROM things WHERE kind = $1)`, name)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return db.ErrKindInUse
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM kinds WHERE name = $1`, name)
+		return err
+	})
+}
+
+func insertKindSchema(ctx context.Context, tx *sqlx.Tx, name string, version int, schema db.JSON, now time.Time) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO kind_schemas (kind, version, schema, created) VALUES ($1, $2, $3, $4)`,
+		name,
+		version,
+		schema,
+		now,
+	)
+	return err
+}
@@ -0,0 +1,7 @@
+package postgresdb
+
+import "context"
+
+func (s *service) Ping(ctx context.Context) error {
+	return s.pg.PingContext(ctx)
+}
@@ -0,0 +1,28 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+// UseShareLink counts the use in a single statement, the update is skipped once the link is used up.
+// The uses of expired links are deleted in the same statement.
+func (s *service) UseShareLink(ctx context.Context, id string, maxUses int, expires time.Time) error {
+	var uses int
+	err := s.pg.GetContext(
+		ctx,
+		&uses,
+		`WITH expired AS (DELETE FROM share_link_uses WHERE expires < $4)
+		INSERT INTO share_link_uses (id, uses, expires) VALUES ($1, 1, $2)
+		    ON CONFLICT (id) DO UPDATE SET uses = share_link_uses.uses + 1 WHERE share_link_uses.uses < $3
+		    RETURNING uses`,
+		id, expires.UTC(), maxUses, time.Now().UTC(),
+	)
+	if err == sql.ErrNoRows {
+		return db.ErrShareLinkUsedUp
+	}
+	return err
+}
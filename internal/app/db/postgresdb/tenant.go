@@ -0,0 +1,23 @@
+package postgresdb
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+// tenantTx runs fn in a transaction like inTx, with row level security restricting it to the things
+// and attachments of the tenant of ctx
+func (s *service) tenantTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SET LOCAL ROLE things_tenant`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant', $1, true)`, tenant.FromContext(ctx)); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
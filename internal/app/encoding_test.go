@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestEncodings(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithOpenAPIValidation(true))
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/thing/new", strings.NewReader("name: name\nvalue: value\nlabels:\n  env: test\n"))
+	r.Header.Set("Content-Type", "application/yaml")
+	r.Header.Set("Accept", "application/yaml")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "name: name\n")
+	if assert.Len(t, fake.things, 1) {
+		assert.Equal(t, db.Labels{"env": "test"}, fake.things[0].Labels)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/thing", nil)
+	r.Header.Set("Accept", "text/csv")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "uuid,"), w.Body.String())
+	assert.Contains(t, w.Body.String(), fake.things[0].UUID+",")
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/thing/"+fake.things[0].UUID, nil)
+	r.Header.Set("Accept", "text/csv")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/thing/new", strings.NewReader("name,value\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Len(t, fake.things, 1)
+}
+
+func TestStrictBodies(t *testing.T) {
+	for _, validate := range []bool{false, true} {
+		opts := []Option{WithMaxBodySize(64)}
+		if validate {
+			opts = append(opts, WithOpenAPIValidation(false))
+		}
+		fake := &fakeDB{}
+		s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, opts...)
+		assert.NoError(t, err)
+
+		tests := []struct {
+			contentType string
+			body        string
+			chunked     bool
+			code        int
+		}{
+			{contentType: "application/json", body: `{"name": "name", "value": "value"}`, code: http.StatusOK},
+			{contentType: "", body: `{"name": "name", "value": "value"}`, code: http.StatusUnsupportedMediaType},
+			{contentType: "application/json", body: `{"name": "name", "value": "value", "colour": "red"}`, code: http.StatusBadRequest},
+			{contentType: "application/json", body: `{"name": "name", "value": "value"} []`, code: http.StatusBadRequest},
+			{contentType: "application/json", body: `{"name": "name", "value": "` + strings.Repeat("a", 64) + `"}`, code: http.StatusRequestEntityTooLarge},
+			{contentType: "application/json", body: `{"name": "name", "value": "` + strings.Repeat("a", 64) + `"}`, chunked: true, code: http.StatusRequestEntityTooLarge},
+		}
+		for _, test := range tests {
+			r := httptest.NewRequest(http.MethodPost, "/v1/thing/new", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			if test.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, r)
+			assert.Equal(t, test.code, w.Code, "%t %s: %s", validate, test.body, w.Body.String())
+		}
+		assert.Len(t, fake.things, 1)
+	}
+}
@@ -0,0 +1,413 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+// fakeDB implements the parts of db.Service used by the tests, other methods panic
+type fakeDB struct {
+	db.Service
+	things  []db.Thing
+	apiKeys []db.APIKey
+	trace   string
+	// span is the span context of the last GetThing
+	span    trace.SpanContext
+	tenant  string
+	lookups int
+	// kindSchemas are all schema versions of all kinds, oldest first
+	kindSchemas []db.KindSchema
+	kinds       []db.Kind
+	attachments []db.Attachment
+	// linkUses counts the uses of share links
+	linkUses map[string]int
+	// pingErr is returned by Ping
+	pingErr error
+}
+
+func (f *fakeDB) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeDB) GetThingsByUUID(ctx context.Context, uuids []string) ([]db.Thing, error) {
+	f.lookups++
+	var things []db.Thing
+	for _, uuid := range uuids {
+		for _, thing := range f.things {
+			if thing.UUID == uuid {
+				things = append(things, thing)
+			}
+		}
+	}
+	return things, nil
+}
+
+func (f *fakeDB) GetThing(ctx context.Context, uuid string) (db.Thing, error) {
+	f.trace, _ = ctx.Value(log.CloudTraceContextKey).(string)
+	f.span = trace.SpanContextFromContext(ctx)
+	f.tenant = tenant.FromContext(ctx)
+	for _, thing := range f.things {
+		if thing.UUID == uuid {
+			return thing, nil
+		}
+	}
+	return db.Thing{}, db.ErrThingNotFound
+}
+
+func (f *fakeDB) GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, viewer *db.Viewer) ([]db.Thing, int, error) {
+	things := f.things
+	if viewer != nil {
+		things = nil
+		for _, thing := range f.things {
+			if viewer.CanRead(thing) {
+				things = append(things, thing)
+			}
+		}
+	}
+	if offset > len(things) {
+		offset = len(things)
+	}
+	end := offset + limit
+	if end > len(things) {
+		end = len(things)
+	}
+	return things[offset:end], len(things), nil
+}
+
+func (f *fakeDB) CreateThing(ctx context.Context, input db.ThingInput) (db.Thing, error) {
+	now := time.Now()
+	thing := db.Thing{
+		UUID:        db.RandomID(),
+		Kind:        input.Kind,
+		KindVersion: input.KindVersion,
+		Name:        input.Name,
+		Value:       input.Value,
+		Data:        input.Data,
+		Labels:      input.Labels,
+		Owner:       input.Owner,
+		Updated:     now,
+		Created:     now,
+	}
+	if input.ParentUUID != nil && *input.ParentUUID != "" {
+		if _, err := f.GetThing(ctx, *input.ParentUUID); err != nil {
+			return db.Thing{}, db.ErrParentNotFound
+		}
+		thing.ParentUUID = *input.ParentUUID
+	}
+	f.things = append(f.things, thing)
+	return thing, nil
+}
+
+// UpsertThing updates the value and data of an existing thing, keeping its name when empty and its labels
+// when nil, or creates the thing when input has a name
+func (f *fakeDB) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	now := time.Now()
+	for i, thing := range f.things {
+		if thing.UUID == uuid {
+			if input.ParentUUID != nil {
+				if err := f.move(ctx, uuid, *input.ParentUUID); err != nil {
+					return db.Thing{}, false, err
+				}
+			}
+			f.things[i].Value = input.Value
+			f.things[i].Data = input.Data
+			if input.Name != "" {
+				f.things[i].Name = input.Name
+			}
+			if input.Labels != nil {
+				f.things[i].Labels = input.Labels
+			}
+			if input.ParentUUID != nil {
+				f.things[i].ParentUUID = *input.ParentUUID
+			}
+			f.things[i].Updated = now
+			return f.things[i], false, nil
+		}
+	}
+	if input.Name == "" {
+		return db.Thing{}, false, db.ErrThingNotFound
+	}
+	thing := db.Thing{
+		UUID:        uuid,
+		Kind:        input.Kind,
+		KindVersion: input.KindVersion,
+		Name:        input.Name,
+		Value:       input.Value,
+		Data:        input.Data,
+		Labels:      input.Labels,
+		Owner:       input.Owner,
+		Updated:     now,
+		Created:     now,
+	}
+	if input.ParentUUID != nil {
+		thing.ParentUUID = *input.ParentUUID
+	}
+	f.things = append(f.things, thing)
+	return thing, true, nil
+}
+
+// move checks that the thing with uuid can be moved below parentUUID
+func (f *fakeDB) move(ctx context.Context, uuid string, parentUUID string) error {
+	if parentUUID == "" {
+		return nil
+	}
+	if _, err := f.GetThing(ctx, parentUUID); err != nil {
+		return db.ErrParentNotFound
+	}
+	ancestors, err := f.GetAncestors(ctx, parentUUID)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range append(ancestors, db.Thing{UUID: parentUUID}) {
+		if ancestor.UUID == uuid {
+			return db.ErrCycle
+		}
+	}
+	return nil
+}
+
+// GetChildren returns the children ordered by UUID, like the real backends
+func (f *fakeDB) GetChildren(ctx context.Context, uuid string, offset int, limit int, viewer *db.Viewer) ([]db.Thing, int, error) {
+	if _, err := f.GetThing(ctx, uuid); err != nil {
+		return nil, 0, err
+	}
+	var children []db.Thing
+	for _, thing := range f.things {
+		if thing.ParentUUID == uuid && (viewer == nil || viewer.CanRead(thing)) {
+			children = append(children, thing)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].UUID < children[j].UUID })
+	if offset > len(children) {
+		offset = len(children)
+	}
+	end := offset + limit
+	if end > len(children) {
+		end = len(children)
+	}
+	return children[offset:end], len(children), nil
+}
+
+func (f *fakeDB) SetThingACL(ctx context.Context, uuid string, acl db.ACL) (db.Thing, error) {
+	if err := acl.Validate(); err != nil {
+		return db.Thing{}, err
+	}
+	for i, thing := range f.things {
+		if thing.UUID == uuid {
+			f.things[i].ACL = acl
+			return f.things[i], nil
+		}
+	}
+	return db.Thing{}, db.ErrThingNotFound
+}
+
+func (f *fakeDB) CountThings(ctx context.Context, owner string) (int, error) {
+	count := 0
+	for _, thing := range f.things {
+		if thing.Owner == owner {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeDB) UseShareLink(ctx context.Context, id string, maxUses int, expires time.Time) error {
+	if f.linkUses == nil {
+		f.linkUses = map[string]int{}
+	}
+	if f.linkUses[id] >= maxUses {
+		return db.ErrShareLinkUsedUp
+	}
+	f.linkUses[id]++
+	return nil
+}
+
+func (f *fakeDB) GetAncestors(ctx context.Context, uuid string) ([]db.Thing, error) {
+	thing, err := f.GetThing(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	var ancestors []db.Thing
+	for thing.ParentUUID != "" {
+		if thing, err = f.GetThing(ctx, thing.ParentUUID); err != nil {
+			return nil, err
+		}
+		ancestors = append([]db.Thing{thing}, ancestors...)
+	}
+	return ancestors, nil
+}
+
+func (f *fakeDB) DeleteThing(ctx context.Context, uuid string, policy db.DeletePolicy) ([]db.Attachment, error) {
+	if policy == db.Restrict {
+		for _, thing := range f.things {
+			if thing.ParentUUID == uuid {
+				return nil, db.ErrThingHasChildren
+			}
+		}
+	}
+	for i, thing := range f.things {
+		if thing.UUID == uuid {
+			f.things = append(f.things[:i], f.things[i+1:]...)
+			return nil, nil
+		}
+	}
+	return nil, db.ErrThingNotFound
+}
+
+func (f *fakeDB) GetKind(ctx context.Context, name string) (db.Kind, error) {
+	for _, kind := range f.kinds {
+		if kind.Name == name {
+			return kind, nil
+		}
+	}
+	return db.Kind{}, db.ErrKindNotFound
+}
+
+func (f *fakeDB) GetKinds(ctx context.Context) ([]db.Kind, error) {
+	return f.kinds, nil
+}
+
+func (f *fakeDB) CreateKind(ctx context.Context, name string, description string, schema db.JSON) (db.Kind, error) {
+	if _, err := f.GetKind(ctx, name); err == nil {
+		return db.Kind{}, db.ErrKindAlreadyExists
+	}
+	now := time.Now()
+	kind := db.Kind{Name: name, Description: description, Version: 1, Schema: schema, Updated: now, Created: now}
+	f.kinds = append(f.kinds, kind)
+	f.kindSchemas = append(f.kindSchemas, db.KindSchema{Kind: name, Version: 1, Schema: schema, Created: now})
+	return kind, nil
+}
+
+func (f *fakeDB) AddKindSchema(ctx context.Context, name string, schema db.JSON) (db.Kind, error) {
+	for i, kind := range f.kinds {
+		if kind.Name == name {
+			now := time.Now()
+			f.kinds[i].Version++
+			f.kinds[i].Schema = schema
+			f.kinds[i].Updated = now
+			f.kindSchemas = append(f.kindSchemas, db.KindSchema{Kind: name, Version: f.kinds[i].Version, Schema: schema, Created: now})
+			return f.kinds[i], nil
+		}
+	}
+	return db.Kind{}, db.ErrKindNotFound
+}
+
+func (f *fakeDB) GetKindSchemas(ctx context.Context, name string) ([]db.KindSchema, error) {
+	if _, err := f.GetKind(ctx, name); err != nil {
+		return nil, err
+	}
+	var schemas []db.KindSchema
+	for _, schema := range f.kindSchemas {
+		if schema.Kind == name {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas, nil
+}
+
+func (f *fakeDB) DeleteKind(ctx context.Context, name string) error {
+	for _, thing := range f.things {
+		if thing.Kind == name {
+			return db.ErrKindInUse
+		}
+	}
+	for i, kind := range f.kinds {
+		if kind.Name == name {
+			f.kinds = append(f.kinds[:i], f.kinds[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (f *fakeDB) CreateAttachment(ctx context.Context, attachment db.Attachment) (db.Attachment, error) {
+	if _, err := f.GetThing(ctx, attachment.ThingUUID); err != nil {
+		return db.Attachment{}, err
+	}
+	f.attachments = append(f.attachments, attachment)
+	return attachment, nil
+}
+
+func (f *fakeDB) GetAttachment(ctx context.Context, thingUUID string, uuid string) (db.Attachment, error) {
+	for _, attachment := range f.attachments {
+		if attachment.ThingUUID == thingUUID && attachment.UUID == uuid {
+			return attachment, nil
+		}
+	}
+	return db.Attachment{}, db.ErrAttachmentNotFound
+}
+
+func (f *fakeDB) GetAttachments(ctx context.Context, thingUUID string) ([]db.Attachment, error) {
+	var attachments []db.Attachment
+	for _, attachment := range f.attachments {
+		if attachment.ThingUUID == thingUUID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	if _, err := f.GetThing(ctx, thingUUID); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// DeleteAttachment deletes nothing when the attachment does not exist, like the real backends
+func (f *fakeDB) DeleteAttachment(ctx context.Context, thingUUID string, uuid string) error {
+	for i, attachment := range f.attachments {
+		if attachment.ThingUUID == thingUUID && attachment.UUID == uuid {
+			f.attachments = append(f.attachments[:i], f.attachments[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeDB) CreateAPIKey(ctx context.Context, key db.APIKey) (db.APIKey, error) {
+	now := time.Now()
+	key.Updated = now
+	key.Created = now
+	f.apiKeys = append(f.apiKeys, key)
+	return key, nil
+}
+
+func (f *fakeDB) GetAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	for _, key := range f.apiKeys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return db.APIKey{}, db.ErrAPIKeyNotFound
+}
+
+func (f *fakeDB) GetAPIKeys(ctx context.Context) ([]db.APIKey, error) {
+	return f.apiKeys, nil
+}
+
+func (f *fakeDB) RotateAPIKey(ctx context.Context, id string, hash string) (db.APIKey, error) {
+	for i, key := range f.apiKeys {
+		if key.ID == id {
+			if key.Revoked {
+				return db.APIKey{}, db.ErrAPIKeyRevoked
+			}
+			f.apiKeys[i].Hash = hash
+			return f.apiKeys[i], nil
+		}
+	}
+	return db.APIKey{}, db.ErrAPIKeyNotFound
+}
+
+func (f *fakeDB) RevokeAPIKey(ctx context.Context, id string) (db.APIKey, error) {
+	for i, key := range f.apiKeys {
+		if key.ID == id {
+			f.apiKeys[i].Revoked = true
+			return f.apiKeys[i], nil
+		}
+	}
+	return db.APIKey{}, db.ErrAPIKeyNotFound
+}
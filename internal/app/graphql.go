@@ -0,0 +1,569 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+)
+
+var errBatchTooLarge = fmt.Errorf("at most %d requests can be batched", maxBatchSize)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL godoc
+// @Summary GraphQL endpoint
+// @Description Query and mutate things with GraphQL, a JSON array of at most 10 requests is executed as a batch.
+// @Description Queries are limited in depth and complexity, the complexity of a paginated field is multiplied by its limit.
+// @ID graphql
+// @Tags GraphQL
+// @Param Body body GraphQLRequest true "The GraphQL request"
+// @Success 200 {object} object
+// @Failure 400,401,403,413,415 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /graphql [post]
+func (s *Server) GraphQL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var body json.RawMessage
+	if err := httpx.Decode(r, &body); err != nil {
+		abortInvalidBody(w, r, err)
+		return
+	}
+
+	// lookups are batched across all requests of a batch
+	ctx = withThingLoader(ctx, newThingLoader(s.db))
+
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		var requests []GraphQLRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			httpx.AbortJSON(w, r, http.StatusBadRequest, errors.New("invalid json body"))
+			return
+		}
+		if len(requests) > maxBatchSize {
+			httpx.AbortJSON(w, r, http.StatusBadRequest, errBatchTooLarge)
+			return
+		}
+		results := make([]*graphql.Result, len(requests))
+		for i, request := range requests {
+			results[i] = s.executeGraphQL(ctx, request)
+		}
+		httpx.JSON(w, r, results)
+		return
+	}
+
+	var request GraphQLRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, errors.New("invalid json body"))
+		return
+	}
+	httpx.JSON(w, r, s.executeGraphQL(ctx, request))
+}
+
+// executeGraphQL parses, validates and checks the limits of a request before executing it
+func (s *Server) executeGraphQL(ctx context.Context, request GraphQLRequest) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	validation := graphql.ValidateDocument(&s.graphql, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+
+	if err := checkQueryLimits(&s.graphql, document, request.OperationName, request.Variables); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.graphql,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	})
+}
+
+// graphQLError adds a code and the invalid fields to the extensions of a GraphQL error
+type graphQLError struct {
+	message string
+	code    string
+	fields  []httpx.FieldError
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+func (e *graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		extensions["fields"] = e.fields
+	}
+	return extensions
+}
+
+// graphQLErr converts an error into a graphQLError with a code matching the status code of the REST API,
+// internal errors are logged
+func (s *Server) graphQLErr(ctx context.Context, err error) error {
+	var validationErr *httpx.ValidationError
+	switch {
+	case err == db.ErrThingNotFound:
+		return &graphQLError{message: err.Error(), code: "NOT_FOUND"}
+	case err == db.ErrParentNotFound, err == db.ErrCycle, err == db.ErrInvalidGrant, err == db.ErrTooManyThings, err == errInvalidUUID, err == errKindChanged,
+		errors.Is(err, labels.ErrInvalidSelector):
+		return &graphQLError{message: err.Error(), code: "BAD_REQUEST"}
+	case errors.As(err, &validationErr):
+		return &graphQLError{message: err.Error(), code: "BAD_REQUEST", fields: validationErr.Fields}
+	case err == db.ErrThingHasChildren:
+		return &graphQLError{message: err.Error(), code: "CONFLICT"}
+	case errors.Is(err, auth.ErrInsufficientScope), err == errForbidden:
+		return &graphQLError{message: err.Error(), code: "FORBIDDEN"}
+	case err == errQuotaExceeded:
+		return &graphQLError{message: err.Error(), code: "QUOTA_EXCEEDED"}
+	}
+	s.log.Error(ctx, err)
+	return &graphQLError{message: "internal error", code: "INTERNAL"}
+}
+
+// jsonScalar is an arbitrary JSON value
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "An arbitrary JSON value",
+	Serialize: func(value interface{}) interface{} {
+		data, ok := value.(db.JSON)
+		if !ok || data == nil {
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil
+		}
+		return v
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: literalValue,
+})
+
+// literalValue converts a literal in a query into the value it represents
+func literalValue(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.ObjectValue:
+		m := map[string]interface{}{}
+		for _, field := range value.Fields {
+			m[field.Name.Value] = literalValue(field.Value)
+		}
+		return m
+	case *ast.ListValue:
+		l := []interface{}{}
+		for _, v := range value.Values {
+			l = append(l, literalValue(v))
+		}
+		return l
+	case *ast.IntValue:
+		return json.Number(value.Value)
+	case *ast.FloatValue:
+		return json.Number(value.Value)
+	case *ast.StringValue:
+		return value.Value
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.EnumValue:
+		return value.Value
+	}
+	return nil
+}
+
+func (s *Server) newGraphQLSchema() (graphql.Schema, error) {
+	labelType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Label",
+		Fields: graphql.Fields{
+			"key":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	labelInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "LabelInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"key":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"value": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	var thingType, thingPageType *graphql.Object
+	thingType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Thing",
+		Fields: (graphql.FieldsThunk)(func() graphql.Fields {
+			return graphql.Fields{
+				"uuid":  thingField(graphql.NewNonNull(graphql.ID), func(t db.Thing) interface{} { return t.UUID }),
+				"name":  thingField(graphql.NewNonNull(graphql.String), func(t db.Thing) interface{} { return t.Name }),
+				"value": thingField(graphql.NewNonNull(graphql.String), func(t db.Thing) interface{} { return t.Value }),
+				"labels": thingField(
+					graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(labelType))),
+					func(t db.Thing) interface{} { return labelsToList(t.Labels) },
+				),
+				"kind": thingField(graphql.String, func(t db.Thing) interface{} {
+					if t.Kind == "" {
+						return nil
+					}
+					return t.Kind
+				}),
+				"kindVersion": thingField(graphql.Int, func(t db.Thing) interface{} {
+					if t.Kind == "" {
+						return nil
+					}
+					return t.KindVersion
+				}),
+				"data": thingField(jsonScalar, func(t db.Thing) interface{} { return t.Data }),
+				"owner": thingField(graphql.String, func(t db.Thing) interface{} {
+					if t.Owner == "" {
+						return nil
+					}
+					return t.Owner
+				}),
+				"updated": thingField(graphql.NewNonNull(graphql.DateTime), func(t db.Thing) interface{} { return t.Updated }),
+				"created": thingField(graphql.NewNonNull(graphql.DateTime), func(t db.Thing) interface{} { return t.Created }),
+				"parent": &graphql.Field{
+					Type: thingType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						thing := p.Source.(db.Thing)
+						if thing.ParentUUID == "" {
+							return nil, nil
+						}
+						return thingLoaderFromContext(p.Context).load(p.Context, thing.ParentUUID), nil
+					},
+				},
+				"children": &graphql.Field{
+					Type: graphql.NewNonNull(thingPageType),
+					Args: paginationArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						page, limit := paginationFromArgs(p.Args)
+						things, count, err := s.db.GetChildren(p.Context, p.Source.(db.Thing).UUID, (page-1)*limit, limit, nil)
+						if err != nil {
+							return nil, s.graphQLErr(p.Context, err)
+						}
+						thingLoaderFromContext(p.Context).prime(things...)
+						return newThingPage(things, page, limit, count), nil
+					},
+				},
+				"ancestors": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(thingType))),
+					Description: "The ancestors of the thing, starting at the root",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						things, err := s.db.GetAncestors(p.Context, p.Source.(db.Thing).UUID)
+						if err != nil {
+							return nil, s.graphQLErr(p.Context, err)
+						}
+						thingLoaderFromContext(p.Context).prime(things...)
+						return things, nil
+					},
+				},
+			}
+		}),
+	})
+
+	thingPageType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "ThingPage",
+		Fields: graphql.Fields{
+			"total": pageField(graphql.NewNonNull(graphql.Int), func(p thingPage) interface{} { return p.Total }),
+			"page":  pageField(graphql.NewNonNull(graphql.Int), func(p thingPage) interface{} { return p.Page }),
+			"limit": pageField(graphql.NewNonNull(graphql.Int), func(p thingPage) interface{} { return p.Limit }),
+			"things": pageField(
+				graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(thingType))),
+				func(p thingPage) interface{} { return p.things },
+			),
+		},
+	})
+
+	thingInputFields := func(forUpdate bool) graphql.InputObjectConfigFieldMap {
+		name := graphql.Input(graphql.NewNonNull(graphql.String))
+		parentDescription := "The uuid of the parent thing, the thing is created at the root when omitted"
+		labelsDescription := ""
+		if forUpdate {
+			name = graphql.String
+			parentDescription = "Moves the thing below another thing, an empty string moves it to the root, it is kept when omitted"
+			labelsDescription = "Replace the labels of the thing, they are kept when omitted"
+		}
+		return graphql.InputObjectConfigFieldMap{
+			"name":   &graphql.InputObjectFieldConfig{Type: name},
+			"value":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"labels": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(labelInputType)), Description: labelsDescription},
+			"kind":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"data":   &graphql.InputObjectFieldConfig{Type: jsonScalar},
+			"parent": &graphql.InputObjectFieldConfig{Type: graphql.String, Description: parentDescription},
+		}
+	}
+	createThingInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   "CreateThingInput",
+		Fields: thingInputFields(false),
+	})
+	updateThingInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   "UpdateThingInput",
+		Fields: thingInputFields(true),
+	})
+	updateThingPayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UpdateThingPayload",
+		Fields: graphql.Fields{
+			"thing":   &graphql.Field{Type: graphql.NewNonNull(thingType)},
+			"created": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"thing": &graphql.Field{
+				Type:        thingType,
+				Description: "The thing with uuid, null when it does not exist",
+				Args: graphql.FieldConfigArgument{
+					"uuid": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return thingLoaderFromContext(p.Context).load(p.Context, p.Args["uuid"].(string)), nil
+				},
+			},
+			"things": &graphql.Field{
+				Type: graphql.NewNonNull(thingPageType),
+				Args: func() graphql.FieldConfigArgument {
+					args := paginationArgs()
+					args["labelSelector"] = &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "Label selector, e.g. env=prod,team in (a,b),!deprecated",
+					}
+					return args
+				}(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, limit := paginationFromArgs(p.Args)
+					labelSelector, _ := p.Args["labelSelector"].(string)
+					selector, err := labels.Parse(labelSelector)
+					if err != nil {
+						return nil, s.graphQLErr(p.Context, err)
+					}
+					things, count, err := s.db.GetThings(p.Context, (page-1)*limit, limit, selector, nil)
+					if err != nil {
+						return nil, s.graphQLErr(p.Context, err)
+					}
+					thingLoaderFromContext(p.Context).prime(things...)
+					return newThingPage(things, page, limit, count), nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createThing": &graphql.Field{
+				Type: graphql.NewNonNull(thingType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createThingInputType)},
+				},
+				Resolve: s.resolveCreateThing,
+			},
+			"updateThing": &graphql.Field{
+				Type:        graphql.NewNonNull(updateThingPayloadType),
+				Description: "Update a thing, or create it with the given uuid when it does not exist yet and a name is given",
+				Args: graphql.FieldConfigArgument{
+					"uuid":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateThingInputType)},
+				},
+				Resolve: s.resolveUpdateThing,
+			},
+			"deleteThing": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Delete a thing and its attachments, a thing with children is only deleted with cascade",
+				Args: graphql.FieldConfigArgument{
+					"uuid":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"cascade": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				},
+				Resolve: s.resolveDeleteThing,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func (s *Server) resolveCreateThing(p graphql.ResolveParams) (interface{}, error) {
+	if err := s.authorize(p.Context, ScopeThingsWrite); err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	defer thingLoaderFromContext(p.Context).clear()
+	input := p.Args["input"].(map[string]interface{})
+	thingLabels, data, err := labelsAndDataFromInput(input)
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	name, _ := input["name"].(string)
+	value, _ := input["value"].(string)
+	kind, _ := input["kind"].(string)
+	parent, _ := input["parent"].(string)
+
+	thingInput, err := s.thingInput(p.Context, kind, name, value, data, thingLabels)
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	thingInput.ParentUUID = &parent
+
+	thing, err := s.db.CreateThing(p.Context, thingInput)
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	return thing, nil
+}
+
+func (s *Server) resolveUpdateThing(p graphql.ResolveParams) (interface{}, error) {
+	if err := s.authorize(p.Context, ScopeThingsWrite); err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	defer thingLoaderFromContext(p.Context).clear()
+	uuid := p.Args["uuid"].(string)
+	input := p.Args["input"].(map[string]interface{})
+	thingLabels, data, err := labelsAndDataFromInput(input)
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	thingToUpdate := UpdateThing{Labels: thingLabels, Data: data}
+	thingToUpdate.Name, _ = input["name"].(string)
+	thingToUpdate.Value, _ = input["value"].(string)
+	thingToUpdate.Kind, _ = input["kind"].(string)
+	if parent, ok := input["parent"].(string); ok {
+		thingToUpdate.Parent = &parent
+	}
+
+	thing, created, err := s.upsertThing(p.Context, uuid, thingToUpdate)
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	return map[string]interface{}{"thing": thing, "created": created}, nil
+}
+
+func (s *Server) resolveDeleteThing(p graphql.ResolveParams) (interface{}, error) {
+	if err := s.authorize(p.Context, ScopeThingsWrite); err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	defer thingLoaderFromContext(p.Context).clear()
+	policy := db.Restrict
+	if cascade, _ := p.Args["cascade"].(bool); cascade {
+		policy = db.Cascade
+	}
+
+	attachments, err := s.db.DeleteThing(p.Context, p.Args["uuid"].(string), policy)
+	if err == db.ErrThingNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return nil, s.graphQLErr(p.Context, err)
+	}
+	s.deleteAttachmentBlobs(p.Context, attachments)
+	return true, nil
+}
+
+// labelsAndDataFromInput converts the labels and data of a thing input, the labels are nil when omitted
+func labelsAndDataFromInput(input map[string]interface{}) (map[string]string, json.RawMessage, error) {
+	var thingLabels map[string]string
+	if list, ok := input["labels"].([]interface{}); ok {
+		thingLabels = map[string]string{}
+		for _, item := range list {
+			label := item.(map[string]interface{})
+			thingLabels[label["key"].(string)] = label["value"].(string)
+		}
+	}
+
+	var data json.RawMessage
+	if v, ok := input["data"]; ok && v != nil {
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, nil, &httpx.ValidationError{Message: "invalid data"}
+		}
+	}
+	return thingLabels, data, nil
+}
+
+// thingPage is the source of a ThingPage
+type thingPage struct {
+	Total  int
+	Page   int
+	Limit  int
+	things []db.Thing
+}
+
+func newThingPage(things []db.Thing, page int, limit int, total int) thingPage {
+	return thingPage{Total: total, Page: page, Limit: limit, things: things}
+}
+
+func thingField(t graphql.Output, resolve func(db.Thing) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolve(p.Source.(db.Thing)), nil
+		},
+	}
+}
+
+func pageField(t graphql.Output, resolve func(thingPage) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolve(p.Source.(thingPage)), nil
+		},
+	}
+}
+
+func paginationArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"page":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+		"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultLimit, Description: "Limit (max 100)"},
+	}
+}
+
+// paginationFromArgs applies the same bounds as the page and limit query parameters
+func paginationFromArgs(args map[string]interface{}) (page int, limit int) {
+	page, _ = args["page"].(int)
+	if page < 1 {
+		page = 1
+	}
+	limit, _ = args["limit"].(int)
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	return page, limit
+}
+
+func labelsToList(thingLabels db.Labels) []map[string]interface{} {
+	keys := make([]string, 0, len(thingLabels))
+	for k := range thingLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([]map[string]interface{}, len(keys))
+	for i, k := range keys {
+		list[i] = map[string]interface{}{"key": k, "value": thingLabels[k]}
+	}
+	return list
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	maxQueryDepth = 10
+	// maxQueryComplexity allows for example a page of 100 things with the children of each of them
+	maxQueryComplexity = 2000
+	// maxBatchSize is the maximum number of requests in a batch, each request is limited on its own
+	maxBatchSize = 10
+)
+
+// queryLimits computes the depth and complexity of an operation, every field costs 1 and the cost of the
+// selection of a field with a limit argument is multiplied by that limit. Introspection fields are free.
+type queryLimits struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func checkQueryLimits(schema *graphql.Schema, document *ast.Document, operationName string, variables map[string]interface{}) error {
+	q := queryLimits{
+		schema:    schema,
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+	}
+
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			q.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return nil
+	}
+
+	root := schema.QueryType()
+	if operation.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+
+	depth, complexity := q.selectionSet(root, operation.SelectionSet)
+	if depth > maxQueryDepth {
+		return fmt.Errorf("query depth %d exceeds the maximum of %d", depth, maxQueryDepth)
+	}
+	if complexity > maxQueryComplexity {
+		return fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, maxQueryComplexity)
+	}
+	return nil
+}
+
+func (q *queryLimits) selectionSet(parent graphql.Type, selectionSet *ast.SelectionSet) (depth int, complexity int) {
+	if selectionSet == nil {
+		return 0, 0
+	}
+	for _, selection := range selectionSet.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = q.field(parent, selection)
+		case *ast.InlineFragment:
+			t := parent
+			if selection.TypeCondition != nil {
+				t = q.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			d, c = q.selectionSet(t, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			fragment, ok := q.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			d, c = q.selectionSet(q.schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet)
+		}
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (q *queryLimits) field(parent graphql.Type, field *ast.Field) (depth int, complexity int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+
+	object, ok := parent.(*graphql.Object)
+	if !ok {
+		return 1, 1
+	}
+	definition, ok := object.Fields()[field.Name.Value]
+	if !ok {
+		return 1, 1
+	}
+
+	depth, complexity = q.selectionSet(namedType(definition.Type), field.SelectionSet)
+	return depth + 1, 1 + complexity*q.limit(definition, field)
+}
+
+// limit returns the value of the limit argument of a field, or 1 for fields without one
+func (q *queryLimits) limit(definition *graphql.FieldDefinition, field *ast.Field) int {
+	var argument *graphql.Argument
+	for _, arg := range definition.Args {
+		if arg.Name() == "limit" {
+			argument = arg
+		}
+	}
+	if argument == nil {
+		return 1
+	}
+
+	limit := defaultLimit
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			limit, _ = strconv.Atoi(value.Value)
+		case *ast.Variable:
+			limit = intVariable(q.variables[value.Name.Value])
+		}
+	}
+	// larger limits are reduced to the default by paginationFromArgs
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	return limit
+}
+
+func intVariable(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case json.Number:
+		i, _ := v.Int64()
+		return int(i)
+	}
+	return defaultLimit
+}
+
+// namedType removes the list and non null wrappers of a type
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapper := t.(type) {
+		case *graphql.List:
+			t = wrapper.OfType
+		case *graphql.NonNull:
+			t = wrapper.OfType
+		default:
+			return t
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+type thingLoaderContextKey struct{}
+
+// thingLoader batches the GetThing lookups of a single GraphQL request, lookups are collected while the fields
+// of a level of the query are resolved and retrieved with one GetThingsByUUID when the first result is needed
+type thingLoader struct {
+	db db.Service
+
+	mu      sync.Mutex
+	pending []string
+	results map[string]*thingResult
+}
+
+type thingResult struct {
+	thing  db.Thing
+	found  bool
+	loaded bool
+	err    error
+}
+
+func newThingLoader(dbService db.Service) *thingLoader {
+	return &thingLoader{db: dbService, results: map[string]*thingResult{}}
+}
+
+func withThingLoader(ctx context.Context, loader *thingLoader) context.Context {
+	return context.WithValue(ctx, thingLoaderContextKey{}, loader)
+}
+
+func thingLoaderFromContext(ctx context.Context) *thingLoader {
+	return ctx.Value(thingLoaderContextKey{}).(*thingLoader)
+}
+
+// load returns a thunk resolving to the thing with uuid, or nil when it does not exist
+func (l *thingLoader) load(ctx context.Context, uuid string) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.results[uuid]; !ok {
+		l.results[uuid] = &thingResult{}
+		l.pending = append(l.pending, uuid)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		result, ok := l.results[uuid]
+		if !ok {
+			// the result was cleared by a mutation after the lookup
+			result = &thingResult{}
+			l.results[uuid] = result
+			l.pending = append(l.pending, uuid)
+		}
+		if !result.loaded {
+			l.fetch(ctx)
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		if !result.found {
+			return nil, nil
+		}
+		return result.thing, nil
+	}
+}
+
+// prime caches things retrieved by other lookups
+func (l *thingLoader) prime(things ...db.Thing) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, thing := range things {
+		result, ok := l.results[thing.UUID]
+		if !ok {
+			result = &thingResult{}
+			l.results[thing.UUID] = result
+		}
+		if !result.loaded {
+			result.thing, result.found, result.loaded = thing, true, true
+			l.unpend(thing.UUID)
+		}
+	}
+}
+
+// unpend removes uuid from the pending lookups, it must be called with the lock held
+func (l *thingLoader) unpend(uuid string) {
+	for i, pending := range l.pending {
+		if pending == uuid {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// clear forgets all retrieved things, mutations clear the loader so later lookups in the same
+// request or batch see their changes
+func (l *thingLoader) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for uuid, result := range l.results {
+		if result.loaded {
+			delete(l.results, uuid)
+		}
+	}
+	pending := l.pending[:0]
+	for _, uuid := range l.pending {
+		if _, ok := l.results[uuid]; ok {
+			pending = append(pending, uuid)
+		}
+	}
+	l.pending = pending
+}
+
+// fetch retrieves all pending things, it must be called with the lock held. Things cleared while they
+// were pending are skipped, their lookups add them again.
+func (l *thingLoader) fetch(ctx context.Context) {
+	uuids := l.pending
+	l.pending = nil
+
+	things, err := l.db.GetThingsByUUID(ctx, uuids)
+	for _, thing := range things {
+		if result, ok := l.results[thing.UUID]; ok {
+			result.thing = thing
+			result.found = true
+		}
+	}
+	for _, uuid := range uuids {
+		if result, ok := l.results[uuid]; ok {
+			result.loaded = true
+			result.err = err
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+type graphQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func doGraphQL(t *testing.T, fake *fakeDB, query string, variables map[string]interface{}) graphQLResponse {
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response graphQLResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func doGraphQLBatch(t *testing.T, fake *fakeDB, queries ...string) (int, []graphQLResponse) {
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	require.NoError(t, err)
+
+	requests := make([]GraphQLRequest, len(queries))
+	for i, query := range queries {
+		requests[i] = GraphQLRequest{Query: query}
+	}
+	body, err := json.Marshal(requests)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+
+	var responses []graphQLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	return w.Code, responses
+}
+
+func TestGraphQLBatch(t *testing.T) {
+	project, environment := db.RandomID(), db.RandomID()
+	fake := &fakeDB{things: []db.Thing{
+		{UUID: project, Name: "project", Value: "old"},
+		{UUID: environment, Name: "environment", ParentUUID: project},
+	}}
+
+	parentValue := `{ thing(uuid: "` + environment + `") { parent { value } } }`
+	code, responses := doGraphQLBatch(t, fake,
+		parentValue,
+		`mutation { updateThing(uuid: "`+project+`", input: {value: "new"}) { created } }`,
+		parentValue,
+	)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, responses, 3)
+	for _, response := range responses {
+		assert.Empty(t, response.Errors)
+	}
+	parent := func(response graphQLResponse) interface{} {
+		return response.Data["thing"].(map[string]interface{})["parent"].(map[string]interface{})["value"]
+	}
+	assert.Equal(t, "old", parent(responses[0]))
+	// the mutation clears the things loaded by the first request
+	assert.Equal(t, "new", parent(responses[2]))
+
+	queries := make([]string, maxBatchSize+1)
+	for i := range queries {
+		queries[i] = parentValue
+	}
+	code, _ = doGraphQLBatch(t, fake, queries...)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doGraphQLBatch(t, fake, queries[:maxBatchSize]...)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestGraphQLBatchesThingLookups(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{
+		{UUID: "project", Name: "project"},
+		{UUID: "environment", Name: "environment", ParentUUID: "project"},
+		{UUID: "config", Name: "config", ParentUUID: "project", Kind: "config", Data: db.JSON(`{"port": 80}`)},
+	}}
+
+	response := doGraphQL(t, fake, `{
+		a: thing(uuid: "environment") { name parent { name } }
+		b: thing(uuid: "config") { name data parent { name } }
+		c: thing(uuid: "missing") { name }
+	}`, nil)
+
+	assert.Empty(t, response.Errors)
+	assert.Equal(t, "project", response.Data["a"].(map[string]interface{})["parent"].(map[string]interface{})["name"])
+	assert.Equal(t, float64(80), response.Data["b"].(map[string]interface{})["data"].(map[string]interface{})["port"])
+	assert.Nil(t, response.Data["c"])
+	// one lookup for the things and one for their shared parent
+	assert.Equal(t, 2, fake.lookups)
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	fake := &fakeDB{}
+
+	response := doGraphQL(t, fake, `{ thing(uuid: "a") {
+		parent { parent { parent { parent { parent { parent { parent { parent { parent { name } } } } } } } } }
+	} }`, nil)
+	assert.Len(t, response.Errors, 1)
+	assert.Contains(t, response.Errors[0].Message, "depth")
+
+	response = doGraphQL(
+		t,
+		fake,
+		`query($limit: Int) { things(limit: $limit) { things { children(limit: 100) { things { name } } } } }`,
+		map[string]interface{}{"limit": 100},
+	)
+	assert.Len(t, response.Errors, 1)
+	assert.Contains(t, response.Errors[0].Message, "complexity")
+
+	response = doGraphQL(t, fake, `{ things(labelSelector: "in in") { total } }`, nil)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "BAD_REQUEST", response.Errors[0].Extensions["code"])
+}
+
+func TestGraphQLMutationErrors(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{
+		{UUID: "project", Name: "project"},
+		{UUID: "environment", Name: "environment", ParentUUID: "project"},
+	}}
+
+	response := doGraphQL(t, fake, `mutation { deleteThing(uuid: "project") }`, nil)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "CONFLICT", response.Errors[0].Extensions["code"])
+
+	response = doGraphQL(t, fake, `mutation { deleteThing(uuid: "project", cascade: true) }`, nil)
+	assert.Empty(t, response.Errors)
+	assert.Equal(t, true, response.Data["deleteThing"])
+
+	response = doGraphQL(t, fake, `mutation { updateThing(uuid: "invalid", input: {name: "name"}) { created } }`, nil)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "BAD_REQUEST", response.Errors[0].Extensions["code"])
+}
+
+func TestGraphQLMutationClearsPrimedLookups(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{
+		{UUID: "project", Name: "project"},
+		{UUID: "environment", Name: "environment", ParentUUID: "project"},
+		{UUID: "other", Name: "other"},
+		{UUID: "leaf", Name: "leaf"},
+	}}
+
+	// the parents of a and b are pending until the mutations are done, c primes the parent of a and
+	// deleting leaf clears it again
+	response := doGraphQL(t, fake, `mutation {
+		a: createThing(input: {name: "a", value: "v", parent: "project"}) { parent { name } }
+		b: createThing(input: {name: "b", value: "v", parent: "other"}) { parent { name } }
+		c: createThing(input: {name: "c", value: "v", parent: "environment"}) { ancestors { name } }
+		d: deleteThing(uuid: "leaf")
+	}`, nil)
+
+	assert.Empty(t, response.Errors)
+	assert.Equal(t, "project", response.Data["a"].(map[string]interface{})["parent"].(map[string]interface{})["name"])
+	assert.Equal(t, "other", response.Data["b"].(map[string]interface{})["parent"].(map[string]interface{})["name"])
+}
+
+func TestThingLoaderClearPrimed(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "x", Name: "x"}, {UUID: "y", Name: "y"}}}
+	loader := newThingLoader(fake)
+	ctx := context.Background()
+
+	x := loader.load(ctx, "x")
+	y := loader.load(ctx, "y")
+	loader.prime(fake.things[0])
+	loader.clear()
+
+	thing, err := y()
+	require.NoError(t, err)
+	assert.Equal(t, "y", thing.(db.Thing).Name)
+	thing, err = x()
+	require.NoError(t, err)
+	assert.Equal(t, "x", thing.(db.Thing).Name)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestHealth(t *testing.T) {
+	fake := &fakeDB{}
+	logs := &bytes.Buffer{}
+	s, err := NewServer(log.NewJSONLogger(logs, "", false), fake, nil, WithAuthentication())
+	require.NoError(t, err)
+
+	get := func(s *Server, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// the health routes do not require authentication
+	w := get(s, "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Regexp(t, `^\{"status":"up","checks":\[\{"name":"db","status":"up","latencyMs":[0-9.]+\}\]\}`, w.Body.String())
+
+	// the readiness report is reused for a second, a server with an unavailable database reports it as
+	// down and only logs the error
+	down, err := NewServer(log.NewJSONLogger(logs, "", false), &fakeDB{pingErr: errors.New("connection refused")}, nil)
+	require.NoError(t, err)
+	w = get(down, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	assert.Contains(t, logs.String(), "connection refused")
+	w = get(down, "/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	s.health.Drain()
+	w = get(s, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"shutdown"`)
+	assert.Equal(t, http.StatusOK, get(s, "/healthz").Code)
+}
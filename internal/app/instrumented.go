@@ -0,0 +1,237 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+	"github.com/ldej/api-ldej-nl/pkg/metrics"
+)
+
+// expectedDBErrors are the outcomes of operations on things which do not exist or cannot be changed,
+// they are not failures of the storage
+var expectedDBErrors = map[error]bool{
+	db.ErrThingNotFound:       true,
+	db.ErrAttachmentNotFound:  true,
+	db.ErrParentNotFound:      true,
+	db.ErrCycle:               true,
+	db.ErrThingHasChildren:    true,
+	db.ErrKindNotFound:        true,
+	db.ErrKindAlreadyExists:   true,
+	db.ErrKindInUse:           true,
+	db.ErrAPIKeyNotFound:      true,
+	db.ErrAPIKeyAlreadyExists: true,
+	db.ErrAPIKeyRevoked:       true,
+	db.ErrShareLinkUsedUp:     true,
+	db.ErrInvalidGrant:        true,
+	db.ErrTooManyThings:       true,
+}
+
+// instrumentedDB observes the duration and failures of every operation of service when metrics is set,
+// and traces them with a span when tracer is set. It implements db.Service without embedding it, so
+// operations added to db.Service cannot be left out.
+type instrumentedDB struct {
+	service db.Service
+	backend string
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+}
+
+// start starts operation, the returned func ends it. An operation failed when it returns an unexpected
+// error, operations canceled by clients going away did not fail either.
+func (i instrumentedDB) start(ctx context.Context, operation string) (context.Context, func(err *error)) {
+	start := time.Now()
+	var span trace.Span
+	if i.tracer != nil {
+		ctx, span = i.tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", i.backend),
+			attribute.String("db.operation", operation),
+		))
+	}
+	return ctx, func(err *error) {
+		failed := *err != nil && !expectedDBErrors[*err] && *err != context.Canceled
+		if i.metrics != nil {
+			i.metrics.ObserveOperation(i.backend, operation, start, failed)
+		}
+		if span != nil {
+			if failed {
+				span.RecordError(*err)
+				span.SetStatus(codes.Error, (*err).Error())
+			}
+			span.End()
+		}
+	}
+}
+
+func (i instrumentedDB) GetThing(ctx context.Context, uuid string) (_ db.Thing, err error) {
+	ctx, end := i.start(ctx, "GetThing")
+	defer end(&err)
+	return i.service.GetThing(ctx, uuid)
+}
+
+func (i instrumentedDB) GetThingsByUUID(ctx context.Context, uuids []string) (_ []db.Thing, err error) {
+	ctx, end := i.start(ctx, "GetThingsByUUID")
+	defer end(&err)
+	return i.service.GetThingsByUUID(ctx, uuids)
+}
+
+func (i instrumentedDB) CreateThing(ctx context.Context, input db.ThingInput) (_ db.Thing, err error) {
+	ctx, end := i.start(ctx, "CreateThing")
+	defer end(&err)
+	return i.service.CreateThing(ctx, input)
+}
+
+func (i instrumentedDB) UpdateThing(ctx context.Context, uuid string, input db.ThingInput) (_ db.Thing, err error) {
+	ctx, end := i.start(ctx, "UpdateThing")
+	defer end(&err)
+	return i.service.UpdateThing(ctx, uuid, input)
+}
+
+func (i instrumentedDB) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (_ db.Thing, _ bool, err error) {
+	ctx, end := i.start(ctx, "UpsertThing")
+	defer end(&err)
+	return i.service.UpsertThing(ctx, uuid, input)
+}
+
+func (i instrumentedDB) DeleteThing(ctx context.Context, uuid string, policy db.DeletePolicy) (_ []db.Attachment, err error) {
+	ctx, end := i.start(ctx, "DeleteThing")
+	defer end(&err)
+	return i.service.DeleteThing(ctx, uuid, policy)
+}
+
+func (i instrumentedDB) GetThings(ctx context.Context, offset int, limit int, selector labels.Selector, viewer *db.Viewer) (_ []db.Thing, _ int, err error) {
+	ctx, end := i.start(ctx, "GetThings")
+	defer end(&err)
+	return i.service.GetThings(ctx, offset, limit, selector, viewer)
+}
+
+func (i instrumentedDB) GetChildren(ctx context.Context, uuid string, offset int, limit int, viewer *db.Viewer) (_ []db.Thing, _ int, err error) {
+	ctx, end := i.start(ctx, "GetChildren")
+	defer end(&err)
+	return i.service.GetChildren(ctx, uuid, offset, limit, viewer)
+}
+
+func (i instrumentedDB) GetAncestors(ctx context.Context, uuid string) (_ []db.Thing, err error) {
+	ctx, end := i.start(ctx, "GetAncestors")
+	defer end(&err)
+	return i.service.GetAncestors(ctx, uuid)
+}
+
+func (i instrumentedDB) CountThings(ctx context.Context, owner string) (_ int, err error) {
+	ctx, end := i.start(ctx, "CountThings")
+	defer end(&err)
+	return i.service.CountThings(ctx, owner)
+}
+
+func (i instrumentedDB) SetThingACL(ctx context.Context, uuid string, acl db.ACL) (_ db.Thing, err error) {
+	ctx, end := i.start(ctx, "SetThingACL")
+	defer end(&err)
+	return i.service.SetThingACL(ctx, uuid, acl)
+}
+
+func (i instrumentedDB) GetKind(ctx context.Context, name string) (_ db.Kind, err error) {
+	ctx, end := i.start(ctx, "GetKind")
+	defer end(&err)
+	return i.service.GetKind(ctx, name)
+}
+
+func (i instrumentedDB) GetKinds(ctx context.Context) (_ []db.Kind, err error) {
+	ctx, end := i.start(ctx, "GetKinds")
+	defer end(&err)
+	return i.service.GetKinds(ctx)
+}
+
+func (i instrumentedDB) CreateKind(ctx context.Context, name string, description string, schema db.JSON) (_ db.Kind, err error) {
+	ctx, end := i.start(ctx, "CreateKind")
+	defer end(&err)
+	return i.service.CreateKind(ctx, name, description, schema)
+}
+
+func (i instrumentedDB) AddKindSchema(ctx context.Context, name string, schema db.JSON) (_ db.Kind, err error) {
+	ctx, end := i.start(ctx, "AddKindSchema")
+	defer end(&err)
+	return i.service.AddKindSchema(ctx, name, schema)
+}
+
+func (i instrumentedDB) GetKindSchemas(ctx context.Context, name string) (_ []db.KindSchema, err error) {
+	ctx, end := i.start(ctx, "GetKindSchemas")
+	defer end(&err)
+	return i.service.GetKindSchemas(ctx, name)
+}
+
+func (i instrumentedDB) DeleteKind(ctx context.Context, name string) (err error) {
+	ctx, end := i.start(ctx, "DeleteKind")
+	defer end(&err)
+	return i.service.DeleteKind(ctx, name)
+}
+
+func (i instrumentedDB) CreateAttachment(ctx context.Context, attachment db.Attachment) (_ db.Attachment, err error) {
+	ctx, end := i.start(ctx, "CreateAttachment")
+	defer end(&err)
+	return i.service.CreateAttachment(ctx, attachment)
+}
+
+func (i instrumentedDB) GetAttachment(ctx context.Context, thingUUID string, uuid string) (_ db.Attachment, err error) {
+	ctx, end := i.start(ctx, "GetAttachment")
+	defer end(&err)
+	return i.service.GetAttachment(ctx, thingUUID, uuid)
+}
+
+func (i instrumentedDB) GetAttachments(ctx context.Context, thingUUID string) (_ []db.Attachment, err error) {
+	ctx, end := i.start(ctx, "GetAttachments")
+	defer end(&err)
+	return i.service.GetAttachments(ctx, thingUUID)
+}
+
+func (i instrumentedDB) DeleteAttachment(ctx context.Context, thingUUID string, uuid string) (err error) {
+	ctx, end := i.start(ctx, "DeleteAttachment")
+	defer end(&err)
+	return i.service.DeleteAttachment(ctx, thingUUID, uuid)
+}
+
+func (i instrumentedDB) CreateAPIKey(ctx context.Context, key db.APIKey) (_ db.APIKey, err error) {
+	ctx, end := i.start(ctx, "CreateAPIKey")
+	defer end(&err)
+	return i.service.CreateAPIKey(ctx, key)
+}
+
+func (i instrumentedDB) GetAPIKey(ctx context.Context, id string) (_ db.APIKey, err error) {
+	ctx, end := i.start(ctx, "GetAPIKey")
+	defer end(&err)
+	return i.service.GetAPIKey(ctx, id)
+}
+
+func (i instrumentedDB) GetAPIKeys(ctx context.Context) (_ []db.APIKey, err error) {
+	ctx, end := i.start(ctx, "GetAPIKeys")
+	defer end(&err)
+	return i.service.GetAPIKeys(ctx)
+}
+
+func (i instrumentedDB) RotateAPIKey(ctx context.Context, id string, hash string) (_ db.APIKey, err error) {
+	ctx, end := i.start(ctx, "RotateAPIKey")
+	defer end(&err)
+	return i.service.RotateAPIKey(ctx, id, hash)
+}
+
+func (i instrumentedDB) RevokeAPIKey(ctx context.Context, id string) (_ db.APIKey, err error) {
+	ctx, end := i.start(ctx, "RevokeAPIKey")
+	defer end(&err)
+	return i.service.RevokeAPIKey(ctx, id)
+}
+
+func (i instrumentedDB) UseShareLink(ctx context.Context, id string, maxUses int, expires time.Time) (err error) {
+	ctx, end := i.start(ctx, "UseShareLink")
+	defer end(&err)
+	return i.service.UseShareLink(ctx, id, maxUses, expires)
+}
+
+func (i instrumentedDB) Ping(ctx context.Context) (err error) {
+	ctx, end := i.start(ctx, "Ping")
+	defer end(&err)
+	return i.service.Ping(ctx)
+}
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+var kindNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+var errInvalidKindName = errors.New("invalid kind name, use lowercase alphanumerics and '-'")
+
+type KindResponse struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Version     int             `json:"version"`
+	Schema      json.RawMessage `json:"schema" swaggertype:"object"`
+
+	Updated time.Time `json:"updated"`
+	Created time.Time `json:"created"`
+}
+
+type KindsResponse struct {
+	Kinds []KindResponse `json:"kinds"`
+}
+
+type KindSchemaResponse struct {
+	Version int             `json:"version"`
+	Schema  json.RawMessage `json:"schema" swaggertype:"object"`
+
+	Created time.Time `json:"created"`
+}
+
+type KindSchemasResponse struct {
+	Kind    string               `json:"kind"`
+	Schemas []KindSchemaResponse `json:"schemas"`
+}
+
+// ListKinds godoc
+// @Summary List kinds
+// @Description List all kinds with their latest schema
+// @ID list-kinds
+// @Tags Kind
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Success 200 {object} KindsResponse
+// @Failure 401,403,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind [get]
+func (s *Server) ListKinds(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	kinds, err := s.db.GetKinds(ctx)
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	kindsResponse := KindsResponse{Kinds: []KindResponse{}}
+	for _, kind := range kinds {
+		kindsResponse.Kinds = append(kindsResponse.Kinds, kindToKindResponse(kind))
+	}
+	httpx.JSON(w, r, kindsResponse)
+}
+
+// GetKind godoc
+// @Summary Get a kind
+// @Description Get a kind with its latest schema
+// @ID get-kind-by-name
+// @Tags Kind
+// @Produce json,application/yaml,application/msgpack
+// @Param name path string true "Name"
+// @Success 200 {object} KindResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind/{name} [get]
+func (s *Server) GetKind(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+
+	kind, err := s.db.GetKind(ctx, name)
+	if err == db.ErrKindNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	httpx.JSON(w, r, kindToKindResponse(kind))
+}
+
+type CreateKind struct {
+	Name        string          `json:"name" validate:"required"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" validate:"required" swaggertype:"object"`
+}
+
+// CreateKind godoc
+// @Summary Create a kind
+// @Description Create a kind, the schema is a JSON Schema which becomes version 1
+// @ID create-kind
+// @Tags Kind
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param Body body CreateKind true "The body to create a kind"
+// @Success 200 {object} KindResponse
+// @Failure 400,401,403,409,413,415,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind/new [post]
+func (s *Server) CreateKind(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var kindToCreate CreateKind
+	err := s.parseJSON(r, &kindToCreate)
+	if err != nil {
+		abortInvalidBody(w, r, err)
+		return
+	}
+	if !kindNameRegexp.MatchString(kindToCreate.Name) {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, errInvalidKindName)
+		return
+	}
+	if _, err := compileSchema(schemaURL(kindToCreate.Name, 1), kindToCreate.Schema); err != nil {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	createdKind, err := s.db.CreateKind(ctx, kindToCreate.Name, kindToCreate.Description, db.JSON(kindToCreate.Schema))
+	if err == db.ErrKindAlreadyExists {
+		httpx.AbortJSON(w, r, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	httpx.JSON(w, r, kindToKindResponse(createdKind))
+}
+
+// DeleteKind godoc
+// @Summary Delete a kind
+// @Description Delete a kind and all its schema versions, a kind used by things cannot be deleted
+// @ID delete-kind
+// @Tags Kind
+// @Produce json,application/yaml,application/msgpack
+// @Param name path string true "Name"
+// @Success 200 "Empty response"
+// @Failure 401,403,409,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind/{name} [delete]
+func (s *Server) DeleteKind(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+
+	err := s.db.DeleteKind(ctx, name)
+	if err == db.ErrKindInUse {
+		httpx.AbortJSON(w, r, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// ListKindSchemas godoc
+// @Summary List the schema versions of a kind
+// @Description List all schema versions of a kind, oldest first
+// @ID list-kind-schemas
+// @Tags Kind
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param name path string true "Name"
+// @Success 200 {object} KindSchemasResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind/{name}/schema [get]
+func (s *Server) ListKindSchemas(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+
+	schemas, err := s.db.GetKindSchemas(ctx, name)
+	if err == db.ErrKindNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	schemasResponse := KindSchemasResponse{Kind: name, Schemas: []KindSchemaResponse{}}
+	for _, schema := range schemas {
+		schemasResponse.Schemas = append(schemasResponse.Schemas, KindSchemaResponse{
+			Version: schema.Version,
+			Schema:  json.RawMessage(schema.Schema),
+			Created: schema.Created,
+		})
+	}
+	httpx.JSON(w, r, schemasResponse)
+}
+
+type AddKindSchema struct {
+	Schema json.RawMessage `json:"schema" validate:"required" swaggertype:"object"`
+}
+
+// AddKindSchema godoc
+// @Summary Add a schema version to a kind
+// @Description Add a new version of the schema of a kind, things are validated against the latest version when they are created or updated
+// @ID add-kind-schema
+// @Tags Kind
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param name path string true "Name"
+// @Param Body body AddKindSchema true "The body to add a schema version"
+// @Success 200 {object} KindResponse
+// @Failure 400,401,403,404,413,415,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/kind/{name}/schema [post]
+func (s *Server) AddKindSchema(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+
+	var schemaToAdd AddKindSchema
+	err := s.parseJSON(r, &schemaToAdd)
+	if err != nil {
+		abortInvalidBody(w, r, err)
+		return
+	}
+	if _, err := compileSchema(schemaURL(name, 0), schemaToAdd.Schema); err != nil {
+		httpx.AbortJSON(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	kind, err := s.db.AddKindSchema(ctx, name, db.JSON(schemaToAdd.Schema))
+	if err == db.ErrKindNotFound {
+		httpx.AbortJSON(w, r, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	httpx.JSON(w, r, kindToKindResponse(kind))
+}
+
+func kindToKindResponse(kind db.Kind) KindResponse {
+	return KindResponse{
+		Name:        kind.Name,
+		Description: kind.Description,
+		Version:     kind.Version,
+		Schema:      json.RawMessage(kind.Schema),
+		Updated:     kind.Updated,
+		Created:     kind.Created,
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestKinds(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	w := serve(s, http.MethodPost, "/v1/kind/new", `{"name":"config","description":"A port","schema":`+portSchema+`}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var kind KindResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &kind))
+	assert.Equal(t, "config", kind.Name)
+	assert.Equal(t, 1, kind.Version)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{"duplicate", http.MethodPost, "/v1/kind/new", `{"name":"config","schema":{}}`, http.StatusConflict},
+		{"invalid name", http.MethodPost, "/v1/kind/new", `{"name":"Config","schema":{}}`, http.StatusBadRequest},
+		{"invalid schema", http.MethodPost, "/v1/kind/new", `{"name":"other","schema":{"type":1}}`, http.StatusBadRequest},
+		{"without schema", http.MethodPost, "/v1/kind/new", `{"name":"other"}`, http.StatusBadRequest},
+		{"get", http.MethodGet, "/v1/kind/config", "", http.StatusOK},
+		{"get missing", http.MethodGet, "/v1/kind/missing", "", http.StatusNotFound},
+		{"schemas of missing", http.MethodGet, "/v1/kind/missing/schema", "", http.StatusNotFound},
+		{"add schema to missing", http.MethodPost, "/v1/kind/missing/schema", `{"schema":{}}`, http.StatusNotFound},
+		{"add invalid schema", http.MethodPost, "/v1/kind/config/schema", `{"schema":{"type":1}}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(s, test.method, test.target, test.body)
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+		})
+	}
+
+	w = serve(s, http.MethodGet, "/v1/kind", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var kinds KindsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &kinds))
+	require.Len(t, kinds.Kinds, 1)
+	assert.Equal(t, "A port", kinds.Kinds[0].Description)
+
+	// validating a thing caches the compiled schema of version 1
+	w = serve(s, http.MethodPost, "/v1/thing/new", `{"name":"server","kind":"config","data":{"host":"localhost","port":80}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var first ThingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	w = serve(s, http.MethodDelete, "/v1/thing/"+first.UUID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// things are validated against the latest schema, which allows ports up to 65536
+	w = serve(s, http.MethodPost, "/v1/kind/config/schema", `{"schema":{"type":"object","properties":{"port":{"type":"integer","maximum":65536}},"required":["port"]}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &kind))
+	assert.Equal(t, 2, kind.Version)
+
+	w = serve(s, http.MethodGet, "/v1/kind/config/schema", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var schemas KindSchemasResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schemas))
+	require.Len(t, schemas.Schemas, 2)
+	assert.Equal(t, 1, schemas.Schemas[0].Version)
+	assert.Equal(t, 2, schemas.Schemas[1].Version)
+
+	w = serve(s, http.MethodPost, "/v1/thing/new", `{"name":"server","kind":"config","data":{"port":"http"}}`)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	var invalid httpx.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invalid))
+	assert.Contains(t, fieldNames(invalid.Fields), "/data/port")
+
+	w = serve(s, http.MethodPost, "/v1/thing/new", `{"name":"server","kind":"config","data":{"port":65536}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var thing ThingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &thing))
+
+	for _, body := range []string{
+		`{"name":"server","kind":"missing","data":{"port":80}}`,
+		`{"name":"server","kind":"config","value":"80"}`,
+		`{"name":"server","kind":"config"}`,
+	} {
+		w = serve(s, http.MethodPost, "/v1/thing/new", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// a kind used by things cannot be deleted
+	w = serve(s, http.MethodDelete, "/v1/kind/config", "")
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = serve(s, http.MethodDelete, "/v1/thing/"+thing.UUID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(s, http.MethodDelete, "/v1/kind/config", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(s, http.MethodGet, "/v1/kind/config", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	// a kind created again restarts at version 1, things are validated against its new schema
+	w = serve(s, http.MethodPost, "/v1/kind/new", `{"name":"config","schema":{"type":"object","properties":{"port":{"type":"string"}}}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &kind))
+	assert.Equal(t, 1, kind.Version)
+	w = serve(s, http.MethodPost, "/v1/thing/new", `{"name":"server","kind":"config","data":{"port":"http"}}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,21 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// instrument observes requests by the route pattern they matched, it passes all requests when metrics
+// are disabled
+func (s *Server) instrument(next http.Handler) http.Handler {
+	if s.metrics == nil {
+		return next
+	}
+	return s.metrics.Middleware(routePattern)(next)
+}
+
+// routePattern returns the pattern of the route r matched, like "/v1/thing/{uuid}", after r is routed
+func routePattern(r *http.Request) string {
+	return chi.RouteContext(r.Context()).RoutePattern()
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestMetrics(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}, pingErr: errors.New("connection refused")}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithMetrics("fake"))
+	require.NoError(t, err)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, get("/v1/thing/abc").Code)
+	assert.Equal(t, http.StatusOK, get("/v2/thing/abc").Code)
+	assert.Equal(t, http.StatusNotFound, get("/v1/thing/unknown").Code)
+	assert.Equal(t, http.StatusNotFound, get("/unknown").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+
+	w := get("/metrics")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{code="200",method="GET",route="/v1/thing/{uuid}"} 1`)
+	assert.Contains(t, body, `http_requests_total{code="404",method="GET",route="/v1/thing/{uuid}"} 1`)
+	assert.Contains(t, body, `http_requests_total{code="200",method="GET",route="/v2/thing/{uuid}"} 1`)
+	assert.Contains(t, body, `http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+	assert.Contains(t, body, `db_operation_duration_seconds_count{backend="fake",operation="GetThing"} 3`)
+	// a thing which is not found is not a failure of the database
+	assert.NotContains(t, body, `db_operation_errors_total{backend="fake",operation="GetThing"}`)
+	assert.Contains(t, body, `db_operation_errors_total{backend="fake",operation="Ping"} 1`)
+	assert.Contains(t, body, `go_goroutines`)
+	assert.Contains(t, body, `api_build_info`)
+
+	disabled, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	disabled.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/ldej/api-ldej-nl/pkg/openapi"
+	"github.com/ldej/api-ldej-nl/swagger"
+)
+
+// OpenAPI serves the OpenAPI 3 specification of the API
+func (s *Server) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(swagger.OpenAPI)
+}
+
+// openAPISpec returns the OpenAPI 3 specification embedded in the binary
+func openAPISpec() (*openapi3.T, error) {
+	return openapi.Load(swagger.OpenAPI)
+}
+
+func (s *Server) newOpenAPIValidator(validateResponses bool) (*openapi.Validator, error) {
+	spec, err := openAPISpec()
+	if err != nil {
+		return nil, err
+	}
+	var opts []openapi.Option
+	if validateResponses {
+		opts = append(opts, openapi.WithResponseValidation())
+	}
+	return openapi.NewValidator(spec, s.log, opts...)
+}
@@ -0,0 +1,274 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/openapi"
+)
+
+// TestRoutesMatchOpenAPISpec fails when a route is added without godoc annotations or the
+// annotations describe a route which does not exist, run `make swagger` after changing them
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), &fakeDB{}, nil)
+	assert.NoError(t, err)
+
+	// the documentation itself
+	undocumented := map[string]bool{
+		"/healthz":      true,
+		"/readyz":       true,
+		"/metrics":      true,
+		"/openapi.json": true,
+		"/swagger":      true,
+		"/swagger/*":    true,
+	}
+
+	var routes, v1, legacy []string
+	err = chi.Walk(s.router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		switch {
+		case undocumented[route]:
+		case strings.HasPrefix(route, "/v1/apikey"), strings.HasSuffix(route, "/acl"), strings.HasSuffix(route, "/share"):
+			// the API keys, ACLs and share links were added after the unversioned routes were deprecated
+			routes = append(routes, method+" "+route)
+		case strings.HasPrefix(route, "/v1/"):
+			routes = append(routes, method+" "+route)
+			v1 = append(v1, method+" "+strings.TrimPrefix(route, "/v1"))
+		case strings.HasPrefix(route, "/v2/"), route == "/graphql":
+			routes = append(routes, method+" "+route)
+		default:
+			// the deprecated unversioned routes are the same as in v1
+			legacy = append(legacy, method+" "+route)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(v1)
+	sort.Strings(legacy)
+	assert.Equal(t, v1, legacy)
+
+	spec, err := openAPISpec()
+	assert.NoError(t, err)
+
+	var documented []string
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(documented)
+	assert.Equal(t, documented, routes)
+}
+
+// TestOpenAPIIsGenerated fails when swagger/openapi.json is not regenerated after swagger/swagger.json
+func TestOpenAPIIsGenerated(t *testing.T) {
+	swagger2, err := ioutil.ReadFile("../../swagger/swagger.json")
+	assert.NoError(t, err)
+	converted, err := openapi.Load(swagger2)
+	assert.NoError(t, err)
+
+	spec, err := openAPISpec()
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(converted)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(spec)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual), "run `make swagger`")
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), &fakeDB{}, nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func newValidatingServer(t *testing.T, fake *fakeDB, logs *bytes.Buffer) *Server {
+	s, err := NewServer(log.NewJSONLogger(logs, "", false), fake, nil, WithOpenAPIValidation(true))
+	assert.NoError(t, err)
+	return s
+}
+
+func TestOpenAPIRequestValidation(t *testing.T) {
+	var logs bytes.Buffer
+	s := newValidatingServer(t, &fakeDB{}, &logs)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/thing?limit=ten", nil)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/thing/new", strings.NewReader(`{"value": 1}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response httpx.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	fields := map[string]bool{}
+	for _, field := range response.Fields {
+		fields[field.Field] = true
+	}
+	assert.True(t, fields["/name"])
+	assert.True(t, fields["/value"])
+}
+
+func TestOpenAPIResponseValidation(t *testing.T) {
+	var logs bytes.Buffer
+	fake := &fakeDB{things: []db.Thing{
+		{UUID: "abc", Name: "without labels", Updated: time.Now(), Created: time.Now()},
+		{UUID: "def", Name: "child", ParentUUID: "abc", Updated: time.Now(), Created: time.Now()},
+	}}
+	s := newValidatingServer(t, fake, &logs)
+
+	for _, target := range []string{"/v1/thing", "/v1/thing/abc", "/v2/thing/missing"} {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v2/thing/abc", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	assert.Empty(t, logs.String())
+}
+
+// TestTypedHandlersMatchOpenAPISpec fails when the godoc annotations of a typed handler do not
+// describe the parameters, body and responses the handler binds and writes
+func TestTypedHandlersMatchOpenAPISpec(t *testing.T) {
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), &fakeDB{}, nil)
+	assert.NoError(t, err)
+
+	handlers := map[string]interface{ Operation() httpx.Operation }{
+		"GET /v1/thing":                  s.ListThings(),
+		"POST /v1/thing/new":             s.CreateThing(),
+		"GET /v1/thing/{uuid}":           s.GetThing(),
+		"PUT /v1/thing/{uuid}":           s.UpdateThing(),
+		"DELETE /v1/thing/{uuid}":        s.DeleteThing(),
+		"GET /v1/thing/{uuid}/children":  s.ListChildren(),
+		"GET /v1/thing/{uuid}/ancestors": s.ListAncestors(),
+		"GET /v2/thing":                  s.ListThingsV2(),
+		"POST /v2/thing":                 s.CreateThingV2(),
+		"GET /v2/thing/{uuid}":           s.GetThingV2(),
+		"PUT /v2/thing/{uuid}":           s.UpdateThingV2(),
+		"DELETE /v2/thing/{uuid}":        s.DeleteThingV2(),
+		"GET /v2/thing/{uuid}/children":  s.ListChildrenV2(),
+		"GET /v2/thing/{uuid}/ancestors": s.ListAncestorsV2(),
+		"GET /v1/apikey":                 s.ListAPIKeys(),
+		"POST /v1/apikey/new":            s.CreateAPIKey(),
+		"GET /v1/apikey/{id}":            s.GetAPIKey(),
+		"POST /v1/apikey/{id}/rotate":    s.RotateAPIKey(),
+		"POST /v1/apikey/{id}/revoke":    s.RevokeAPIKey(),
+		"GET /v1/thing/{uuid}/acl":       s.GetThingACL(),
+		"PUT /v1/thing/{uuid}/acl":       s.SetThingACL(),
+		"GET /v2/thing/{uuid}/acl":       s.GetThingACLV2(),
+		"PUT /v2/thing/{uuid}/acl":       s.SetThingACLV2(),
+		"POST /v1/thing/{uuid}/share":    s.ShareThing(),
+		"POST /v2/thing/{uuid}/share":    s.ShareThingV2(),
+	}
+
+	spec, err := openAPISpec()
+	assert.NoError(t, err)
+
+	for route, handler := range handlers {
+		parts := strings.SplitN(route, " ", 2)
+		documented := spec.Paths.Find(parts[1]).GetOperation(parts[0])
+		generated, err := openapi.NewOperation(handler.Operation())
+		assert.NoError(t, err, route)
+
+		assert.ElementsMatch(t, parameters(documented.Parameters), parameters(generated.Parameters), route)
+
+		if documented.RequestBody == nil || generated.RequestBody == nil {
+			assert.Equal(t, documented.RequestBody == nil, generated.RequestBody == nil, route)
+		} else {
+			assert.Equal(t,
+				shape(documented.RequestBody.Value.Content.Get(httpx.MediaTypeJSON).Schema),
+				shape(generated.RequestBody.Value.Content.Get(httpx.MediaTypeJSON).Schema),
+				route,
+			)
+		}
+
+		for status, response := range generated.Responses {
+			if status == "default" {
+				continue
+			}
+			documentedResponse := documented.Responses[status]
+			if !assert.NotNil(t, documentedResponse, "%s %s", route, status) {
+				continue
+			}
+			var documentedSchema, generatedSchema *openapi3.SchemaRef
+			if content := documentedResponse.Value.Content.Get(httpx.MediaTypeJSON); content != nil {
+				documentedSchema = content.Schema
+			}
+			if content := response.Value.Content.Get(httpx.MediaTypeJSON); content != nil {
+				generatedSchema = content.Schema
+			}
+			assert.Equal(t, shape(documentedSchema), shape(generatedSchema), "%s %s", route, status)
+		}
+	}
+}
+
+func parameters(params openapi3.Parameters) []string {
+	var described []string
+	for _, p := range params {
+		described = append(described, fmt.Sprintf("%s %s %s required=%t", p.Value.In, p.Value.Name, p.Value.Schema.Value.Type, p.Value.Required))
+	}
+	return described
+}
+
+// shape describes the type of a schema and the types of its properties and items
+func shape(schema *openapi3.SchemaRef) interface{} {
+	if schema == nil || schema.Value == nil {
+		return nil
+	}
+	s := schema.Value
+	switch s.Type {
+	case openapi3.TypeArray:
+		return []interface{}{shape(s.Items)}
+	case openapi3.TypeObject:
+		if len(s.Properties) == 0 {
+			return s.Type
+		}
+		properties := map[string]interface{}{}
+		for name, property := range s.Properties {
+			properties[name] = shape(property)
+		}
+		required := append([]string{}, s.Required...)
+		sort.Strings(required)
+		return map[string]interface{}{"properties": properties, "required": required}
+	}
+	return s.Type
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+)
+
+// errQuotaExceeded is returned when a client creates a thing while it owns the maximum number of things
+var errQuotaExceeded = errors.New("the quota of things is exceeded")
+
+// quota limits the number of things every owner can create, things without owner are not limited.
+// The number of things is checked before a thing is created, concurrent creations can exceed it.
+type quota struct {
+	db.Service
+	max int
+}
+
+// check returns errQuotaExceeded when owner cannot create another thing
+func (q quota) check(ctx context.Context, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	n, err := q.Service.CountThings(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if n >= q.max {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+func (q quota) CreateThing(ctx context.Context, input db.ThingInput) (db.Thing, error) {
+	if err := q.check(ctx, input.Owner); err != nil {
+		return db.Thing{}, err
+	}
+	return q.Service.CreateThing(ctx, input)
+}
+
+// UpsertThing checks the quota when a thing is created, the owner of input is only set then
+func (q quota) UpsertThing(ctx context.Context, uuid string, input db.ThingInput) (db.Thing, bool, error) {
+	if err := q.check(ctx, input.Owner); err != nil {
+		return db.Thing{}, false, err
+	}
+	return q.Service.UpsertThing(ctx, uuid, input)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ldej/api-ldej-nl/pkg/ratelimit"
+)
+
+// RateLimitConfig configures the rate limits of clients, a client is an API key or principal, or the
+// IP address of unauthenticated requests
+type RateLimitConfig struct {
+	// Limit limits the requests of every client to all routes without a limit of their own
+	Limit ratelimit.Limit
+	// Routes limit the requests of every client to a route separately, routes are keyed by method and
+	// pattern like "POST /v1/thing/new" and gRPC methods by their full name like
+	// "/thing.v1.ThingService/CreateThing"
+	Routes map[string]ratelimit.Limit
+	// IPHeader is the header carrying the IP address of clients behind a proxy, like the
+	// X-Appengine-User-Ip header of App Engine, the remote address is used when empty
+	IPHeader string
+}
+
+// rateLimiter selects the token buckets of requests
+type rateLimiter struct {
+	limiter *ratelimit.Limiter
+	routes  map[string]*ratelimit.Limiter
+	key     ratelimit.Key
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{
+		routes: map[string]*ratelimit.Limiter{},
+		key:    ratelimit.ClientKey(config.IPHeader),
+	}
+	if config.Limit.Requests > 0 {
+		l.limiter = ratelimit.NewLimiter(config.Limit)
+	}
+	for route, limit := range config.Routes {
+		l.routes[route] = ratelimit.NewLimiter(limit)
+	}
+	return l
+}
+
+// route returns the limiter of route, nil when route is not limited
+func (l *rateLimiter) route(route string) *ratelimit.Limiter {
+	if limiter, ok := l.routes[route]; ok {
+		return limiter
+	}
+	return l.limiter
+}
+
+// rateLimit limits the requests of clients after they are authenticated, it passes all requests when
+// rate limiting is disabled
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return next
+	}
+	limited := map[*ratelimit.Limiter]http.Handler{nil: next}
+	if s.rateLimiter.limiter != nil {
+		limited[s.rateLimiter.limiter] = ratelimit.Middleware(s.rateLimiter.limiter, s.rateLimiter.key)(next)
+	}
+	for _, limiter := range s.rateLimiter.routes {
+		limited[limiter] = ratelimit.Middleware(limiter, s.rateLimiter.key)(next)
+	}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		limited[s.rateLimiter.route(s.route(r))].ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (s *Server) unaryRateLimit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.limitGRPC(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamRateLimit(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.limitGRPC(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// limitGRPC takes a call to method from the bucket of its client, the RateLimit headers are sent as
+// metadata and calls exceeding the limit fail with ResourceExhausted
+func (s *Server) limitGRPC(ctx context.Context, method string) error {
+	limiter := s.rateLimiter.route(method)
+	if limiter == nil {
+		return nil
+	}
+	result := limiter.Allow(s.rateLimiter.key(grpcRequest(ctx)))
+	header := http.Header{}
+	ratelimit.SetHeaders(header, result)
+	md := metadata.MD{}
+	for key, values := range header {
+		md.Set(key, values...)
+	}
+	grpc.SetHeader(ctx, md)
+	if !result.Allowed {
+		return status.Error(codes.ResourceExhausted, ratelimit.ErrRateLimited.Error())
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/ratelimit"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+)
+
+func TestRateLimit(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithRateLimits(RateLimitConfig{
+		Limit: ratelimit.Limit{Requests: 3, Period: time.Minute},
+		Routes: map[string]ratelimit.Limit{
+			"POST /v1/thing/new": {Requests: 1, Period: time.Minute},
+		},
+	}))
+	require.NoError(t, err)
+	key := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	other := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+
+	w := doAuthenticated(s, http.MethodPost, "/v1/thing/new", key, `{"name":"name","value":"value"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	w = doAuthenticated(s, http.MethodPost, "/v1/thing/new", key, `{"name":"name","value":"value"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// the route has a bucket of its own
+	for remaining := 2; remaining >= 0; remaining-- {
+		w = doAuthenticated(s, http.MethodGet, "/v1/thing/abc", key, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	}
+	w = doAuthenticated(s, http.MethodGet, "/v2/thing/abc", key, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	// every API key has its own bucket
+	w = doAuthenticated(s, http.MethodGet, "/v1/thing/abc", other, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	client := newGRPCClient(t, fake, WithRateLimits(RateLimitConfig{
+		Routes: map[string]ratelimit.Limit{
+			"/thing.v1.ThingService/GetThing": {Requests: 1, Period: time.Minute},
+		},
+	}))
+
+	var header metadata.MD
+	_, err := client.GetThing(context.Background(), &thingpb.GetThingRequest{Uuid: "abc"}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0"}, header.Get("ratelimit-remaining"))
+
+	_, err = client.GetThing(context.Background(), &thingpb.GetThingRequest{Uuid: "abc"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, header.Get("retry-after"))
+
+	// methods without a limit are not limited
+	_, err = client.ListThings(context.Background(), &thingpb.ListThingsRequest{})
+	assert.NoError(t, err)
+}
+
+func TestThingQuota(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithThingQuota(2))
+	require.NoError(t, err)
+	key := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	other := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+
+	for i := 0; i < 2; i++ {
+		w := doAuthenticated(s, http.MethodPost, "/v2/thing", key, `{"name":"name","value":"value"}`)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	w := doAuthenticated(s, http.MethodPost, "/v2/thing", key, `{"name":"name","value":"value"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), errQuotaExceeded.Error())
+	w = doAuthenticated(s, http.MethodPut, "/v2/thing/"+db.RandomID(), key, `{"name":"name","value":"value"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	// existing things can still be updated
+	w = doAuthenticated(s, http.MethodPut, "/v2/thing/"+fake.things[0].UUID, key, `{"value":"changed"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doAuthenticated(s, http.MethodPost, "/v2/thing", other, `{"name":"name","value":"value"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+// schemaCache caches compiled kind schemas by their URL and content, a kind that is deleted and created
+// again restarts at version 1 with another schema
+type schemaCache struct {
+	mu      sync.RWMutex
+	schemas map[string]*jsonschema.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{schemas: map[string]*jsonschema.Schema{}}
+}
+
+// get returns the compiled schema of the latest version of kind
+func (c *schemaCache) get(kind db.Kind) (*jsonschema.Schema, error) {
+	url := schemaURL(kind.Name, kind.Version)
+	key := fmt.Sprintf("%s#%x", url, sha256.Sum256(kind.Schema))
+
+	c.mu.RLock()
+	schema, ok := c.schemas[key]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := compileSchema(url, kind.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.schemas[key] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+func schemaURL(kind string, version int) string {
+	return fmt.Sprintf("https://api.ldej.nl/kind/%s/schema/%d", kind, version)
+}
+
+// compileSchema compiles a JSON Schema, references to other documents are not resolved
+func compileSchema(url string, schema []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("loading %s is not allowed", s)
+	}
+	if err := compiler.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, &httpx.ValidationError{Message: "invalid schema: " + err.Error()}
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, &httpx.ValidationError{Message: "invalid schema: " + err.Error()}
+	}
+	return compiled, nil
+}
+
+// validateData validates data against schema, the returned field errors point into the request body at prefix
+func validateData(schema *jsonschema.Schema, data []byte, prefix string) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return &httpx.ValidationError{Message: "invalid data"}
+	}
+
+	err := schema.Validate(v)
+	var schemaErr *jsonschema.ValidationError
+	if errors.As(err, &schemaErr) {
+		return &httpx.ValidationError{
+			Message: "data does not match the schema of its kind",
+			Fields:  fieldErrors(schemaErr, prefix),
+		}
+	}
+	return err
+}
+
+// fieldErrors flattens the tree of schema validation errors into the errors of the individual fields
+func fieldErrors(err *jsonschema.ValidationError, prefix string) []httpx.FieldError {
+	if len(err.Causes) == 0 {
+		return []httpx.FieldError{{Field: prefix + err.InstanceLocation, Message: err.Message}}
+	}
+	var fields []httpx.FieldError
+	for _, cause := range err.Causes {
+		fields = append(fields, fieldErrors(cause, prefix)...)
+	}
+	return fields
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+const portSchema = `{
+	"type": "object",
+	"properties": {
+		"host": {"type": "string"},
+		"port": {"type": "integer", "maximum": 65535}
+	},
+	"required": ["host", "port"]
+}`
+
+func TestValidateData(t *testing.T) {
+	schemas := newSchemaCache()
+	schema, err := schemas.get(db.Kind{Name: "config", Version: 1, Schema: db.JSON(portSchema)})
+	assert.NoError(t, err)
+
+	assert.NoError(t, validateData(schema, []byte(`{"host": "localhost", "port": 8080}`), "/data"))
+
+	err = validateData(schema, []byte(`{"port": 80000}`), "/data")
+	var validationErr *httpx.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.ElementsMatch(t, []string{"/data", "/data/port"}, fieldNames(validationErr.Fields))
+}
+
+func TestCompileSchemaInvalid(t *testing.T) {
+	_, err := compileSchema(schemaURL("config", 1), []byte(`{"type": 1}`))
+	var validationErr *httpx.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+
+	_, err = compileSchema(schemaURL("config", 1), []byte(`{"$ref": "file:///etc/passwd"}`))
+	assert.Error(t, err)
+}
+
+func fieldNames(fields []httpx.FieldError) []string {
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Field)
+	}
+	return names
+}
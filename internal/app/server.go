@@ -2,9 +2,9 @@ package app
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,46 +14,357 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-playground/validator/v10"
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 
 	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/blob"
+	"github.com/ldej/api-ldej-nl/pkg/health"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
 	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/metrics"
+	"github.com/ldej/api-ldej-nl/pkg/openapi"
+	"github.com/ldej/api-ldej-nl/pkg/sharelink"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+	"github.com/ldej/api-ldej-nl/pkg/tracing"
+	"github.com/ldej/api-ldej-nl/swagger"
 )
 
 type Server struct {
 	router   *chi.Mux
+	grpc     *grpc.Server
+	graphql  graphql.Schema
 	log      *log.Logger
 	db       db.Service
+	blobs    blob.Store
 	validate *validator.Validate
+	api      *httpx.Config
+	schemas  *schemaCache
+	openAPI  *openapi.Validator
 	stopCh   chan os.Signal
+
+	// authenticator authenticates requests, nil when authentication is disabled
+	authenticator auth.Authenticator
+	// tenants resolve the tenant of requests, nil when all requests use the default tenant
+	tenants []tenant.Resolver
+	// rateLimiter limits the requests of clients, nil when rate limiting is disabled
+	rateLimiter *rateLimiter
+	// shareLinks signs and verifies share links, nil when share links are disabled
+	shareLinks *sharelink.Signer
+	// cacheDirectives are the Cache-Control directives of routes
+	cacheDirectives map[string]string
+	// health checks the dependencies of the server for its readiness
+	health *health.Checker
+	// shutdownDrain is how long the server keeps serving while unready before it shuts down
+	shutdownDrain time.Duration
+	// metrics collects the metrics served on /metrics, nil when metrics are disabled
+	metrics *metrics.Metrics
+	// tracer starts the spans of requests, nil when tracing is disabled
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	maxBodySize int64
+}
+
+// defaultMaxBodySize is the maximum size of request bodies, attachments have their own limit
+const defaultMaxBodySize = 1 << 20
+
+// readinessTimeout is the time every readiness check is given
+const readinessTimeout = 2 * time.Second
+
+type options struct {
+	validateRequests  bool
+	validateResponses bool
+	maxBodySize       int64
+	authentication    bool
+	authenticators    []auth.Authenticator
+	tenants           []tenant.Resolver
+	rateLimits        *RateLimitConfig
+	thingQuota        int
+	shareLinks        *sharelink.Signer
+	cacheDirectives   map[string]string
+	shutdownDrain     time.Duration
+	metrics           bool
+	tracerProvider    trace.TracerProvider
+	// backend is the name of the database in metrics and spans
+	backend string
+}
+
+type Option func(*options)
+
+// WithOpenAPIValidation validates requests against the OpenAPI specification generated in swagger/,
+// when validateResponses is set the responses are validated and mismatches are logged as well
+func WithOpenAPIValidation(validateResponses bool) Option {
+	return func(o *options) {
+		o.validateRequests = true
+		o.validateResponses = validateResponses
+	}
+}
+
+// WithMaxBodySize limits request bodies to n bytes instead of 1 MiB, larger bodies are rejected
+// with 413 Request Entity Too Large
+func WithMaxBodySize(n int64) Option {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// WithAuthentication requires requests to be authenticated with an API key granting the scope of
+// the route, the OpenAPI specification, the Swagger UI and the API key routes with the apikeys:manage
+// scope excepted
+func WithAuthentication() Option {
+	return func(o *options) {
+		o.authentication = true
+	}
+}
+
+// WithJWTAuthentication enables authentication like WithAuthentication and accepts JSON Web Tokens
+// issued by an OpenID Connect provider next to API keys
+func WithJWTAuthentication(config auth.JWTConfig) Option {
+	return func(o *options) {
+		o.authentication = true
+		o.authenticators = append(o.authenticators, auth.NewJWTAuthenticator(config))
+	}
+}
+
+// WithTenancy requires requests to belong to the tenant resolved by resolvers, which must agree on it.
+// The things of every tenant are stored separately, kinds and API keys are shared. Authenticated
+// requests must be bound to the tenant by their credentials, by the tenant of their API key or by a
+// tenant.Claim of their token.
+func WithTenancy(resolvers ...tenant.Resolver) Option {
+	return func(o *options) {
+		o.tenants = append(o.tenants, resolvers...)
+	}
 }
 
-func NewServer(logger *log.Logger, db db.Service) (*Server, error) {
+// WithRateLimits limits the rate of requests of every client with token buckets, requests exceeding
+// the limit are answered with 429 Too Many Requests
+func WithRateLimits(config RateLimitConfig) Option {
+	return func(o *options) {
+		o.rateLimits = &config
+	}
+}
+
+// WithThingQuota limits the number of things every principal can own to n, creating more things
+// is answered with 429 Too Many Requests
+func WithThingQuota(n int) Option {
+	return func(o *options) {
+		o.thingQuota = n
+	}
+}
+
+// WithShareLinks enables share links signed by signer, which grant read access to a single thing
+// without credentials
+func WithShareLinks(signer *sharelink.Signer) Option {
+	return func(o *options) {
+		o.shareLinks = signer
+	}
+}
+
+// WithCacheControl sets the Cache-Control header of successful responses to routes, keyed by method
+// and pattern like "GET /v1/thing/{uuid}", to their directives like "private, max-age=60". The responses
+// vary by the Authorization header and the tenant header of WithTenancy.
+func WithCacheControl(routes map[string]string) Option {
+	return func(o *options) {
+		o.cacheDirectives = routes
+	}
+}
+
+// WithShutdownDrain keeps serving requests for d after a shutdown is requested while /readyz reports
+// the server as unready, so load balancers stop routing requests to it before it stops
+func WithShutdownDrain(d time.Duration) Option {
+	return func(o *options) {
+		o.shutdownDrain = d
+	}
+}
+
+// WithMetrics serves Prometheus metrics of the requests, the database operations labeled with backend,
+// the Go runtime and the build on /metrics
+func WithMetrics(backend string) Option {
+	return func(o *options) {
+		o.metrics = true
+		o.backend = backend
+	}
+}
+
+// WithTracing traces requests and the database operations of backend with spans of provider, which
+// continue the traces of callers propagated with traceparent or X-Cloud-Trace-Context
+func WithTracing(provider trace.TracerProvider, backend string) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+		o.backend = backend
+	}
+}
+
+func NewServer(logger *log.Logger, db db.Service, blobs blob.Store, opts ...Option) (*Server, error) {
 	s := &Server{
 		log:      logger,
-		db:       db,
+		blobs:    blobs,
 		validate: validator.New(),
+		schemas:  newSchemaCache(),
 		stopCh:   make(chan os.Signal, 1),
 	}
+	s.api = &httpx.Config{
+		PathParam: chi.URLParam,
+		Validate:  s.validateRequest,
+		Status:    errorStatus,
+	}
+
+	options := options{maxBodySize: defaultMaxBodySize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s.maxBodySize = options.maxBodySize
+	if options.metrics {
+		s.metrics = metrics.New()
+	}
+	if options.tracerProvider != nil {
+		s.tracer = options.tracerProvider.Tracer("github.com/ldej/api-ldej-nl/internal/app")
+		s.propagator = tracing.Propagator()
+	}
+	if s.metrics != nil || s.tracer != nil {
+		db = instrumentedDB{service: db, backend: options.backend, metrics: s.metrics, tracer: s.tracer}
+	}
+	s.db = accessControl{Service: db}
+	if options.thingQuota > 0 {
+		s.db = accessControl{Service: quota{Service: db, max: options.thingQuota}}
+	}
+	if options.rateLimits != nil {
+		s.rateLimiter = newRateLimiter(*options.rateLimits)
+	}
+	if options.tenants != nil {
+		// API keys are bound to the tenant they are issued for
+		s.tenants = append(options.tenants, tenant.Claim(tenant.KeyClaim))
+	}
+	s.shareLinks = options.shareLinks
+	s.cacheDirectives = options.cacheDirectives
+	s.shutdownDrain = options.shutdownDrain
+	s.health = health.NewChecker(readinessTimeout, logger)
+	s.health.Add("db", s.db.Ping)
+	if options.authentication {
+		s.authenticator = auth.Chain(append([]auth.Authenticator{apiKeyAuthenticator{db: db}}, options.authenticators...)...)
+	}
+	if options.validateRequests {
+		openAPI, err := s.newOpenAPIValidator(options.validateResponses)
+		if err != nil {
+			return nil, err
+		}
+		s.openAPI = openAPI
+	}
+
+	graphqlSchema, err := s.newGraphQLSchema()
+	if err != nil {
+		return nil, err
+	}
+	s.graphql = graphqlSchema
 	s.Routes()
+	s.grpc = s.newGRPCServer()
 	return s, nil
 }
 
 func (s *Server) Routes() {
 	s.router = chi.NewRouter()
 	s.router.Use(s.log.Tracer)
+	s.router.Use(s.trace)
+	s.router.Use(s.instrument)
 	s.router.Use(middleware.Recoverer)
 	s.router.Use(middleware.Timeout(60 * time.Second))
+	s.router.Use(httpx.MaxBodySize(s.maxBodySize))
+	s.router.Use(s.cacheControl)
+
+	s.router.Get("/healthz", s.health.Live)
+	s.router.Get("/readyz", s.health.Ready)
+	if s.metrics != nil {
+		s.router.Handle("/metrics", s.metrics.Handler())
+	}
+	s.router.Get("/openapi.json", s.OpenAPI)
+	s.router.Get("/swagger", http.RedirectHandler("/swagger/", http.StatusMovedPermanently).ServeHTTP)
+	s.router.Handle("/swagger/*", http.StripPrefix("/swagger", http.FileServer(http.FS(swagger.UI))))
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.authenticate)
+		r.Use(s.rateLimit)
+		if s.openAPI != nil {
+			r.Use(s.openAPI.Middleware)
+		}
 
-	s.router.Handle("/swagger/*", http.StripPrefix("/swagger", http.FileServer(http.Dir("swagger"))))
+		r.Route("/v1", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(s.resolveTenant)
+				s.v1Routes(r)
+				s.aclRoutes(r)
+				s.shareRoutes(r, s.ShareThing())
+			})
+			s.apiKeyRoutes(r)
+		})
+		r.Route("/v2", func(r chi.Router) {
+			r.Use(s.resolveTenant)
+			s.v2Routes(r)
+			s.shareRoutes(r, s.ShareThingV2())
+		})
+
+		// the routes from before the API was versioned
+		r.Group(func(r chi.Router) {
+			r.Use(s.deprecated)
+			r.Use(s.resolveTenant)
+			s.v1Routes(r)
+		})
+	})
+
+	// a GraphQL batch is a JSON array which cannot be described next to a single request in
+	// Swagger 2.0, GraphQL documents are validated against the GraphQL schema instead
+	s.router.Group(func(r chi.Router) {
+		if s.authenticator != nil {
+			r.Use(auth.Middleware(s.authenticator))
+		}
+		r.Use(s.rateLimit)
+		r.Use(s.requireScope(ScopeThingsRead))
+		r.Use(s.resolveTenant)
+		r.Post("/graphql", s.GraphQL)
+	})
+}
 
-	s.router.Get("/thing", s.ListThings)
-	s.router.Post("/thing/new", s.CreateThing)
-	s.router.Get("/thing/{uuid}", s.GetThing)
-	s.router.Put("/thing/{uuid}", s.UpdateThing)
-	s.router.Delete("/thing/{uuid}", s.DeleteThing)
+// requireScope answers requests without scope with 403 Forbidden, it passes all requests when
+// authentication is disabled
+func (s *Server) requireScope(scope string) func(http.Handler) http.Handler {
+	if s.authenticator == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return auth.RequireScope(scope)
 }
 
-func (s *Server) ListenAndServe(addr string) {
+// resolveTenant adds the tenant of requests to their context, it passes all requests when tenancy is
+// disabled and requests made with a share link, which carry the tenant of the link
+func (s *Server) resolveTenant(next http.Handler) http.Handler {
+	if s.tenants == nil {
+		return next
+	}
+	resolved := tenant.Middleware(s.tenants...)(next)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := sharedThing(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		resolved.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// authorize returns an error when the principal of ctx is not granted scope and authentication is enabled
+func (s *Server) authorize(ctx context.Context, scope string) error {
+	if s.authenticator == nil {
+		return nil
+	}
+	return auth.Authorize(ctx, scope)
+}
+
+// ListenAndServe serves the REST API on addr and the gRPC API on grpcAddr, gRPC is disabled when grpcAddr is empty
+func (s *Server) ListenAndServe(addr string, grpcAddr string) {
 	ctx := context.Background()
 
 	signal.Notify(s.stopCh, syscall.SIGINT, syscall.SIGTERM)
@@ -67,7 +378,26 @@ func (s *Server) ListenAndServe(addr string) {
 		}
 	}()
 
+	if grpcAddr != "" {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			s.log.Fatal(ctx, err)
+		}
+		go func() {
+			s.log.Info(ctx, fmt.Sprintf("Listening for gRPC on: %s", grpcAddr))
+
+			if err := s.grpc.Serve(lis); err != nil {
+				s.log.Fatal(ctx, err)
+			}
+		}()
+	}
+
 	<-s.stopCh
+	s.health.Drain()
+	if s.shutdownDrain > 0 {
+		s.log.Info(ctx, fmt.Sprintf("Draining for %s...", s.shutdownDrain))
+		time.Sleep(s.shutdownDrain)
+	}
 	s.log.Info(ctx, "Shutting down the server...")
 
 	ctxTimeout, cancel := context.WithTimeout(context.Background(), 8*time.Second)
@@ -76,19 +406,50 @@ func (s *Server) ListenAndServe(addr string) {
 	if err := hs.Shutdown(ctxTimeout); err != nil {
 		s.log.Fatal(ctx, err)
 	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctxTimeout.Done():
+		s.grpc.Stop()
+	}
 }
 
 func (s *Server) Shutdown() {
 	s.stopCh <- os.Interrupt
 }
 
+// parseJSON strictly decodes the body of r according to its Content-Type into dst and validates it
 func (s *Server) parseJSON(r *http.Request, dst interface{}) error {
-	err := json.NewDecoder(r.Body).Decode(dst)
-	if err != nil {
-		return errors.New("invalid json body")
+	if err := httpx.Decode(r, dst); err != nil {
+		return err
 	}
 	if err := s.validate.Struct(dst); err != nil {
 		return errors.New("invalid data")
 	}
 	return nil
 }
+
+// validateRequest validates a request bound by a typed handler
+func (s *Server) validateRequest(v interface{}) error {
+	if err := s.validate.Struct(v); err != nil {
+		return &httpx.ValidationError{Message: "invalid data"}
+	}
+	return nil
+}
+
+// abortInvalidBody aborts with the status matching an error of parseJSON
+func abortInvalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case httpx.ErrMissingContentType, httpx.ErrUnsupportedMediaType:
+		httpx.AbortJSON(w, r, http.StatusUnsupportedMediaType, err)
+	case httpx.ErrBodyTooLarge:
+		httpx.AbortJSON(w, r, http.StatusRequestEntityTooLarge, err)
+	default:
+		httpx.AbortJSON(w, r, http.StatusBadRequest, err)
+	}
+}
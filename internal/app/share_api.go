@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/sharelink"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+// defaultShareLinkExpiry is the lifetime of share links without ExpiresIn
+const defaultShareLinkExpiry = 24 * time.Hour
+
+// errShareLinksDisabled is returned when a share link is created without signing keys
+var errShareLinksDisabled = errors.New("share links are not enabled")
+
+type ShareThing struct {
+	// ExpiresIn is the lifetime of the link in seconds, one day by default and at most 30 days
+	ExpiresIn int `json:"expiresIn" validate:"omitempty,min=1,max=2592000"`
+	// MaxUses is the number of times the link can be used, unlimited by default
+	MaxUses int `json:"maxUses" validate:"omitempty,min=1"`
+}
+
+type ShareLinkResponse struct {
+	// URL is the path and query of the link, relative to the API
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+	MaxUses int       `json:"maxUses,omitempty"`
+}
+
+type shareThingRequest struct {
+	UUID string `path:"uuid"`
+	Body ShareThing
+}
+
+// ShareThing godoc
+// @Summary Create a share link
+// @Description Create a signed link granting read access to a thing without credentials until it expires,
+// @Description or until it is used maxUses times. Writing a thing is required to share it.
+// @ID share-thing
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param Body body ShareThing true "The expiry and uses of the link"
+// @Success 201 {object} ShareLinkResponse
+// @Failure 400,401,403,404,413,415,500,501 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/share [post]
+func (s *Server) ShareThing() *httpx.Handler[shareThingRequest, ShareLinkResponse] {
+	return s.shareThing("/v1")
+}
+
+// ShareThingV2 godoc
+// @Summary Create a share link
+// @Description Create a signed link granting read access to a thing without credentials until it expires,
+// @Description or until it is used maxUses times. Writing a thing is required to share it.
+// @ID share-thing-v2
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param Body body ShareThing true "The expiry and uses of the link"
+// @Success 201 {object} ShareLinkResponse
+// @Failure 400,401,403,404,413,415,500,501 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid}/share [post]
+func (s *Server) ShareThingV2() *httpx.Handler[shareThingRequest, ShareLinkResponse] {
+	return s.shareThing("/v2")
+}
+
+// shareThing creates links to the thing route of version
+func (s *Server) shareThing(version string) *httpx.Handler[shareThingRequest, ShareLinkResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req shareThingRequest) (ShareLinkResponse, error) {
+		if s.shareLinks == nil {
+			return ShareLinkResponse{}, errShareLinksDisabled
+		}
+		thing, err := s.db.GetThing(ctx, req.UUID)
+		if err != nil {
+			return ShareLinkResponse{}, err
+		}
+		if err := checkAccess(ctx, thing, db.WriteAccess); err != nil {
+			return ShareLinkResponse{}, err
+		}
+
+		expiresIn := defaultShareLinkExpiry
+		if req.Body.ExpiresIn > 0 {
+			expiresIn = time.Duration(req.Body.ExpiresIn) * time.Second
+		}
+		link := sharelink.Link{
+			ID:      db.RandomID(),
+			Path:    version + "/thing/" + thing.UUID,
+			Expires: time.Now().Add(expiresIn).Truncate(time.Second).UTC(),
+			MaxUses: req.Body.MaxUses,
+			Tenant:  tenant.FromContext(ctx),
+		}
+		return ShareLinkResponse{
+			URL:     s.shareLinks.Sign(link),
+			Expires: link.Expires,
+			MaxUses: link.MaxUses,
+		}, nil
+	}, httpx.WithStatus(http.StatusCreated))
+}
+
+// shareRoutes create share links, they were added after the unversioned routes were deprecated
+func (s *Server) shareRoutes(r chi.Router, handler *httpx.Handler[shareThingRequest, ShareLinkResponse]) {
+	r.With(s.requireScope(ScopeThingsWrite)).Post("/thing/{uuid}/share", handler.ServeHTTP)
+}
+
+type sharedThingKey struct{}
+
+// sharedThing returns the uuid of the thing a share link grants ctx read access to
+func sharedThing(ctx context.Context) (string, bool) {
+	uuid, ok := ctx.Value(sharedThingKey{}).(string)
+	return uuid, ok
+}
+
+// authenticate authenticates requests with their credentials, or with the share link they are made
+// with when share links are enabled. It passes all requests without a share link when authentication
+// is disabled.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	authenticated := next
+	if s.authenticator != nil {
+		authenticated = auth.Middleware(s.authenticator)(next)
+	}
+	if s.shareLinks == nil {
+		return authenticated
+	}
+	shared := s.verifyShareLink(next)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if sharelink.Signed(r) {
+			shared.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// verifyShareLink authenticates requests made with a share link as the link, which is granted read
+// access to its thing in its tenant. Invalid links are answered with 401 Unauthorized, expired and
+// used up links with 403 Forbidden.
+func (s *Server) verifyShareLink(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		link, err := s.shareLinks.Verify(r)
+		switch {
+		case err == sharelink.ErrExpired:
+			httpx.AbortJSON(w, r, http.StatusForbidden, err)
+			return
+		case err != nil:
+			httpx.AbortJSON(w, r, http.StatusUnauthorized, err)
+			return
+		}
+
+		if link.MaxUses > 0 {
+			err := s.db.UseShareLink(ctx, link.ID, link.MaxUses, link.Expires)
+			if err == db.ErrShareLinkUsedUp {
+				httpx.AbortJSON(w, r, http.StatusForbidden, err)
+				return
+			}
+			if err != nil {
+				httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		principal := auth.Principal{ID: "link:" + link.ID, Scopes: []string{ScopeThingsRead}}
+		ctx = context.WithValue(auth.NewContext(ctx, principal), sharedThingKey{}, path.Base(link.Path))
+		ctx = log.With(tenant.NewContext(ctx, link.Tenant), log.KV("principal", principal.ID), log.KV("tenant", link.Tenant))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/sharelink"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+func newSigner(t *testing.T, id string) *sharelink.Signer {
+	signer, err := sharelink.NewSigner(sharelink.Key{ID: id, Secret: bytes.Repeat([]byte(id), 32)})
+	require.NoError(t, err)
+	return signer
+}
+
+func TestShareLinks(t *testing.T) {
+	fake := &fakeDB{}
+	signer := newSigner(t, "1")
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithShareLinks(signer), WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	owner := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	reader := issueAPIKey(t, fake, ScopeThingsRead, ScopeThingsWrite)
+	readerID := principalID(reader)
+
+	w := doAuthenticated(s, http.MethodPost, "/v1/thing/new", owner, `{"name":"private","value":"value"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created ThingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	thing := "/v1/thing/" + created.UUID
+	w = doAuthenticated(s, http.MethodPut, thing+"/acl", owner, `{"grants":[{"principal":"`+readerID+`","level":"read"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doAuthenticated(s, http.MethodPost, thing+"/share", owner, `{"maxUses":2}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var link ShareLinkResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.True(t, strings.HasPrefix(link.URL, thing+"?"), link.URL)
+	assert.Equal(t, 2, link.MaxUses)
+
+	for i := 0; i < 2; i++ {
+		w = doAuthenticated(s, http.MethodGet, link.URL, "", "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"name":"private"`)
+	}
+	w = doAuthenticated(s, http.MethodGet, link.URL, "", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), db.ErrShareLinkUsedUp.Error())
+
+	w = doAuthenticated(s, http.MethodPost, thing+"/share", owner, `{}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	query := link.URL[strings.Index(link.URL, "?"):]
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		code   int
+	}{
+		{"unlimited", http.MethodGet, link.URL, http.StatusOK},
+		{"v2 route", http.MethodGet, "/v2/thing/" + created.UUID + query, http.StatusUnauthorized},
+		{"other route", http.MethodGet, thing + "/acl" + query, http.StatusUnauthorized},
+		{"write", http.MethodDelete, link.URL, http.StatusUnauthorized},
+		{"tampered", http.MethodGet, strings.Replace(link.URL, "kid=1", "kid=2", 1), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doAuthenticated(s, test.method, test.target, "", "")
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+		})
+	}
+
+	w = doAuthenticated(s, http.MethodPost, thing+"/share", reader, `{}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = doAuthenticated(s, http.MethodPost, thing+"/share", owner, `{"expiresIn":0,"maxUses":-1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// removing the signing key revokes its links
+	rotated, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithShareLinks(newSigner(t, "2")))
+	require.NoError(t, err)
+	w = doAuthenticated(rotated, http.MethodGet, link.URL, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	disabled, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication())
+	require.NoError(t, err)
+	w = doAuthenticated(disabled, http.MethodPost, thing+"/share", owner, `{}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code, w.Body.String())
+	w = doAuthenticated(disabled, http.MethodGet, link.URL, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+}
+
+func TestShareLinkTenant(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithShareLinks(newSigner(t, "1")), WithTenancy(tenant.Header("X-Tenant")))
+	require.NoError(t, err)
+	key := issueTenantAPIKey(t, fake, "acme", ScopeThingsRead, ScopeThingsWrite)
+	fake.things[0].Owner = principalID(key)
+
+	r := httptest.NewRequest(http.MethodPost, "/v2/thing/abc/share", strings.NewReader(`{}`))
+	r.Header.Set("Authorization", "Bearer "+key)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var link ShareLinkResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	fake.tenant = ""
+	w = doAuthenticated(s, http.MethodGet, link.URL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "acme", fake.tenant)
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+)
+
+func TestTenancy(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithAuthentication(), WithTenancy(tenant.Header("X-Tenant")))
+	require.NoError(t, err)
+	key := issueTenantAPIKey(t, fake, "acme", ScopeThingsRead, ScopeAPIKeysManage)
+	unbound := issueAPIKey(t, fake, ScopeThingsRead)
+
+	for _, target := range []string{"/v1/thing/abc", "/v2/thing/abc", "/thing/abc"} {
+		// the tenant of the key is used without header
+		fake.tenant = ""
+		w := doAuthenticated(s, http.MethodGet, target, key, "")
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, "acme", fake.tenant, target)
+
+		w = doTenant(s, target, key, "acme")
+		assert.Equal(t, http.StatusOK, w.Code, target)
+
+		// the key cannot access the things of other tenants
+		w = doTenant(s, target, key, "globex")
+		assert.Equal(t, http.StatusForbidden, w.Code, target)
+
+		// a key without tenant cannot access the things of any tenant
+		w = doTenant(s, target, unbound, "acme")
+		assert.Equal(t, http.StatusForbidden, w.Code, target)
+		w = doAuthenticated(s, http.MethodGet, target, unbound, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doTenant(s, "/v1/thing/abc", key, "Acme Inc").Code)
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ thing(uuid: \"abc\") { name } }"}`))
+	r.Header.Set("Authorization", "Bearer "+unbound)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/new", key, `{"name":"ci","scopes":["things:read"],"tenant":"Acme Inc"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = doAuthenticated(s, http.MethodPost, "/v1/apikey/new", key, `{"name":"ci","scopes":["things:read"],"tenant":"globex"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created IssuedAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "globex", created.Tenant)
+	assert.Equal(t, http.StatusOK, doTenant(s, "/v1/thing/abc", created.Key, "globex").Code)
+
+	// API keys are managed for all tenants
+	w = doAuthenticated(s, http.MethodGet, "/v1/apikey", key, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func doTenant(s *Server, target string, key string, tenant string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Authorization", "Bearer "+key)
+	r.Header.Set("X-Tenant", tenant)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestGRPCTenancy(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	client := newGRPCClient(t, fake, WithTenancy(tenant.Header("X-Tenant")))
+
+	_, err := client.GetThing(context.Background(), &thingpb.GetThingRequest{Uuid: "abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "acme")
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", fake.tenant)
+}
@@ -1,140 +1,254 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 
 	"github.com/ldej/api-ldej-nl/internal/app/db"
 	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
 )
 
 type ThingResponse struct {
-	UUID  string `json:"uuid"`
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	UUID   string            `json:"uuid"`
+	Name   string            `json:"name"`
+	Value  string            `json:"value"`
+	Labels map[string]string `json:"labels"`
+	Parent string            `json:"parent,omitempty"`
+
+	Kind        string          `json:"kind,omitempty"`
+	KindVersion int             `json:"kindVersion,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+
+	// Owner is the principal which created the thing
+	Owner string `json:"owner,omitempty"`
 
 	Updated time.Time `json:"updated"`
 	Created time.Time `json:"created"`
 }
 
+// Version of a thing changes whenever it is updated, it is the same in every encoding
+func (t ThingResponse) Version() (httpx.ETag, time.Time) {
+	return httpx.WeakETag(t.UUID, t.Updated.UTC().Format(time.RFC3339Nano)), t.Updated
+}
+
+type thingRequest struct {
+	UUID string `path:"uuid"`
+}
+
 // GetThing godoc
 // @Summary Get a thing
 // @Description get thing by uuid
 // @ID get-thing-by-uuid
 // @Tags Thing
+// @Produce json,application/yaml,application/msgpack
 // @Param uuid path string true "UUID"
 // @Success 200 {object} ThingResponse
-// @Failure 404,500 {object} httpx.ErrorResponse
-// @Router /thing/{uuid} [get]
-func (s *Server) GetThing(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	uuid := chi.URLParam(r, "uuid")
-
-	thing, err := s.db.GetThing(ctx, uuid)
-	if err == db.ErrThingNotFound {
-		httpx.AbortJSON(w, r, http.StatusNotFound, err)
-		return
-	}
-	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
-		return
-	}
-	httpx.JSON(w, r, thingToThingResponse(thing))
+// @Success 304 "Not Modified"
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid} [get]
+func (s *Server) GetThing() *httpx.Handler[thingRequest, ThingResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req thingRequest) (ThingResponse, error) {
+		thing, err := s.db.GetThing(ctx, req.UUID)
+		if err != nil {
+			return ThingResponse{}, err
+		}
+		return thingToThingResponse(thing), nil
+	})
 }
 
 type CreateThing struct {
-	Name  string `json:"name" validate:"required"`
-	Value string `json:"value" validate:"required"`
+	Name   string            `json:"name" validate:"required"`
+	Value  string            `json:"value"`
+	Labels map[string]string `json:"labels"`
+	// Kind is optional, a thing of a kind has data matching the schema of the kind instead of a value
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+	// Parent is the uuid of the parent thing, the thing is created at the root when omitted
+	Parent string `json:"parent"`
+}
+
+type createThingRequest struct {
+	Body CreateThing
 }
 
 // CreateThing godoc
 // @Summary Create a thing
-// @Description Create a thing
+// @Description Create a thing, a thing without a kind requires a value, a thing with a kind requires data matching the schema of the kind
 // @ID create-thing
 // @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
 // @Param Body body CreateThing true "The body to create a thing"
 // @Success 200 {object} ThingResponse
-// @Failure 404,500 {object} httpx.ErrorResponse
-// @Router /thing/new [post]
-func (s *Server) CreateThing(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	var thingToCreate CreateThing
-	err := s.parseJSON(r, &thingToCreate)
-	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusBadRequest, err)
-		return
-	}
+// @Failure 400,401,403,413,415,429,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/new [post]
+func (s *Server) CreateThing() *httpx.Handler[createThingRequest, ThingResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req createThingRequest) (ThingResponse, error) {
+		createdThing, err := s.createThing(ctx, req.Body)
+		if err != nil {
+			return ThingResponse{}, err
+		}
+		return thingToThingResponse(createdThing), nil
+	})
+}
 
-	createdThing, err := s.db.CreateThing(ctx, thingToCreate.Name, thingToCreate.Value)
+func (s *Server) createThing(ctx context.Context, thingToCreate CreateThing) (db.Thing, error) {
+	input, err := s.thingInput(
+		ctx,
+		thingToCreate.Kind,
+		thingToCreate.Name,
+		thingToCreate.Value,
+		thingToCreate.Data,
+		thingToCreate.Labels,
+	)
 	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
-		return
+		return db.Thing{}, err
 	}
+	input.ParentUUID = &thingToCreate.Parent
 
-	httpx.JSON(w, r, thingToThingResponse(createdThing))
+	return s.db.CreateThing(ctx, input)
 }
 
 type UpdateThing struct {
-	Value string `json:"value" validate:"required"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Labels replace the labels of the thing, they are kept when omitted
+	Labels map[string]string `json:"labels"`
+	// Kind is used when the thing is created, it cannot be changed
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+	// Parent moves the thing below another thing, an empty string moves it to the root, it is kept when omitted
+	Parent *string `json:"parent"`
+}
+
+type updateThingRequest struct {
+	UUID string `path:"uuid"`
+	Body UpdateThing
+}
+
+// upsertedThing is answered with 201 Created when the thing was created
+type upsertedThing struct {
+	ThingResponse
+	created bool
+}
+
+func (u upsertedThing) StatusCode() int {
+	if u.created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
 }
 
 // UpdateThing godoc
-// @Summary Update a thing
-// @Description Update a thing
+// @Summary Update or create a thing
+// @Description Update a thing, or create it with the given uuid when it does not exist yet.
+// @Description Creating a thing requires a name, without one a 404 is returned for a thing that does not exist.
 // @ID update-thing
 // @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
 // @Param uuid path string true "UUID"
-// @Param Body body UpdateThing true "The body to update a thing"
-// @Success 200 {object} ThingResponse
-// @Failure 404,500 {object} httpx.ErrorResponse
-// @Router /thing/{uuid} [put]
-func (s *Server) UpdateThing(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	uuid := chi.URLParam(r, "uuid")
-
-	var thingToUpdate UpdateThing
-	err := s.parseJSON(r, &thingToUpdate)
-	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusBadRequest, err)
-		return
+// @Param Body body UpdateThing true "The body to update or create a thing"
+// @Success 200 {object} ThingResponse "Updated"
+// @Success 201 {object} ThingResponse "Created"
+// @Failure 400,401,403,404,413,415,429,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid} [put]
+func (s *Server) UpdateThing() *httpx.Handler[updateThingRequest, upsertedThing] {
+	return httpx.Handle(s.api, func(ctx context.Context, req updateThingRequest) (upsertedThing, error) {
+		updatedThing, created, err := s.upsertThing(ctx, req.UUID, req.Body)
+		if err != nil {
+			return upsertedThing{}, err
+		}
+		return upsertedThing{ThingResponse: thingToThingResponse(updatedThing), created: created}, nil
+	}, httpx.WithStatus(http.StatusOK, http.StatusCreated))
+}
+
+// upsertThing updates the thing with uuid or creates it when it does not exist yet, the kind of an existing
+// thing cannot be changed. The returned bool reports whether the thing was created.
+func (s *Server) upsertThing(ctx context.Context, uuid string, thingToUpdate UpdateThing) (db.Thing, bool, error) {
+	if !isUUID(uuid) {
+		return db.Thing{}, false, errInvalidUUID
 	}
 
-	updatedThing, err := s.db.UpdateThing(ctx, uuid, thingToUpdate.Value)
-	if err == db.ErrThingNotFound {
-		httpx.AbortJSON(w, r, http.StatusNotFound, err)
-		return
+	kind := thingToUpdate.Kind
+	existingThing, err := s.db.GetThing(ctx, uuid)
+	if err == nil {
+		if kind != "" && kind != existingThing.Kind {
+			return db.Thing{}, false, errKindChanged
+		}
+		kind = existingThing.Kind
+	} else if err != db.ErrThingNotFound {
+		return db.Thing{}, false, err
 	}
+
+	input, err := s.thingInput(
+		ctx,
+		kind,
+		thingToUpdate.Name,
+		thingToUpdate.Value,
+		thingToUpdate.Data,
+		thingToUpdate.Labels,
+	)
 	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
-		return
+		return db.Thing{}, false, err
 	}
+	input.ParentUUID = thingToUpdate.Parent
+
+	return s.db.UpsertThing(ctx, uuid, input)
+}
 
-	httpx.JSON(w, r, thingToThingResponse(updatedThing))
+type deleteThingRequest struct {
+	UUID    string `path:"uuid"`
+	Cascade bool   `query:"cascade,lenient"`
 }
 
 // DeleteThing godoc
 // @Summary Delete a thing
-// @Description Delete a thing
+// @Description Delete a thing and its attachments, a thing with children is only deleted with cascade
+// @Description which deletes all its descendants as well
 // @ID delete-thing
 // @Tags Thing
+// @Produce json,application/yaml,application/msgpack
 // @Param uuid path string true "UUID"
+// @Param cascade query bool false "Delete the descendants of the thing"
 // @Success 200 "Empty response"
-// @Failure 500 {object} httpx.ErrorResponse
-// @Router /thing/{uuid} [delete]
-func (s *Server) DeleteThing(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	uuid := chi.URLParam(r, "uuid")
+// @Failure 400,401,403,409,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid} [delete]
+func (s *Server) DeleteThing() *httpx.Handler[deleteThingRequest, httpx.Empty] {
+	return httpx.Handle(s.api, func(ctx context.Context, req deleteThingRequest) (httpx.Empty, error) {
+		err := s.deleteThing(ctx, req)
+		// deleting a thing which does not exist is not an error in v1
+		if err != nil && err != db.ErrThingNotFound {
+			return httpx.Empty{}, err
+		}
+		return httpx.Empty{}, nil
+	})
+}
+
+// deleteThing deletes a thing, with cascade including its descendants
+func (s *Server) deleteThing(ctx context.Context, req deleteThingRequest) error {
+	policy := db.Restrict
+	if req.Cascade {
+		policy = db.Cascade
+	}
 
-	err := s.db.DeleteThing(ctx, uuid)
+	attachments, err := s.db.DeleteThing(ctx, req.UUID, policy)
 	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
-		return
+		return err
 	}
+	s.deleteAttachmentBlobs(ctx, attachments)
+	return nil
 }
 
 type ThingsResponse struct {
@@ -144,65 +258,259 @@ type ThingsResponse struct {
 	Things []ThingResponse `json:"things"`
 }
 
+// Version of a page of things changes when one of its things is updated, added or removed. It has
+// no modification time, as removing a thing does not make the page more recent.
+func (t ThingsResponse) Version() (httpx.ETag, time.Time) {
+	parts := []string{strconv.Itoa(t.Total), strconv.Itoa(t.Page), strconv.Itoa(t.Limit)}
+	for _, thing := range t.Things {
+		etag, _ := thing.Version()
+		parts = append(parts, etag.Tag)
+	}
+	return httpx.WeakETag(parts...), time.Time{}
+}
+
+type listThingsRequest struct {
+	pagination
+	LabelSelector string `query:"labelSelector"`
+}
+
 // ListThings godoc
 // @Summary List things
 // @Description List things
 // @ID list-things
 // @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
 // @Param page query int false "Page"
 // @Param limit query int false "Limit (max 100)"
+// @Param labelSelector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated"
 // @Success 200 {object} ThingsResponse
-// @Failure 500 {object} httpx.ErrorResponse
-// @Router /thing [get]
-func (s *Server) ListThings(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	page := 1
-	pageQueryParam := r.URL.Query().Get("page")
-	if pageQueryParam != "" {
-		result, err := strconv.Atoi(pageQueryParam)
-		if err == nil && result > 0 {
-			page = result
+// @Success 304 "Not Modified"
+// @Failure 400,401,403,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing [get]
+func (s *Server) ListThings() *httpx.Handler[listThingsRequest, ThingsResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req listThingsRequest) (ThingsResponse, error) {
+		page, limit, offset := req.values()
+
+		selector, err := labels.Parse(req.LabelSelector)
+		if err != nil {
+			return ThingsResponse{}, err
 		}
-	}
 
-	limit := 10
-	limitQueryParam := r.URL.Query().Get("limit")
-	if limitQueryParam != "" {
-		result, err := strconv.Atoi(limitQueryParam)
-		if err == nil && result > 0 && result <= 100 {
-			limit = result
+		things, count, err := s.db.GetThings(ctx, offset, limit, selector, nil)
+		if err != nil {
+			return ThingsResponse{}, err
 		}
+		return thingsToThingsResponse(things, page, limit, count), nil
+	})
+}
+
+type listChildrenRequest struct {
+	UUID string `path:"uuid"`
+	pagination
+}
+
+// ListChildren godoc
+// @Summary List the children of a thing
+// @Description List the direct children of a thing ordered by their uuid
+// @ID list-thing-children
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param uuid path string true "UUID"
+// @Param page query int false "Page"
+// @Param limit query int false "Limit (max 100)"
+// @Success 200 {object} ThingsResponse
+// @Success 304 "Not Modified"
+// @Failure 400,401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/children [get]
+func (s *Server) ListChildren() *httpx.Handler[listChildrenRequest, ThingsResponse] {
+	return httpx.Handle(s.api, func(ctx context.Context, req listChildrenRequest) (ThingsResponse, error) {
+		page, limit, offset := req.values()
+
+		things, count, err := s.db.GetChildren(ctx, req.UUID, offset, limit, nil)
+		if err != nil {
+			return ThingsResponse{}, err
+		}
+		return thingsToThingsResponse(things, page, limit, count), nil
+	})
+}
+
+// ListAncestors godoc
+// @Summary List the ancestors of a thing
+// @Description List the ancestors of a thing, starting at the root
+// @ID list-thing-ancestors
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param uuid path string true "UUID"
+// @Success 200 {array} ThingResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v1/thing/{uuid}/ancestors [get]
+func (s *Server) ListAncestors() *httpx.Handler[thingRequest, thingResponses] {
+	return httpx.Handle(s.api, func(ctx context.Context, req thingRequest) (thingResponses, error) {
+		things, err := s.db.GetAncestors(ctx, req.UUID)
+		if err != nil {
+			return nil, err
+		}
+
+		ancestors := thingResponses{}
+		for _, thing := range things {
+			ancestors = append(ancestors, thingToThingResponse(thing))
+		}
+		return ancestors, nil
+	})
+}
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+// pagination are the page and limit query parameters of a list, values which cannot be parsed fall back
+// to their default like values out of range
+type pagination struct {
+	Page  int `query:"page,lenient"`
+	Limit int `query:"limit,lenient"`
+}
+
+// values returns the page and limit, replacing values out of range by their default, with the resulting offset
+func (p pagination) values() (page int, limit int, offset int) {
+	page = 1
+	if p.Page > 0 {
+		page = p.Page
+	}
+
+	limit = defaultLimit
+	if p.Limit > 0 && p.Limit <= maxLimit {
+		limit = p.Limit
 	}
 
-	offset := 0
 	if page > 1 {
 		offset = (page - 1) * limit
 	}
+	return page, limit, offset
+}
+
+var (
+	errInvalidUUID = errors.New("invalid uuid")
+	errKindChanged = errors.New("the kind of a thing cannot be changed")
+)
+
+// thingInput validates the fields of a thing, without a kind a value is required,
+// with a kind data is required which is validated against the latest schema of the kind
+func (s *Server) thingInput(
+	ctx context.Context,
+	kind string,
+	name string,
+	value string,
+	data json.RawMessage,
+	thingLabels map[string]string,
+) (db.ThingInput, error) {
+	if err := labels.Validate(thingLabels); err != nil {
+		return db.ThingInput{}, &httpx.ValidationError{Message: err.Error()}
+	}
+	input := db.ThingInput{
+		Kind:   kind,
+		Name:   name,
+		Labels: thingLabels,
+	}
 
-	things, count, err := s.db.GetThings(ctx, offset, limit)
+	if kind == "" {
+		if value == "" {
+			return db.ThingInput{}, &httpx.ValidationError{Message: "a value is required for a thing without a kind"}
+		}
+		if len(data) > 0 {
+			return db.ThingInput{}, &httpx.ValidationError{Message: "data requires a kind"}
+		}
+		input.Value = value
+		return input, nil
+	}
+
+	if value != "" {
+		return db.ThingInput{}, &httpx.ValidationError{Message: "a thing with a kind stores its value as data"}
+	}
+	if len(data) == 0 {
+		return db.ThingInput{}, &httpx.ValidationError{Message: "data is required for a thing with a kind"}
+	}
+
+	k, err := s.db.GetKind(ctx, kind)
+	if err == db.ErrKindNotFound {
+		return db.ThingInput{}, &httpx.ValidationError{Message: err.Error()}
+	}
+	if err != nil {
+		return db.ThingInput{}, err
+	}
+	schema, err := s.schemas.get(k)
 	if err != nil {
-		httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
-		return
+		return db.ThingInput{}, err
+	}
+	if err := validateData(schema, data, "/data"); err != nil {
+		return db.ThingInput{}, err
 	}
 
+	input.KindVersion = k.Version
+	input.Data = db.JSON(data)
+	return input, nil
+}
+
+// errorStatus maps the errors of the thing API to the status code of its response,
+// 0 for internal errors
+func errorStatus(err error) int {
+	switch {
+	case err == db.ErrThingNotFound, err == db.ErrAPIKeyNotFound:
+		return http.StatusNotFound
+	case err == db.ErrParentNotFound, err == db.ErrCycle, err == db.ErrInvalidGrant, err == db.ErrTooManyThings, err == errInvalidUUID, err == errKindChanged,
+		errors.Is(err, labels.ErrInvalidSelector):
+		return http.StatusBadRequest
+	case err == errForbidden:
+		return http.StatusForbidden
+	case err == db.ErrThingHasChildren, err == db.ErrAPIKeyRevoked, err == db.ErrAPIKeyAlreadyExists:
+		return http.StatusConflict
+	case err == errQuotaExceeded:
+		return http.StatusTooManyRequests
+	case err == errShareLinksDisabled:
+		return http.StatusNotImplemented
+	}
+	return 0
+}
+
+// isUUID reports whether s is a UUID in its canonical lowercase form
+func isUUID(s string) bool {
+	u, err := uuid.Parse(s)
+	return err == nil && u.String() == s
+}
+
+func thingToThingResponse(thing db.Thing) ThingResponse {
+	// labels are documented as an object, never null
+	labels := thing.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return ThingResponse{
+		UUID:        thing.UUID,
+		Name:        thing.Name,
+		Value:       thing.Value,
+		Labels:      labels,
+		Parent:      thing.ParentUUID,
+		Kind:        thing.Kind,
+		KindVersion: thing.KindVersion,
+		Data:        json.RawMessage(thing.Data),
+		Owner:       thing.Owner,
+		Updated:     thing.Updated,
+		Created:     thing.Created,
+	}
+}
+
+func thingsToThingsResponse(things []db.Thing, page int, limit int, total int) ThingsResponse {
 	thingsResponse := ThingsResponse{
 		Page:   page,
 		Limit:  limit,
-		Total:  count,
+		Total:  total,
 		Things: []ThingResponse{},
 	}
 	for _, thing := range things {
 		thingsResponse.Things = append(thingsResponse.Things, thingToThingResponse(thing))
 	}
-	httpx.JSON(w, r, thingsResponse)
-}
-
-func thingToThingResponse(thing db.Thing) ThingResponse {
-	return ThingResponse{
-		UUID:    thing.UUID,
-		Name:    thing.Name,
-		Value:   thing.Value,
-		Updated: thing.Updated,
-		Created: thing.Created,
-	}
+	return thingsResponse
 }
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+// serve serves a request with a JSON body to target and returns the recorded response
+func serve(s *Server, method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestUpsertThing(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	for _, version := range []string{"/v1", "/v2"} {
+		t.Run(version, func(t *testing.T) {
+			uuid := db.RandomID()
+			thing := version + "/thing/" + uuid
+
+			w := serve(s, http.MethodPut, thing, `{"name":"name","value":"created","labels":{"env":"prod"}}`)
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			var created ThingResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+			assert.Equal(t, uuid, created.UUID)
+			assert.Equal(t, "created", created.Value)
+
+			w = serve(s, http.MethodPut, thing, `{"value":"updated"}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var updated ThingResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+			assert.Equal(t, uuid, updated.UUID)
+			assert.Equal(t, "name", updated.Name)
+			assert.Equal(t, "updated", updated.Value)
+			assert.Equal(t, map[string]string{"env": "prod"}, updated.Labels)
+
+			// creating a thing requires a name
+			w = serve(s, http.MethodPut, version+"/thing/"+db.RandomID(), `{"value":"value"}`)
+			assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+			w = serve(s, http.MethodPut, version+"/thing/not-a-uuid", `{"name":"name","value":"value"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), errInvalidUUID.Error())
+
+			// the uuid is validated in its canonical lowercase form
+			w = serve(s, http.MethodPut, version+"/thing/"+strings.ToUpper(uuid), `{"value":"value"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+	assert.Len(t, fake.things, 2)
+}
+
+func TestHierarchy(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithOpenAPIValidation(true))
+	require.NoError(t, err)
+
+	create := func(name string, parent string) ThingResponse {
+		w := serve(s, http.MethodPost, "/v2/thing", `{"name":"`+name+`","value":"value","parent":"`+parent+`"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var thing ThingResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &thing))
+		return thing
+	}
+	project := create("project", "")
+	environment := create("environment", project.UUID)
+	config := create("config", environment.UUID)
+	secrets := create("secrets", environment.UUID)
+
+	w := serve(s, http.MethodPost, "/v2/thing", `{"name":"orphan","value":"value","parent":"`+db.RandomID()+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// ancestors start at the root
+	w = serve(s, http.MethodGet, "/v2/thing/"+config.UUID+"/ancestors", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ancestors []ThingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ancestors))
+	require.Len(t, ancestors, 2)
+	assert.Equal(t, project.UUID, ancestors[0].UUID)
+	assert.Equal(t, environment.UUID, ancestors[1].UUID)
+
+	// children are ordered by uuid
+	w = serve(s, http.MethodGet, "/v2/thing/"+environment.UUID+"/children", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var children ThingsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &children))
+	assert.Equal(t, 2, children.Total)
+	require.Len(t, children.Things, 2)
+	assert.Less(t, children.Things[0].UUID, children.Things[1].UUID)
+	assert.ElementsMatch(t, []string{config.UUID, secrets.UUID}, []string{children.Things[0].UUID, children.Things[1].UUID})
+
+	// a thing cannot be moved below itself or one of its descendants
+	for _, parent := range []string{project.UUID, config.UUID} {
+		w = serve(s, http.MethodPut, "/v2/thing/"+project.UUID, `{"value":"moved","parent":"`+parent+`"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), db.ErrCycle.Error())
+	}
+	w = serve(s, http.MethodGet, "/v2/thing/"+project.UUID, "")
+	assert.Contains(t, w.Body.String(), `"value":"value"`, "a rejected move does not update the thing")
+
+	w = serve(s, http.MethodPut, "/v2/thing/"+config.UUID, `{"value":"moved","parent":""}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(s, http.MethodGet, "/v2/thing/"+config.UUID+"/ancestors", "")
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	// a thing with children is only deleted with cascade
+	for _, version := range []string{"/v1", "/v2"} {
+		w = serve(s, http.MethodDelete, version+"/thing/"+project.UUID, "")
+		assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), db.ErrThingHasChildren.Error())
+	}
+	w = serve(s, http.MethodDelete, "/v2/thing/"+config.UUID, "")
+	assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+}
+
+func TestListThingsInvalidPagination(t *testing.T) {
+	fake := &fakeDB{}
+	for i := 0; i < 15; i++ {
+		fake.things = append(fake.things, db.Thing{UUID: db.RandomID(), Name: "name"})
+	}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	require.NoError(t, err)
+
+	// pagination values which cannot be parsed fall back to their defaults like values out of range
+	for _, query := range []string{"page=abc&limit=xyz", "page=-1&limit=1000", "page=1.5&limit="} {
+		w := doAuthenticated(s, http.MethodGet, "/v1/thing?"+query, "", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var things ThingsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &things))
+		assert.Equal(t, 1, things.Page, query)
+		assert.Equal(t, defaultLimit, things.Limit, query)
+		assert.Len(t, things.Things, defaultLimit, query)
+	}
+
+	// a cascade which cannot be parsed does not cascade
+	parent := fake.things[0].UUID
+	fake.things[1].ParentUUID = parent
+	w := doAuthenticated(s, http.MethodDelete, "/v2/thing/"+parent+"?cascade=yes", "", "")
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
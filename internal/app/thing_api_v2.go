@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+// The v2 thing API follows REST conventions: things are created at the collection with
+// 201 Created and a Location, and deletes answer 204 No Content or 404 Not Found.
+// Handlers which behave the same as in v1 are returned again to document their v2 route.
+
+// ListThingsV2 godoc
+// @Summary List things
+// @Description List things
+// @ID list-things-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param page query int false "Page"
+// @Param limit query int false "Limit (max 100)"
+// @Param labelSelector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated"
+// @Success 200 {object} ThingsResponse
+// @Success 304 "Not Modified"
+// @Failure 400,401,403,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing [get]
+func (s *Server) ListThingsV2() *httpx.Handler[listThingsRequest, ThingsResponse] {
+	return s.ListThings()
+}
+
+// CreateThingV2 godoc
+// @Summary Create a thing
+// @Description Create a thing, a thing without a kind requires a value, a thing with a kind requires data matching the schema of the kind
+// @ID create-thing-v2
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param Body body CreateThing true "The body to create a thing"
+// @Success 201 {object} ThingResponse
+// @Header 201 {string} Location "The URL of the created thing"
+// @Failure 400,401,403,413,415,429,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing [post]
+func (s *Server) CreateThingV2() *httpx.Handler[createThingRequest, createdThing] {
+	return httpx.Handle(s.api, func(ctx context.Context, req createThingRequest) (createdThing, error) {
+		thing, err := s.createThing(ctx, req.Body)
+		if err != nil {
+			return createdThing{}, err
+		}
+		return createdThing{thingToThingResponse(thing)}, nil
+	}, httpx.WithStatus(http.StatusCreated))
+}
+
+// createdThing is answered with the Location of the thing
+type createdThing struct {
+	ThingResponse
+}
+
+func (c createdThing) Headers() http.Header {
+	return http.Header{"Location": []string{"/v2/thing/" + c.UUID}}
+}
+
+// GetThingV2 godoc
+// @Summary Get a thing
+// @Description get thing by uuid
+// @ID get-thing-by-uuid-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Success 200 {object} ThingResponse
+// @Success 304 "Not Modified"
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid} [get]
+func (s *Server) GetThingV2() *httpx.Handler[thingRequest, ThingResponse] {
+	return s.GetThing()
+}
+
+// UpdateThingV2 godoc
+// @Summary Update or create a thing
+// @Description Update a thing, or create it with the given uuid when it does not exist yet.
+// @Description Creating a thing requires a name, without one a 404 is returned for a thing that does not exist.
+// @ID update-thing-v2
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param Body body UpdateThing true "The body to update or create a thing"
+// @Success 200 {object} ThingResponse "Updated"
+// @Success 201 {object} ThingResponse "Created"
+// @Failure 400,401,403,404,413,415,429,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid} [put]
+func (s *Server) UpdateThingV2() *httpx.Handler[updateThingRequest, upsertedThing] {
+	return s.UpdateThing()
+}
+
+// DeleteThingV2 godoc
+// @Summary Delete a thing
+// @Description Delete a thing and its attachments, a thing with children is only deleted with cascade
+// @Description which deletes all its descendants as well
+// @ID delete-thing-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param cascade query bool false "Delete the descendants of the thing"
+// @Success 204 "No Content"
+// @Failure 400,401,403,404,409,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid} [delete]
+func (s *Server) DeleteThingV2() *httpx.Handler[deleteThingRequest, httpx.Empty] {
+	return httpx.Handle(s.api, func(ctx context.Context, req deleteThingRequest) (httpx.Empty, error) {
+		return httpx.Empty{}, s.deleteThing(ctx, req)
+	}, httpx.WithStatus(http.StatusNoContent))
+}
+
+// ListChildrenV2 godoc
+// @Summary List the children of a thing
+// @Description List the direct children of a thing ordered by their uuid
+// @ID list-thing-children-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param uuid path string true "UUID"
+// @Param page query int false "Page"
+// @Param limit query int false "Limit (max 100)"
+// @Success 200 {object} ThingsResponse
+// @Success 304 "Not Modified"
+// @Failure 400,401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid}/children [get]
+func (s *Server) ListChildrenV2() *httpx.Handler[listChildrenRequest, ThingsResponse] {
+	return s.ListChildren()
+}
+
+// ListAncestorsV2 godoc
+// @Summary List the ancestors of a thing
+// @Description List the ancestors of a thing, starting at the root
+// @ID list-thing-ancestors-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack,text/csv
+// @Param uuid path string true "UUID"
+// @Success 200 {array} ThingResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid}/ancestors [get]
+func (s *Server) ListAncestorsV2() *httpx.Handler[thingRequest, thingResponses] {
+	return s.ListAncestors()
+}
+
+// GetThingACLV2 godoc
+// @Summary Get the ACL of a thing
+// @Description Get the owner of a thing and the principals and groups it is shared with
+// @ID get-thing-acl-v2
+// @Tags Thing
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Success 200 {object} ACLResponse
+// @Failure 401,403,404,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid}/acl [get]
+func (s *Server) GetThingACLV2() *httpx.Handler[thingRequest, ACLResponse] {
+	return s.GetThingACL()
+}
+
+// SetThingACLV2 godoc
+// @Summary Share a thing
+// @Description Replace the principals and groups a thing is shared with, only its owner can share a thing
+// @ID set-thing-acl-v2
+// @Tags Thing
+// @Accept json,application/yaml,application/msgpack
+// @Produce json,application/yaml,application/msgpack
+// @Param uuid path string true "UUID"
+// @Param Body body SetACL true "The grants of the thing"
+// @Success 200 {object} ACLResponse
+// @Failure 400,401,403,404,413,415,500 {object} httpx.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /v2/thing/{uuid}/acl [put]
+func (s *Server) SetThingACLV2() *httpx.Handler[setACLRequest, ACLResponse] {
+	return s.SetThingACL()
+}
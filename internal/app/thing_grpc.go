@@ -0,0 +1,434 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+)
+
+// streamPageSize is the number of things retrieved at once by StreamThings
+const streamPageSize = 100
+
+// thingService implements the gRPC ThingService on top of the same db.Service and validation as the REST API
+type thingService struct {
+	thingpb.UnimplementedThingServiceServer
+	s *Server
+}
+
+// grpcScopes are the scopes required by the methods of the gRPC API, other methods are denied
+var grpcScopes = map[string]string{
+	"/thing.v1.ThingService/GetThing":     ScopeThingsRead,
+	"/thing.v1.ThingService/ListThings":   ScopeThingsRead,
+	"/thing.v1.ThingService/StreamThings": ScopeThingsRead,
+	"/thing.v1.ThingService/CreateThing":  ScopeThingsWrite,
+	"/thing.v1.ThingService/UpdateThing":  ScopeThingsWrite,
+	"/thing.v1.ThingService/DeleteThing":  ScopeThingsWrite,
+}
+
+func (s *Server) newGRPCServer() *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{s.unaryTracer}
+	stream := []grpc.StreamServerInterceptor{s.streamTracer}
+	if s.tracer != nil {
+		unary = append(unary, s.unarySpan)
+		stream = append(stream, s.streamSpan)
+	}
+	unary = append(unary, s.unaryRecoverer)
+	stream = append(stream, s.streamRecoverer)
+	if s.authenticator != nil {
+		unary = append(unary, s.unaryAuthenticator)
+		stream = append(stream, s.streamAuthenticator)
+	}
+	if s.rateLimiter != nil {
+		unary = append(unary, s.unaryRateLimit)
+		stream = append(stream, s.streamRateLimit)
+	}
+	if s.tenants != nil {
+		unary = append(unary, s.unaryTenant)
+		stream = append(stream, s.streamTenant)
+	}
+	g := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	thingpb.RegisterThingServiceServer(g, &thingService{s: s})
+	return g
+}
+
+func (t *thingService) GetThing(ctx context.Context, req *thingpb.GetThingRequest) (*thingpb.Thing, error) {
+	thing, err := t.s.db.GetThing(ctx, req.Uuid)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	return thingToProto(thing)
+}
+
+func (t *thingService) CreateThing(ctx context.Context, req *thingpb.CreateThingRequest) (*thingpb.Thing, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	data, err := protoToJSON(req.Data)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+
+	input, err := t.s.thingInput(ctx, req.Kind, req.Name, req.Value, data, req.Labels)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	input.ParentUUID = &req.Parent
+
+	createdThing, err := t.s.db.CreateThing(ctx, input)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	return thingToProto(createdThing)
+}
+
+func (t *thingService) UpdateThing(ctx context.Context, req *thingpb.UpdateThingRequest) (*thingpb.UpdateThingResponse, error) {
+	data, err := protoToJSON(req.Data)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+
+	thingToUpdate := UpdateThing{
+		Name:   req.Name,
+		Value:  req.Value,
+		Kind:   req.Kind,
+		Data:   data,
+		Parent: req.Parent,
+	}
+	if req.Labels != nil {
+		thingToUpdate.Labels = req.Labels.Labels
+		if thingToUpdate.Labels == nil {
+			thingToUpdate.Labels = map[string]string{}
+		}
+	}
+
+	updatedThing, created, err := t.s.upsertThing(ctx, req.Uuid, thingToUpdate)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	thing, err := thingToProto(updatedThing)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	return &thingpb.UpdateThingResponse{Thing: thing, Created: created}, nil
+}
+
+func (t *thingService) DeleteThing(ctx context.Context, req *thingpb.DeleteThingRequest) (*emptypb.Empty, error) {
+	policy := db.Restrict
+	if req.Cascade {
+		policy = db.Cascade
+	}
+
+	attachments, err := t.s.db.DeleteThing(ctx, req.Uuid, policy)
+	if err == db.ErrThingNotFound {
+		return &emptypb.Empty{}, nil
+	}
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+	t.s.deleteAttachmentBlobs(ctx, attachments)
+	return &emptypb.Empty{}, nil
+}
+
+func (t *thingService) ListThings(ctx context.Context, req *thingpb.ListThingsRequest) (*thingpb.ListThingsResponse, error) {
+	page := int(req.Page)
+	if page < 1 {
+		page = 1
+	}
+	limit := int(req.Limit)
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	selector, err := labels.Parse(req.LabelSelector)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+
+	things, count, err := t.s.db.GetThings(ctx, (page-1)*limit, limit, selector, nil)
+	if err != nil {
+		return nil, t.s.grpcError(ctx, err)
+	}
+
+	response := &thingpb.ListThingsResponse{
+		Total: int32(count),
+		Page:  int32(page),
+		Limit: int32(limit),
+	}
+	for _, thing := range things {
+		p, err := thingToProto(thing)
+		if err != nil {
+			return nil, t.s.grpcError(ctx, err)
+		}
+		response.Things = append(response.Things, p)
+	}
+	return response, nil
+}
+
+func (t *thingService) StreamThings(req *thingpb.StreamThingsRequest, stream thingpb.ThingService_StreamThingsServer) error {
+	ctx := stream.Context()
+
+	selector, err := labels.Parse(req.LabelSelector)
+	if err != nil {
+		return t.s.grpcError(ctx, err)
+	}
+
+	for offset := 0; ; offset += streamPageSize {
+		things, count, err := t.s.db.GetThings(ctx, offset, streamPageSize, selector, nil)
+		if err != nil {
+			return t.s.grpcError(ctx, err)
+		}
+		for _, thing := range things {
+			p, err := thingToProto(thing)
+			if err != nil {
+				return t.s.grpcError(ctx, err)
+			}
+			if err := stream.Send(p); err != nil {
+				return err
+			}
+		}
+		if len(things) == 0 || offset+len(things) >= count {
+			return nil
+		}
+	}
+}
+
+// grpcError converts an error into a status with the code matching the status code of the REST API,
+// internal errors are logged instead of returned
+func (s *Server) grpcError(ctx context.Context, err error) error {
+	var validationErr *httpx.ValidationError
+	switch {
+	case err == db.ErrThingNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case err == errForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case err == db.ErrParentNotFound, err == db.ErrCycle, err == db.ErrInvalidGrant, err == db.ErrTooManyThings, err == errInvalidUUID, err == errKindChanged,
+		errors.Is(err, labels.ErrInvalidSelector), errors.Is(err, errInvalidData):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &validationErr):
+		st := status.New(codes.InvalidArgument, err.Error())
+		if len(validationErr.Fields) == 0 {
+			return st.Err()
+		}
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range validationErr.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+			})
+		}
+		if withDetails, detailsErr := st.WithDetails(badRequest); detailsErr == nil {
+			st = withDetails
+		}
+		return st.Err()
+	case err == db.ErrThingHasChildren:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err == errQuotaExceeded:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	s.log.Error(ctx, err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// unaryTracer adds the X-Cloud-Trace-Context metadata to the context.Context like log.Logger.Tracer and
+// the trace context of the caller, see traceContext
+func (s *Server) unaryTracer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(traceContext(ctx), req)
+}
+
+func (s *Server) streamTracer(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &tracedStream{ServerStream: ss, ctx: traceContext(ss.Context())})
+}
+
+// unaryRecoverer logs panics and returns them as internal errors like middleware.Recoverer
+func (s *Server) unaryRecoverer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = s.recovered(ctx, info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (s *Server) streamRecoverer(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = s.recovered(ss.Context(), info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// unaryAuthenticator authenticates calls with the bearer token in the authorization metadata like
+// auth.Middleware and authorizes the scope of the method
+func (s *Server) unaryAuthenticator(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticateGRPC(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuthenticator(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticateGRPC(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) authenticateGRPC(ctx context.Context, method string) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = auth.BearerToken(values[0])
+		}
+	}
+	ctx, err := auth.Authenticate(ctx, s.authenticator, token)
+	switch {
+	case err == auth.ErrNoCredentials, errors.Is(err, auth.ErrInvalidCredentials):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		s.log.Error(ctx, err)
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	scope, ok := grpcScopes[method]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed", method)
+	}
+	if err := auth.Authorize(ctx, scope); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return ctx, nil
+}
+
+func (s *Server) unaryTenant(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.resolveGRPCTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamTenant(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.resolveGRPCTenant(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+}
+
+// resolveGRPCTenant resolves the tenant from the metadata of a call like from the headers and
+// host of a request
+func (s *Server) resolveGRPCTenant(ctx context.Context) (context.Context, error) {
+	id, err := tenant.Resolve(grpcRequest(ctx), s.tenants...)
+	switch {
+	case err == tenant.ErrNoTenant, errors.Is(err, tenant.ErrInvalidTenant):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err == tenant.ErrTenantMismatch, err == tenant.ErrUnboundCredentials:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		s.log.Error(ctx, err)
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return log.With(tenant.NewContext(ctx, id), log.KV("tenant", id)), nil
+}
+
+// grpcRequest returns a request with the metadata of a call as headers, its authority as host and
+// its peer as remote address, to reuse the HTTP middleware logic for gRPC
+func grpcRequest(ctx context.Context) *http.Request {
+	r := (&http.Request{Header: http.Header{}}).WithContext(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			r.Header[http.CanonicalHeaderKey(key)] = values
+		}
+		if values := md.Get(":authority"); len(values) > 0 {
+			r.Host = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return r
+}
+
+func (s *Server) recovered(ctx context.Context, method string, p interface{}) error {
+	s.log.Error(ctx, fmt.Errorf("panic: %v", p), log.KV("method", method))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// traceContext extracts the trace context propagated in the metadata with the propagator registered with
+// otel.SetTextMapPropagator, so it is propagated by the calls made while handling the call
+func traceContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	return context.WithValue(ctx, log.CloudTraceContextKey, metadataCarrier(md).Get(log.TraceHeader))
+}
+
+// tracedStream replaces the context of a grpc.ServerStream
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+var errInvalidData = errors.New("invalid data")
+
+func protoToJSON(v *structpb.Value) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := protojson.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidData, err)
+	}
+	return data, nil
+}
+
+func thingToProto(thing db.Thing) (*thingpb.Thing, error) {
+	p := &thingpb.Thing{
+		Uuid:        thing.UUID,
+		Name:        thing.Name,
+		Value:       thing.Value,
+		Labels:      thing.Labels,
+		Parent:      thing.ParentUUID,
+		Kind:        thing.Kind,
+		KindVersion: int32(thing.KindVersion),
+		Updated:     timestamppb.New(thing.Updated),
+		Created:     timestamppb.New(thing.Created),
+	}
+	if len(thing.Data) > 0 {
+		p.Data = &structpb.Value{}
+		if err := protojson.Unmarshal(thing.Data, p.Data); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+)
+
+func newGRPCClient(t *testing.T, fake *fakeDB, opts ...Option) thingpb.ThingServiceClient {
+	var logs bytes.Buffer
+	s, err := NewServer(log.NewJSONLogger(&logs, "", false), fake, nil, opts...)
+	assert.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go s.grpc.Serve(lis)
+	t.Cleanup(s.grpc.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return thingpb.NewThingServiceClient(conn)
+}
+
+func TestGRPCGetThing(t *testing.T) {
+	fake := &fakeDB{things: []db.Thing{{
+		UUID:    "abc",
+		Name:    "name",
+		Kind:    "config",
+		Data:    db.JSON(`{"port": 80}`),
+		Updated: time.Now(),
+	}}}
+	client := newGRPCClient(t, fake)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), log.TraceHeader, "trace/1;o=1")
+	thing, err := client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "name", thing.Name)
+	assert.Equal(t, float64(80), thing.Data.GetStructValue().Fields["port"].GetNumberValue())
+	assert.Equal(t, "trace/1;o=1", fake.trace)
+
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCStreamThings(t *testing.T) {
+	fake := &fakeDB{}
+	for i := 0; i < streamPageSize+5; i++ {
+		fake.things = append(fake.things, db.Thing{UUID: db.RandomID()})
+	}
+	client := newGRPCClient(t, fake)
+
+	stream, err := client.StreamThings(context.Background(), &thingpb.StreamThingsRequest{})
+	assert.NoError(t, err)
+	count := 0
+	for {
+		_, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		count++
+	}
+	assert.Equal(t, streamPageSize+5, count)
+
+	stream, err = client.StreamThings(context.Background(), &thingpb.StreamThingsRequest{LabelSelector: "in in"})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCError(t *testing.T) {
+	s := &Server{log: log.NewJSONLogger(&bytes.Buffer{}, "", false)}
+	ctx := context.Background()
+
+	assert.Equal(t, codes.NotFound, status.Code(s.grpcError(ctx, db.ErrThingNotFound)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(s.grpcError(ctx, db.ErrCycle)))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(s.grpcError(ctx, db.ErrThingHasChildren)))
+	// internal errors are logged but not returned to clients
+	var logs bytes.Buffer
+	s.log = log.NewJSONLogger(&logs, "", false)
+	internal := status.Convert(s.grpcError(ctx, assert.AnError))
+	assert.Equal(t, codes.Internal, internal.Code())
+	assert.Equal(t, "internal error", internal.Message())
+	assert.Contains(t, logs.String(), assert.AnError.Error())
+
+	err := s.grpcError(ctx, &httpx.ValidationError{
+		Message: "invalid data",
+		Fields:  []httpx.FieldError{{Field: "/data/port", Message: "expected integer"}},
+	})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	assert.True(t, ok)
+	assert.Equal(t, "/data/port", badRequest.FieldViolations[0].Field)
+}
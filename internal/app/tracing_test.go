@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/thingpb"
+	"github.com/ldej/api-ldej-nl/pkg/tracing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}, pingErr: errors.New("connection refused")}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil, WithTracing(provider, "fake"))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/thing/abc", nil)
+	r.Header.Set("traceparent", traceparent)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	query, request := spans[0], spans[1]
+	assert.Equal(t, "GET /v1/thing/{uuid}", request.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+	assert.Equal(t, "db.GetThing", query.Name())
+	assert.Equal(t, request.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, codes.Unset, query.Status().Code)
+
+	// failures of the database are recorded on the span of the operation
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	spans = recorder.Ended()
+	require.Len(t, spans, 4)
+	assert.Equal(t, "db.Ping", spans[2].Name())
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+	assert.Equal(t, "connection refused", spans[2].Status().Description)
+
+	client := newGRPCClient(t, fake, WithTracing(provider, "fake"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", traceparent)
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "abc"})
+	require.NoError(t, err)
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "missing"})
+	require.Error(t, err)
+
+	spans = recorder.Ended()
+	require.Len(t, spans, 8)
+	query, call := spans[4], spans[5]
+	assert.Equal(t, "/thing.v1.ThingService/GetThing", call.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", call.SpanContext().TraceID().String())
+	assert.Equal(t, call.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, codes.Unset, call.Status().Code)
+	// a thing which is not found is not a failure of the database
+	assert.Equal(t, codes.Unset, spans[6].Status().Code)
+	assert.Equal(t, codes.Error, spans[7].Status().Code)
+}
+
+func TestPropagationWithoutTracing(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(tracing.Propagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/thing/abc", nil)
+	r.Header.Set("traceparent", traceparent)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fake.span.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", fake.span.SpanID().String())
+
+	client := newGRPCClient(t, fake)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", traceparent, "tracestate", "vendor=value")
+	_, err = client.GetThing(ctx, &thingpb.GetThingRequest{Uuid: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fake.span.TraceID().String())
+	assert.Equal(t, "vendor=value", fake.span.TraceState().String())
+}
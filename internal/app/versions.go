@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+var (
+	// legacyDeprecation is when the unversioned routes were deprecated in favour of /v1
+	legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	// legacySunset is when the unversioned routes are removed
+	legacySunset = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// v1Routes are the routes of the first version of the API, they are served at /v1 and unversioned at the root
+func (s *Server) v1Routes(r chi.Router) {
+	read := r.With(s.requireScope(ScopeThingsRead))
+	write := r.With(s.requireScope(ScopeThingsWrite))
+
+	read.Get("/thing", s.ListThings().ServeHTTP)
+	write.Post("/thing/new", s.CreateThing().ServeHTTP)
+	read.Get("/thing/{uuid}", s.GetThing().ServeHTTP)
+	write.Put("/thing/{uuid}", s.UpdateThing().ServeHTTP)
+	write.Delete("/thing/{uuid}", s.DeleteThing().ServeHTTP)
+	read.Get("/thing/{uuid}/children", s.ListChildren().ServeHTTP)
+	read.Get("/thing/{uuid}/ancestors", s.ListAncestors().ServeHTTP)
+	read.Get("/thing/{uuid}/attachments", s.ListAttachments)
+	write.With(httpx.MaxBodySize(maxUploadSize)).Post("/thing/{uuid}/attachments", s.UploadAttachments)
+	read.Get("/thing/{uuid}/attachments/{attachment}", s.GetAttachment)
+	write.Delete("/thing/{uuid}/attachments/{attachment}", s.DeleteAttachment)
+
+	read.Get("/kind", s.ListKinds)
+	write.Post("/kind/new", s.CreateKind)
+	read.Get("/kind/{name}", s.GetKind)
+	write.Delete("/kind/{name}", s.DeleteKind)
+	read.Get("/kind/{name}/schema", s.ListKindSchemas)
+	write.Post("/kind/{name}/schema", s.AddKindSchema)
+}
+
+// v2Routes are the routes of the second version of the API, served at /v2
+func (s *Server) v2Routes(r chi.Router) {
+	read := r.With(s.requireScope(ScopeThingsRead))
+	write := r.With(s.requireScope(ScopeThingsWrite))
+
+	read.Get("/thing", s.ListThingsV2().ServeHTTP)
+	write.Post("/thing", s.CreateThingV2().ServeHTTP)
+	read.Get("/thing/{uuid}", s.GetThingV2().ServeHTTP)
+	write.Put("/thing/{uuid}", s.UpdateThingV2().ServeHTTP)
+	write.Delete("/thing/{uuid}", s.DeleteThingV2().ServeHTTP)
+	read.Get("/thing/{uuid}/children", s.ListChildrenV2().ServeHTTP)
+	read.Get("/thing/{uuid}/ancestors", s.ListAncestorsV2().ServeHTTP)
+	read.Get("/thing/{uuid}/acl", s.GetThingACLV2().ServeHTTP)
+	write.Put("/thing/{uuid}/acl", s.SetThingACLV2().ServeHTTP)
+}
+
+// apiKeyRoutes manage the API keys, they are only served at /v1
+func (s *Server) apiKeyRoutes(r chi.Router) {
+	manage := r.With(s.requireScope(ScopeAPIKeysManage))
+
+	manage.Get("/apikey", s.ListAPIKeys().ServeHTTP)
+	manage.Post("/apikey/new", s.CreateAPIKey().ServeHTTP)
+	manage.Get("/apikey/{id}", s.GetAPIKey().ServeHTTP)
+	manage.Post("/apikey/{id}/rotate", s.RotateAPIKey().ServeHTTP)
+	manage.Post("/apikey/{id}/revoke", s.RevokeAPIKey().ServeHTTP)
+}
+
+// deprecated marks the responses of the unversioned routes as deprecated and logs their use,
+// the Link header points to the same route in /v1
+func (s *Server) deprecated(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecation.Unix()))
+		w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf(`</v1%s>; rel="successor-version"`, r.URL.Path))
+
+		next.ServeHTTP(w, r)
+
+		s.log.Info(
+			r.Context(),
+			"deprecated route used",
+			log.KV("method", r.Method),
+			log.KV("route", chi.RouteContext(r.Context()).RoutePattern()),
+			log.KV("userAgent", r.UserAgent()),
+		)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/internal/app/db"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func TestLegacyRoutes(t *testing.T) {
+	var logs bytes.Buffer
+	fake := &fakeDB{things: []db.Thing{{UUID: "abc", Name: "name"}}}
+	s, err := NewServer(log.NewJSONLogger(&logs, "", false), fake, nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/thing/abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, logs.String())
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/thing/abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1792368000", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Mon, 19 Apr 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/thing/abc>; rel="successor-version"`, w.Header().Get("Link"))
+
+	var line struct {
+		Message string `json:"message"`
+		Route   string `json:"route"`
+	}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "deprecated route used", line.Message)
+	assert.Equal(t, "/thing/{uuid}", line.Route)
+}
+
+func TestV2Things(t *testing.T) {
+	fake := &fakeDB{}
+	s, err := NewServer(log.NewJSONLogger(&bytes.Buffer{}, "", false), fake, nil)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/v2/thing", strings.NewReader(`{"name": "name", "value": "value"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created ThingResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "/v2/thing/"+created.UUID, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/thing/"+created.UUID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v2/thing/"+created.UUID, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v2/thing/"+created.UUID, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// deleting a thing which does not exist is not an error in v1
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/thing/"+created.UUID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
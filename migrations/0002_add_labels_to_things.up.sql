@@ -0,0 +1,3 @@
+ALTER TABLE things ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS things_labels_idx ON things USING GIN (labels);
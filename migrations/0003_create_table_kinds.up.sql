@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS kinds(
+    name text PRIMARY KEY,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL,
+    updated TIMESTAMP,
+    created TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS kind_schemas(
+    kind text REFERENCES kinds(name) ON DELETE CASCADE,
+    version integer,
+    schema jsonb NOT NULL,
+    created TIMESTAMP,
+    PRIMARY KEY (kind, version)
+);
+
+ALTER TABLE things ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT '';
+ALTER TABLE things ADD COLUMN IF NOT EXISTS kind_version integer NOT NULL DEFAULT 0;
+ALTER TABLE things ADD COLUMN IF NOT EXISTS data jsonb;
+
+CREATE INDEX IF NOT EXISTS things_kind_idx ON things (kind);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS attachments(
+    uuid text PRIMARY KEY,
+    thing_uuid text NOT NULL REFERENCES things(uuid) ON DELETE CASCADE,
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    sha256 text NOT NULL,
+    created TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS attachments_thing_uuid_idx ON attachments (thing_uuid);
@@ -0,0 +1,3 @@
+ALTER TABLE things ADD COLUMN IF NOT EXISTS parent_uuid text REFERENCES things(uuid);
+
+CREATE INDEX IF NOT EXISTS things_parent_uuid_idx ON things (parent_uuid);
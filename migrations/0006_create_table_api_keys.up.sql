@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    hash text NOT NULL,
+    scopes jsonb NOT NULL DEFAULT '[]',
+    revoked boolean NOT NULL DEFAULT false,
+    updated TIMESTAMP,
+    created TIMESTAMP
+);
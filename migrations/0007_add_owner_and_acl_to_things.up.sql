@@ -0,0 +1,6 @@
+ALTER TABLE things ADD COLUMN IF NOT EXISTS owner text NOT NULL DEFAULT '';
+ALTER TABLE things ADD COLUMN IF NOT EXISTS acl jsonb NOT NULL DEFAULT '[]';
+-- the owner and the principals and groups of the acl, '*' for things without owner
+ALTER TABLE things ADD COLUMN IF NOT EXISTS readers text[] NOT NULL DEFAULT '{*}';
+
+CREATE INDEX IF NOT EXISTS things_readers_idx ON things USING GIN (readers);
@@ -0,0 +1,51 @@
+-- things and their attachments belong to the tenant of the transaction which created them, '' is the default tenant
+ALTER TABLE things ADD COLUMN IF NOT EXISTS tenant text NOT NULL DEFAULT COALESCE(current_setting('app.tenant', true), '');
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS tenant text NOT NULL DEFAULT COALESCE(current_setting('app.tenant', true), '');
+
+-- things are identified by their uuid within their tenant, so tenants cannot find out which uuids other tenants
+-- use, and parents and attachments refer to a thing of their own tenant
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_thing_uuid_fkey;
+ALTER TABLE things DROP CONSTRAINT IF EXISTS things_parent_uuid_fkey;
+
+ALTER TABLE things DROP CONSTRAINT IF EXISTS things_pkey;
+ALTER TABLE things ADD PRIMARY KEY (tenant, uuid);
+
+ALTER TABLE things ADD CONSTRAINT things_parent_uuid_fkey
+    FOREIGN KEY (tenant, parent_uuid) REFERENCES things (tenant, uuid);
+ALTER TABLE attachments ADD CONSTRAINT attachments_thing_uuid_fkey
+    FOREIGN KEY (tenant, thing_uuid) REFERENCES things (tenant, uuid) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS things_parent_uuid_idx;
+CREATE INDEX IF NOT EXISTS things_parent_uuid_idx ON things (tenant, parent_uuid);
+
+-- the service switches to this role in its transactions on things, row level security applies to it
+-- even when the service connects as the owner of the tables or as a superuser.
+-- Creating the role and granting it requires a user with CREATEROLE or a superuser. When the migrations run as
+-- a user without those privileges, an administrator creates the role and grants it to that user beforehand,
+-- which turns the block below into a no-op:
+--   CREATE ROLE things_tenant NOLOGIN;
+--   GRANT things_tenant TO <user>;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'things_tenant') THEN
+        CREATE ROLE things_tenant NOLOGIN;
+    END IF;
+    IF NOT pg_has_role(CURRENT_USER, 'things_tenant', 'MEMBER') THEN
+        GRANT things_tenant TO CURRENT_USER;
+    END IF;
+END
+$$;
+GRANT SELECT, INSERT, UPDATE, DELETE ON things, attachments TO things_tenant;
+
+ALTER TABLE things ENABLE ROW LEVEL SECURITY;
+ALTER TABLE attachments ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON things;
+CREATE POLICY tenant_isolation ON things TO things_tenant
+    USING (tenant = current_setting('app.tenant'))
+    WITH CHECK (tenant = current_setting('app.tenant'));
+
+DROP POLICY IF EXISTS tenant_isolation ON attachments;
+CREATE POLICY tenant_isolation ON attachments TO things_tenant
+    USING (tenant = current_setting('app.tenant'))
+    WITH CHECK (tenant = current_setting('app.tenant'));
@@ -0,0 +1,2 @@
+-- the number of things of an owner is counted to enforce the thing quota
+CREATE INDEX IF NOT EXISTS things_owner_idx ON things (tenant, owner);
@@ -0,0 +1,6 @@
+-- the uses of share links with a maximum number of uses, rows of expired links can be deleted
+CREATE TABLE IF NOT EXISTS share_link_uses(
+    id text PRIMARY KEY,
+    uses integer NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
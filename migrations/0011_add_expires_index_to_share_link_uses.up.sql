@@ -0,0 +1,2 @@
+-- the uses of expired share links are deleted when a share link is used
+CREATE INDEX IF NOT EXISTS share_link_uses_expires_idx ON share_link_uses (expires);
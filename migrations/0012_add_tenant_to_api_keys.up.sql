@@ -0,0 +1,2 @@
+-- API keys are bound to a tenant, keys without tenant are rejected on the routes of things when tenancy is enabled
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant text NOT NULL DEFAULT '';
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix starts every API key so they are recognizable, for example by secret scanners
+const apiKeyPrefix = "ak_"
+
+// NewAPIKey generates an API key for the key identified by id, only the hash of its secret
+// should be stored
+func NewAPIKey(id string) (key string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	s := hex.EncodeToString(secret)
+	return apiKeyPrefix + id + "_" + s, HashSecret(s), nil
+}
+
+// APIKeyPrincipalID returns the ID of the principal authenticated with the API key identified by id
+func APIKeyPrincipalID(id string) string {
+	return "key:" + id
+}
+
+// ParseAPIKey splits an API key into the identifier and the secret of the key
+func ParseAPIKey(key string) (id string, secret string, ok bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", false
+	}
+	rest := key[len(apiKeyPrefix):]
+	i := strings.LastIndex(rest, "_")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// HashSecret hashes the secret of an API key, the secret is random so no salt is needed
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret reports whether secret matches hash in constant time
+func VerifySecret(secret string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
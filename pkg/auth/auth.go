@@ -0,0 +1,164 @@
+// Package auth authenticates requests with bearer tokens and authorizes them by the scopes of
+// the authenticated principal
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+)
+
+// Principal is the identity a request is authenticated as
+type Principal struct {
+	// ID is namespaced by the way the principal is authenticated, like key:<id> for API keys, so principals
+	// of different authenticators never share an ID
+	ID     string
+	Scopes []string
+	// Groups are the groups the principal is a member of, things can be shared with groups
+	Groups []string
+	// Claims are the claims of the token the principal is authenticated with, API keys only have the claims
+	// set by their authenticator, like the tenant a key is bound to
+	Claims map[string]interface{}
+}
+
+// HasScope reports whether the principal is granted scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of ctx, if any
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Authorize returns ErrNoCredentials when ctx carries no principal and ErrInsufficientScope when
+// the principal is not granted scope
+func Authorize(ctx context.Context, scope string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return ErrNoCredentials
+	}
+	if !p.HasScope(scope) {
+		return fmt.Errorf("%w: %s is required", ErrInsufficientScope, scope)
+	}
+	return nil
+}
+
+// Authenticator authenticates a bearer token, it returns ErrInvalidCredentials for tokens it
+// does not accept
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (Principal, error)
+}
+
+// Chain returns an Authenticator trying authenticators in order until one accepts the token,
+// ErrInvalidCredentials is returned when none do
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+type chain []Authenticator
+
+func (c chain) Authenticate(ctx context.Context, token string) (Principal, error) {
+	err := ErrInvalidCredentials
+	for _, a := range c {
+		var p Principal
+		p, err = a.Authenticate(ctx, token)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return p, err
+		}
+	}
+	return Principal{}, err
+}
+
+// Authenticate adds the principal authenticated by a from token to ctx, it is added to the log
+// statements using the returned context as well
+func Authenticate(ctx context.Context, a Authenticator, token string) (context.Context, error) {
+	if token == "" {
+		return ctx, ErrNoCredentials
+	}
+	p, err := a.Authenticate(ctx, token)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = NewContext(ctx, p)
+	return log.With(ctx, log.KV("principal", p.ID)), nil
+}
+
+// BearerToken returns the token of an Authorization header with the Bearer scheme
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Middleware authenticates requests with the bearer token in their Authorization header, requests
+// without valid credentials are answered with 401 Unauthorized
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := Authenticate(r.Context(), a, BearerToken(r.Header.Get("Authorization")))
+			switch {
+			case err == ErrNoCredentials:
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				httpx.AbortJSON(w, r, http.StatusUnauthorized, err)
+				return
+			case errors.Is(err, ErrInvalidCredentials):
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				httpx.AbortJSON(w, r, http.StatusUnauthorized, ErrInvalidCredentials)
+				return
+			case err != nil:
+				httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireScope answers requests whose principal is not granted scope with 403 Forbidden, and
+// requests without a principal with 401 Unauthorized
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			switch err := Authorize(r.Context(), scope); {
+			case err == ErrNoCredentials:
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				httpx.AbortJSON(w, r, http.StatusUnauthorized, err)
+				return
+			case err != nil:
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				httpx.AbortJSON(w, r, http.StatusForbidden, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
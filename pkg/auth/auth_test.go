@@ -0,0 +1,118 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+type tokens map[string]auth.Principal
+
+func (t tokens) Authenticate(ctx context.Context, token string) (auth.Principal, error) {
+	if token == "broken" {
+		return auth.Principal{}, errors.New("db unavailable")
+	}
+	p, ok := t[token]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	authenticator := tokens{
+		"reader": {ID: "key-1", Scopes: []string{"things:read"}},
+	}
+
+	var logs bytes.Buffer
+	logger := log.NewJSONLogger(&logs, "", false)
+	handler := auth.Middleware(authenticator)(auth.RequireScope("things:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		assert.True(t, ok)
+		logger.Info(r.Context(), "handled")
+		w.Write([]byte(p.ID))
+	})))
+
+	tests := []struct {
+		authorization   string
+		code            int
+		wwwAuthenticate string
+	}{
+		{"", http.StatusUnauthorized, "Bearer"},
+		{"Basic reader", http.StatusUnauthorized, "Bearer"},
+		{"Bearer unknown", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"Bearer broken", http.StatusInternalServerError, ""},
+		{"Bearer reader", http.StatusOK, ""},
+		{"bearer reader", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.authorization, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.code, w.Code)
+			assert.Equal(t, test.wwwAuthenticate, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	var line struct {
+		Principal string `json:"principal"`
+	}
+	require.NoError(t, json.Unmarshal(bytes.Split(logs.Bytes(), []byte("\n"))[0], &line))
+	assert.Equal(t, "key-1", line.Principal)
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := auth.RequireScope("things:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		scopes []string
+		code   int
+	}{
+		{"granted", []string{"things:read", "things:write"}, http.StatusOK},
+		{"insufficient", []string{"things:read"}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r = r.WithContext(auth.NewContext(r.Context(), auth.Principal{ID: "key-1", Scopes: test.scopes}))
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.code, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPIKey(t *testing.T) {
+	key, hash, err := auth.NewAPIKey("2c1d0a4e-7e4f-4b5e-9a0e-5b8f6a1d9c3b")
+	require.NoError(t, err)
+
+	id, secret, ok := auth.ParseAPIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "2c1d0a4e-7e4f-4b5e-9a0e-5b8f6a1d9c3b", id)
+	assert.True(t, auth.VerifySecret(secret, hash))
+	assert.False(t, auth.VerifySecret(secret+"0", hash))
+
+	for _, invalid := range []string{"", "ak_", "ak__secret", "ak_id_", "id_secret", "token"} {
+		_, _, ok := auth.ParseAPIKey(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
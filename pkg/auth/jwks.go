@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+const (
+	defaultCacheTTL        = time.Hour
+	defaultRefreshInterval = time.Minute
+	defaultFetchTimeout    = 10 * time.Second
+	maxKeySetSize          = 1 << 20
+)
+
+// KeySetError is returned when the key set cannot be loaded and no keys are cached
+type KeySetError struct {
+	Err error
+}
+
+func (e *KeySetError) Error() string {
+	return fmt.Sprintf("loading key set: %v", e.Err)
+}
+
+func (e *KeySetError) Unwrap() error {
+	return e.Err
+}
+
+// KeySet is a JSON Web Key Set loaded from a URL or a file. The keys are cached for an hour and
+// reloaded early when a token is signed with a key which is not in the set, so keys which are
+// rotated by the identity provider are picked up. When reloading fails the cached keys are used.
+// A single reload runs at a time without holding the lock, the cached keys are served while it runs.
+type KeySet struct {
+	load            func(ctx context.Context) ([]byte, error)
+	cacheTTL        time.Duration
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	loaded    time.Time
+	attempted time.Time
+	err       error
+	// reloading is closed when the running reload finishes, nil when no reload runs
+	reloading chan struct{}
+}
+
+type KeySetOption func(*KeySet)
+
+// WithCacheTTL reloads the key set after ttl instead of after an hour
+func WithCacheTTL(ttl time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.cacheTTL = ttl
+	}
+}
+
+// WithRefreshInterval limits how often the key set is reloaded for unknown keys or after a failure,
+// once a minute by default
+func WithRefreshInterval(interval time.Duration) KeySetOption {
+	return func(k *KeySet) {
+		k.refreshInterval = interval
+	}
+}
+
+// WithClock replaces time.Now
+func WithClock(now func() time.Time) KeySetOption {
+	return func(k *KeySet) {
+		k.now = now
+	}
+}
+
+// NewRemoteKeySet returns a KeySet loaded from url with client, a client with a timeout of 10 seconds when nil
+func NewRemoteKeySet(url string, client *http.Client, opts ...KeySetOption) *KeySet {
+	if client == nil {
+		client = &http.Client{Timeout: defaultFetchTimeout}
+	}
+	return newKeySet(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s answered %s", url, resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	}, opts)
+}
+
+// NewFileKeySet returns a KeySet loaded from the file at path
+func NewFileKeySet(path string, opts ...KeySetOption) *KeySet {
+	return newKeySet(func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, opts)
+}
+
+func newKeySet(load func(ctx context.Context) ([]byte, error), opts []KeySetOption) *KeySet {
+	k := &KeySet{
+		load:            load,
+		cacheTTL:        defaultCacheTTL,
+		refreshInterval: defaultRefreshInterval,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k
+}
+
+// Key returns the public key identified by kid, a token without kid is verified with the only
+// key of a set containing one key
+func (k *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if err := k.refresh(ctx, kid); err != nil {
+		return nil, &KeySetError{Err: err}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		return nil, &KeySetError{Err: k.err}
+	}
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh reloads the key set when it expired or does not contain kid. While another caller reloads,
+// a cached key is served right away and callers of other keys wait for the reload to finish.
+func (k *KeySet) refresh(ctx context.Context, kid string) error {
+	k.mu.Lock()
+	now := k.now()
+	_, known := k.keys[kid]
+	if reloading := k.reloading; reloading != nil {
+		k.mu.Unlock()
+		if known {
+			return nil
+		}
+		select {
+		case <-reloading:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	expired := k.keys == nil || now.Sub(k.loaded) >= k.cacheTTL
+	throttled := !k.attempted.IsZero() && now.Sub(k.attempted) < k.refreshInterval
+	if (!expired && known) || throttled {
+		k.mu.Unlock()
+		return nil
+	}
+	reloading := make(chan struct{})
+	k.reloading = reloading
+	k.attempted = now
+	k.mu.Unlock()
+
+	keys, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	if err != nil {
+		k.err = err
+	} else {
+		k.keys = keys
+		k.loaded = now
+		k.err = nil
+	}
+	k.reloading = nil
+	k.mu.Unlock()
+	close(reloading)
+	return nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := k.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySet(data)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseKeySet parses the signing keys of a JSON Web Key Set, keys of unsupported types are skipped
+func parseKeySet(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the public key of jwk, nil for unsupported key types
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("missing value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingMethods are the accepted algorithms, all asymmetric so the key set only holds public keys
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// JWTConfig configures a JWTAuthenticator
+type JWTConfig struct {
+	// Issuer is the required iss claim
+	Issuer string
+	// Audience is required in the aud claim
+	Audience string
+	// Keys verifies the signatures of the tokens
+	Keys *KeySet
+	// Leeway is the clock skew allowed when validating exp, nbf and iat
+	Leeway time.Duration
+	// Now replaces time.Now
+	Now func() time.Time
+}
+
+// JWTAuthenticator authenticates JSON Web Tokens issued by an OpenID Connect provider. The token
+// must be signed by a key of the key set and have an expiry, the issuer and the audience. The ID of the
+// principal is jwt:<iss>|<sub> and the scope claim, or the scp claim, holds its scopes.
+// The groups claim, a list of strings, holds the groups of the principal.
+type JWTAuthenticator struct {
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+func NewJWTAuthenticator(config JWTConfig) *JWTAuthenticator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+	}
+	if config.Now != nil {
+		opts = append(opts, jwt.WithTimeFunc(config.Now))
+	}
+	return &JWTAuthenticator{
+		keys:   config.Keys,
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	if strings.Count(token, ".") != 2 {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.Key(ctx, kid)
+	})
+	var keySetErr *KeySetError
+	if errors.As(err, &keySetErr) {
+		return Principal{}, keySetErr
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	issuer, _ := claims["iss"].(string)
+	return Principal{ID: JWTPrincipalID(issuer, subject), Scopes: scopes(claims), Groups: groups(claims), Claims: claims}, nil
+}
+
+// JWTPrincipalID returns the ID of the principal of a token with the iss and sub claims, the subject is only
+// unique for its issuer
+func JWTPrincipalID(issuer string, subject string) string {
+	return "jwt:" + issuer + "|" + subject
+}
+
+// groups returns the groups claim
+func groups(claims jwt.MapClaims) []string {
+	list, _ := claims["groups"].([]interface{})
+	var groups []string
+	for _, g := range list {
+		if g, ok := g.(string); ok {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// scopes returns the space separated scope claim, or the scp claim which is either a list or
+// space separated
+func scopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		var scopes []string
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+)
+
+const (
+	issuer   = "https://sso.example.com/"
+	audience = "api.ldej.nl"
+)
+
+// signingKey is a locally generated key of a test identity provider
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) signingKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodRS256, key: key}
+}
+
+func newECKey(t *testing.T, kid string) signingKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodES256, key: key}
+}
+
+func newEdKey(t *testing.T, kid string) signingKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodEdDSA, key: key}
+}
+
+func (k signingKey) jwk() map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch public := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig", "n": encode(public.N.Bytes()), "e": encode(big.NewInt(int64(public.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256", "x": encode(public.X.FillBytes(make([]byte, 32))), "y": encode(public.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": encode(public)}
+	}
+	panic("unsupported key")
+}
+
+func (k signingKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func keySet(t *testing.T, keys ...signingKey) []byte {
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, key := range keys {
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+	// keys which are not for signatures are skipped
+	jwks.Keys = append(jwks.Keys, map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"})
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	return data
+}
+
+func claims(overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	c := jwt.MapClaims{
+		"iss":   issuer,
+		"aud":   audience,
+		"sub":   "user-1",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"scope": "things:read things:write",
+	}
+	for key, value := range overrides {
+		if value == nil {
+			delete(c, key)
+			continue
+		}
+		c[key] = value
+	}
+	return c
+}
+
+// jwksServer serves the key set returned by keys and counts the requests
+func jwksServer(t *testing.T, keys func() []byte) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(keys())
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, ecKey, edKey := newRSAKey(t, "rsa"), newECKey(t, "ec"), newEdKey(t, "ed")
+	server, _ := jwksServer(t, func() []byte { return keySet(t, rsaKey, ecKey, edKey) })
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Issuer:   issuer,
+		Audience: audience,
+		Keys:     auth.NewRemoteKeySet(server.URL, nil),
+	})
+
+	p, err := authenticator.Authenticate(context.Background(), rsaKey.sign(t, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, auth.JWTPrincipalID(issuer, "user-1"), p.ID)
+	assert.Equal(t, []string{"things:read", "things:write"}, p.Scopes)
+	assert.Equal(t, issuer, p.Claims["iss"])
+	assert.Empty(t, p.Groups)
+
+	p, err = authenticator.Authenticate(context.Background(), ecKey.sign(t, claims(jwt.MapClaims{"scope": nil, "scp": []string{"things:read"}, "aud": []string{"other", audience}, "groups": []string{"editors", "ops"}})))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"things:read"}, p.Scopes)
+	assert.Equal(t, []string{"editors", "ops"}, p.Groups)
+
+	_, err = authenticator.Authenticate(context.Background(), edKey.sign(t, claims(nil)))
+	assert.NoError(t, err)
+
+	otherKey := newRSAKey(t, "rsa")
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	invalid := map[string]string{
+		"wrong issuer":       rsaKey.sign(t, claims(jwt.MapClaims{"iss": "https://evil.example.com/"})),
+		"wrong audience":     rsaKey.sign(t, claims(jwt.MapClaims{"aud": "other"})),
+		"expired":            rsaKey.sign(t, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})),
+		"no expiry":          rsaKey.sign(t, claims(jwt.MapClaims{"exp": nil})),
+		"not yet valid":      rsaKey.sign(t, claims(jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"no subject":         rsaKey.sign(t, claims(jwt.MapClaims{"sub": nil})),
+		"wrong signature":    otherKey.sign(t, claims(nil)),
+		"unknown key":        newRSAKey(t, "unknown").sign(t, claims(nil)),
+		"symmetric":          hmacToken,
+		"unsigned":           noneToken,
+		"not a token":        "ak_id_secret",
+		"malformed":          "a.b.c",
+		"mismatched keytype": signingKey{kid: "ec", method: jwt.SigningMethodRS256, key: otherKey.key}.sign(t, claims(nil)),
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := authenticator.Authenticate(context.Background(), token)
+			assert.True(t, errors.Is(err, auth.ErrInvalidCredentials), err)
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, newKey := newRSAKey(t, "2026-01"), newRSAKey(t, "2026-07")
+	current := keySet(t, oldKey)
+	server, requests := jwksServer(t, func() []byte { return current })
+
+	now := time.Now()
+	keys := auth.NewRemoteKeySet(server.URL, nil, auth.WithClock(func() time.Time { return now }))
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: issuer, Audience: audience, Keys: keys})
+
+	for i := 0; i < 3; i++ {
+		_, err := authenticator.Authenticate(context.Background(), oldKey.sign(t, claims(nil)))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests), "the key set is cached")
+
+	// a token signed with a new key reloads the key set
+	current = keySet(t, oldKey, newKey)
+	now = now.Add(2 * time.Minute)
+	_, err := authenticator.Authenticate(context.Background(), newKey.sign(t, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	// unknown keys reload the key set at most once a minute
+	for i := 0; i < 3; i++ {
+		_, err = authenticator.Authenticate(context.Background(), newRSAKey(t, "unknown").sign(t, claims(nil)))
+		assert.True(t, errors.Is(err, auth.ErrInvalidCredentials))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	// the cached keys are used when the key set cannot be reloaded
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	now = now.Add(2 * time.Hour)
+	_, err = authenticator.Authenticate(context.Background(), newKey.sign(t, claims(nil)))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+}
+
+func TestKeySetServesCachedKeysWhileReloading(t *testing.T) {
+	key := newRSAKey(t, "rsa")
+	release := make(chan struct{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the reload after the cache expired hangs until it is released
+		if atomic.AddInt32(&requests, 1) > 1 {
+			<-release
+		}
+		w.Write(keySet(t, key))
+	}))
+	t.Cleanup(server.Close)
+
+	start := time.Now()
+	var elapsed int64
+	clock := func() time.Time { return start.Add(time.Duration(atomic.LoadInt64(&elapsed))) }
+	keys := auth.NewRemoteKeySet(server.URL, nil, auth.WithClock(clock))
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: issuer, Audience: audience, Keys: keys})
+	token := key.sign(t, claims(nil))
+
+	_, err := authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+
+	atomic.StoreInt64(&elapsed, int64(2*time.Hour))
+	reloaded := make(chan error)
+	go func() {
+		_, err := authenticator.Authenticate(context.Background(), token)
+		reloaded <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 2 }, time.Second, time.Millisecond)
+
+	// the cached key is served while the reload hangs
+	served := make(chan error)
+	go func() {
+		_, err := authenticator.Authenticate(context.Background(), token)
+		served <- err
+	}()
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("the cached key is not served while reloading")
+	}
+
+	close(release)
+	assert.NoError(t, <-reloaded)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "a single reload runs at a time")
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	keys := auth.NewFileKeySet(filepath.Join(t.TempDir(), "missing.json"))
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: issuer, Audience: audience, Keys: keys})
+
+	_, err := authenticator.Authenticate(context.Background(), newRSAKey(t, "rsa").sign(t, claims(nil)))
+	var keySetErr *auth.KeySetError
+	assert.True(t, errors.As(err, &keySetErr), err)
+	assert.False(t, errors.Is(err, auth.ErrInvalidCredentials))
+}
+
+func TestFileKeySet(t *testing.T) {
+	key := newECKey(t, "")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, keySet(t, key), 0600))
+
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: issuer, Audience: audience, Keys: auth.NewFileKeySet(path)})
+
+	// a token without kid is verified with the only key of the set
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims(nil))
+	signed, err := token.SignedString(key.key)
+	require.NoError(t, err)
+	p, err := authenticator.Authenticate(context.Background(), signed)
+	require.NoError(t, err)
+	assert.Equal(t, auth.JWTPrincipalID(issuer, "user-1"), p.ID)
+}
+
+func TestChain(t *testing.T) {
+	key := newRSAKey(t, "rsa")
+	server, _ := jwksServer(t, func() []byte { return keySet(t, key) })
+	authenticator := auth.Chain(
+		tokens{"reader": {ID: "key-1", Scopes: []string{"things:read"}}},
+		auth.NewJWTAuthenticator(auth.JWTConfig{Issuer: issuer, Audience: audience, Keys: auth.NewRemoteKeySet(server.URL, nil)}),
+	)
+
+	p, err := authenticator.Authenticate(context.Background(), "reader")
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", p.ID)
+
+	p, err = authenticator.Authenticate(context.Background(), key.sign(t, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, auth.JWTPrincipalID(issuer, "user-1"), p.ID)
+
+	_, err = authenticator.Authenticate(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, auth.ErrInvalidCredentials))
+
+	_, err = authenticator.Authenticate(context.Background(), "broken")
+	assert.EqualError(t, err, "db unavailable")
+}
@@ -0,0 +1,20 @@
+// Package blob stores binary objects by key
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores binary objects, keys are slash separated paths such as "thing/attachment"
+type Store interface {
+	// Put stores the content read from r under key, replacing an existing blob
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns a reader for the blob stored under key, which must be closed by the caller
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete deletes the blob stored under key, deleting a blob which does not exist is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,56 @@
+package blob_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/pkg/blob"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := blob.NewFileStore(dir)
+	assert.NoError(t, err)
+
+	err = store.Put(ctx, "thing/attachment", bytes.NewBufferString("content"))
+	assert.NoError(t, err)
+
+	r, err := store.Get(ctx, "thing/attachment")
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "content", string(content))
+
+	err = store.Delete(ctx, "thing/attachment")
+	assert.NoError(t, err)
+
+	_, err = store.Get(ctx, "thing/attachment")
+	assert.Equal(t, blob.ErrNotFound, err)
+
+	_, err = os.Stat(filepath.Join(dir, "thing"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = store.Delete(ctx, "thing/attachment")
+	assert.NoError(t, err)
+}
+
+func TestFileStoreInvalidKey(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := blob.NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "thing/../../outside", "thing/.hidden", "thing//attachment"} {
+		err := store.Put(ctx, key, bytes.NewBufferString("content"))
+		assert.Error(t, err, key)
+	}
+}
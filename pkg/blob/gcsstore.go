@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+var _ Store = (*gcsStore)(nil)
+
+type gcsStore struct {
+	bucket *storage.BucketHandle
+}
+
+// NewGCSStore stores blobs as objects in a Google Cloud Storage bucket, keys are used as object names
+func NewGCSStore(ctx context.Context, bucket string) (Store, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStore{bucket: client.Bucket(bucket)}, nil
+}
+
+// Put uploads the blob in a single object write, which replaces an existing object only once it succeeded
+func (s *gcsStore) Put(ctx context.Context, key string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		// canceling the context aborts the upload
+		cancel()
+		//nolint:errcheck
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *gcsStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *gcsStore) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+// Package client implements a typed client for the thing API
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetries      = 3
+	defaultRetryWait    = 100 * time.Millisecond
+	defaultRetryMaxWait = 2 * time.Second
+)
+
+type Client struct {
+	resty *resty.Client
+}
+
+type Option func(*resty.Client)
+
+// WithTimeout sets the timeout of a single attempt of a request, defaults to 30 seconds
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *resty.Client) {
+		c.SetTimeout(timeout)
+	}
+}
+
+// WithRetries sets how many times a failed idempotent request is retried, with an exponential backoff
+// starting at wait and capped at maxWait. Defaults to 3 retries between 100 milliseconds and 2 seconds.
+func WithRetries(count int, wait time.Duration, maxWait time.Duration) Option {
+	return func(c *resty.Client) {
+		c.SetRetryCount(count)
+		c.SetRetryWaitTime(wait)
+		c.SetRetryMaxWaitTime(maxWait)
+	}
+}
+
+// WithHeader sets a header on every request, for example for credentials
+func WithHeader(key string, value string) Option {
+	return func(c *resty.Client) {
+		c.SetHeader(key, value)
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to send requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *resty.Client) {
+		c.SetTransport(transport)
+	}
+}
+
+// New creates a client for the API at baseURL, e.g. https://api.ldej.nl
+func New(baseURL string, opts ...Option) *Client {
+	r := resty.New().
+		SetHostURL(baseURL).
+		SetTimeout(defaultTimeout).
+		SetRetryCount(defaultRetries).
+		SetRetryWaitTime(defaultRetryWait).
+		SetRetryMaxWaitTime(defaultRetryMaxWait).
+		AddRetryCondition(retryable).
+		OnBeforeRequest(propagateTrace).
+		SetLogger(discardLogger{})
+	for _, opt := range opts {
+		opt(r)
+	}
+	return &Client{resty: r}
+}
+
+// retryable retries requests that can safely be repeated when they failed to get a response,
+// or when the server is overloaded or failed
+func retryable(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	switch resp.Request.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode() == http.StatusTooManyRequests || resp.StatusCode() >= http.StatusInternalServerError
+}
+
+// propagateTrace injects the trace context of the request context with the propagator registered with
+// otel.SetTextMapPropagator, like traceparent and tracestate, and otherwise sets the trace header as added
+// by log.Logger.Tracer, so requests made while handling a request end up in the same trace. Headers set on
+// the request are kept.
+func propagateTrace(_ *resty.Client, req *resty.Request) error {
+	headers := http.Header{}
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(headers))
+	trace, ok := req.Context().Value(log.CloudTraceContextKey).(string)
+	if ok && trace != "" && headers.Get(log.TraceHeader) == "" {
+		headers.Set(log.TraceHeader, trace)
+	}
+	for key := range headers {
+		if req.Header.Get(key) == "" {
+			req.SetHeader(key, headers.Get(key))
+		}
+	}
+	return nil
+}
+
+// discardLogger silences resty, failed requests are reported through the returned errors
+type discardLogger struct{}
+
+func (discardLogger) Errorf(string, ...interface{}) {}
+func (discardLogger) Warnf(string, ...interface{})  {}
+func (discardLogger) Debugf(string, ...interface{}) {}
+
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Error is returned for responses with an error status code, Message and Fields are decoded from httpx.ErrorResponse.
+// Use errors.Is with ErrBadRequest, ErrNotFound, ErrConflict, ErrUnauthorized or ErrForbidden to check the status.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     []httpx.FieldError
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// request creates a request decoding an error response as httpx.ErrorResponse
+func (c *Client) request(ctx context.Context) *resty.Request {
+	return c.resty.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json").
+		SetError(&httpx.ErrorResponse{})
+}
+
+// check converts error responses into an Error
+func check(resp *resty.Response, err error) (*resty.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsError() {
+		return resp, nil
+	}
+	apiErr := &Error{StatusCode: resp.StatusCode()}
+	if errorResponse, ok := resp.Error().(*httpx.ErrorResponse); ok {
+		apiErr.Message = errorResponse.Error
+		apiErr.Fields = errorResponse.Fields
+	}
+	return nil, apiErr
+}
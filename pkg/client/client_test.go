@@ -0,0 +1,173 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/pkg/client"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func newClient(t *testing.T, handler http.HandlerFunc) *client.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return client.New(server.URL, client.WithRetries(2, time.Millisecond, time.Millisecond))
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestGetThing(t *testing.T) {
+	var trace string
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/thing/abc", r.URL.Path)
+		trace = r.Header.Get(log.TraceHeader)
+		writeJSON(w, http.StatusOK, client.Thing{UUID: "abc", Name: "name"})
+	})
+
+	ctx := context.WithValue(context.Background(), log.CloudTraceContextKey, "trace/1;o=1")
+	thing, err := c.GetThing(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "name", thing.Name)
+	assert.Equal(t, "trace/1;o=1", trace)
+}
+
+func TestPropagateTraceContext(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	var headers http.Header
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		writeJSON(w, http.StatusOK, client.Thing{UUID: "abc"})
+	})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("vendor=value")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	}))
+	ctx = context.WithValue(ctx, log.CloudTraceContextKey, "trace/1;o=1")
+	_, err := c.GetThing(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", headers.Get("traceparent"))
+	assert.Equal(t, "vendor=value", headers.Get("tracestate"))
+	assert.Equal(t, "trace/1;o=1", headers.Get(log.TraceHeader))
+}
+
+func TestError(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, httpx.ErrorResponse{
+			Error:  "invalid data",
+			Fields: []httpx.FieldError{{Field: "/data/port", Message: "expected integer"}},
+		})
+	})
+
+	_, err := c.CreateThing(context.Background(), client.CreateThing{Name: "name"})
+	assert.True(t, errors.Is(err, client.ErrBadRequest))
+	assert.False(t, errors.Is(err, client.ErrNotFound))
+
+	var apiErr *client.Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "invalid data", apiErr.Message)
+	assert.Equal(t, "/data/port", apiErr.Fields[0].Field)
+}
+
+func TestRetries(t *testing.T) {
+	attempts := 0
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			writeJSON(w, http.StatusServiceUnavailable, httpx.ErrorResponse{Error: "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, client.Thing{UUID: "abc"})
+	})
+
+	_, err := c.GetThing(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// creating a thing is not idempotent so it is not retried
+	attempts = 0
+	_, err = c.CreateThing(context.Background(), client.CreateThing{Name: "name"})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestUpdateThing(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "", body["parent"])
+		writeJSON(w, http.StatusCreated, client.Thing{UUID: "abc"})
+	})
+
+	root := ""
+	_, created, err := c.UpdateThing(context.Background(), "abc", client.UpdateThing{Name: "name", Parent: &root})
+	assert.NoError(t, err)
+	assert.True(t, created)
+}
+
+func TestUpdateThingLabels(t *testing.T) {
+	var bodies []map[string]interface{}
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+		writeJSON(w, http.StatusOK, client.Thing{UUID: "abc"})
+	})
+
+	cleared := map[string]string{}
+	for _, thing := range []client.UpdateThing{{Value: "kept"}, {Value: "cleared", Labels: &cleared}} {
+		_, _, err := c.UpdateThing(context.Background(), "abc", thing)
+		assert.NoError(t, err)
+	}
+	assert.NotContains(t, bodies[0], "labels")
+	assert.Equal(t, map[string]interface{}{}, bodies[1]["labels"])
+}
+
+func TestIterateThings(t *testing.T) {
+	total := 25
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "env=prod", r.URL.Query().Get("labelSelector"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		things := client.Things{Page: page, Limit: limit, Total: total, Things: []client.Thing{}}
+		for i := (page - 1) * limit; i < page*limit && i < total; i++ {
+			things.Things = append(things.Things, client.Thing{UUID: fmt.Sprint(i)})
+		}
+		writeJSON(w, http.StatusOK, things)
+	})
+
+	var uuids []string
+	it := c.IterateThings(context.Background(), client.ListOptions{Limit: 10, LabelSelector: "env=prod"})
+	for it.Next() {
+		uuids = append(uuids, it.Thing().UUID)
+	}
+	assert.NoError(t, it.Err())
+	assert.Len(t, uuids, total)
+	assert.Equal(t, "24", uuids[24])
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Thing struct {
+	UUID   string            `json:"uuid"`
+	Name   string            `json:"name"`
+	Value  string            `json:"value"`
+	Labels map[string]string `json:"labels"`
+	Parent string            `json:"parent,omitempty"`
+
+	Kind        string          `json:"kind,omitempty"`
+	KindVersion int             `json:"kindVersion,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+
+	Updated time.Time `json:"updated"`
+	Created time.Time `json:"created"`
+}
+
+type Things struct {
+	Total  int     `json:"total"`
+	Page   int     `json:"page"`
+	Limit  int     `json:"limit"`
+	Things []Thing `json:"things"`
+}
+
+type CreateThing struct {
+	Name   string            `json:"name"`
+	Value  string            `json:"value,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Kind   string            `json:"kind,omitempty"`
+	Data   json.RawMessage   `json:"data,omitempty"`
+	Parent string            `json:"parent,omitempty"`
+}
+
+type UpdateThing struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Labels replace the labels of the thing, they are kept when nil and a pointer to an empty map removes them
+	Labels *map[string]string `json:"labels,omitempty"`
+	Kind   string             `json:"kind,omitempty"`
+	Data   json.RawMessage    `json:"data,omitempty"`
+	// Parent moves the thing, an empty string moves it to the root, it is kept when nil
+	Parent *string `json:"parent,omitempty"`
+}
+
+type ListOptions struct {
+	// Page starts at 1, defaults to the first page
+	Page int
+	// Limit is the number of things per page, the API defaults to 10 and allows at most 100
+	Limit int
+	// LabelSelector filters things on their labels, e.g. env=prod,team in (a,b),!deprecated
+	LabelSelector string
+}
+
+func (c *Client) GetThing(ctx context.Context, uuid string) (Thing, error) {
+	var thing Thing
+	_, err := check(c.request(ctx).SetResult(&thing).SetPathParam("uuid", uuid).Get("/v1/thing/{uuid}"))
+	if err != nil {
+		return Thing{}, err
+	}
+	return thing, nil
+}
+
+// CreateThing creates a thing with a uuid chosen by the server, it is never retried
+func (c *Client) CreateThing(ctx context.Context, thing CreateThing) (Thing, error) {
+	var created Thing
+	_, err := check(c.request(ctx).SetResult(&created).SetBody(thing).Post("/v1/thing/new"))
+	if err != nil {
+		return Thing{}, err
+	}
+	return created, nil
+}
+
+// UpdateThing updates the thing with uuid, or creates it when it does not exist yet and a name is given.
+// The returned bool reports whether the thing was created.
+func (c *Client) UpdateThing(ctx context.Context, uuid string, thing UpdateThing) (Thing, bool, error) {
+	var updated Thing
+	resp, err := check(c.request(ctx).SetResult(&updated).SetPathParam("uuid", uuid).SetBody(thing).Put("/v1/thing/{uuid}"))
+	if err != nil {
+		return Thing{}, false, err
+	}
+	return updated, resp.StatusCode() == http.StatusCreated, nil
+}
+
+// DeleteThing deletes a thing, with cascade its descendants are deleted as well,
+// without it deleting a thing with children fails with ErrConflict
+func (c *Client) DeleteThing(ctx context.Context, uuid string, cascade bool) error {
+	req := c.request(ctx).SetPathParam("uuid", uuid)
+	if cascade {
+		req.SetQueryParam("cascade", "true")
+	}
+	_, err := check(req.Delete("/v1/thing/{uuid}"))
+	return err
+}
+
+// ListThings returns a single page of things, use IterateThings to go through all pages
+func (c *Client) ListThings(ctx context.Context, options ListOptions) (Things, error) {
+	req := c.request(ctx)
+	if options.Page > 0 {
+		req.SetQueryParam("page", strconv.Itoa(options.Page))
+	}
+	if options.Limit > 0 {
+		req.SetQueryParam("limit", strconv.Itoa(options.Limit))
+	}
+	if options.LabelSelector != "" {
+		req.SetQueryParam("labelSelector", options.LabelSelector)
+	}
+
+	var things Things
+	_, err := check(req.SetResult(&things).Get("/v1/thing"))
+	if err != nil {
+		return Things{}, err
+	}
+	return things, nil
+}
+
+// IterateThings returns an iterator over all things matching options starting at options.Page,
+// pages are retrieved when needed
+//
+//	it := c.IterateThings(ctx, client.ListOptions{Limit: 100})
+//	for it.Next() {
+//		thing := it.Thing()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+func (c *Client) IterateThings(ctx context.Context, options ListOptions) *ThingIterator {
+	if options.Page < 1 {
+		options.Page = 1
+	}
+	return &ThingIterator{client: c, ctx: ctx, options: options}
+}
+
+// ThingIterator iterates over the pages of ListThings
+type ThingIterator struct {
+	client  *Client
+	ctx     context.Context
+	options ListOptions
+
+	things []Thing
+	thing  Thing
+	done   bool
+	err    error
+}
+
+// Next advances to the next thing, it returns false when there are no more things or an error occurred
+func (it *ThingIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.things) == 0 {
+		if it.done {
+			return false
+		}
+		page, err := it.client.ListThings(it.ctx, it.options)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.things = page.Things
+		it.done = len(page.Things) == 0 || page.Page*page.Limit >= page.Total
+		it.options.Page++
+		if len(it.things) == 0 {
+			return false
+		}
+	}
+	it.thing, it.things = it.things[0], it.things[1:]
+	return true
+}
+
+// Thing returns the current thing
+func (it *ThingIterator) Thing() Thing {
+	return it.thing
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *ThingIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,185 @@
+// Package health reports whether a server is alive and ready to serve requests, readiness is
+// determined by checking the dependencies of the server
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+var (
+	ErrDraining = errors.New("the server is shutting down")
+	ErrTimeout  = errors.New("the check timed out")
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Check returns an error when a dependency is unavailable, it should return when ctx is done
+type Check func(ctx context.Context) error
+
+// reportTTL is how long Ready answers with the same report by default, so requests cannot cause a
+// check each
+const reportTTL = time.Second
+
+// Result is the outcome of a single check
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	// Latency is the duration of the check in milliseconds
+	Latency float64 `json:"latencyMs"`
+	// Error is the error of a check, it is only published for ErrTimeout and ErrDraining as the errors of
+	// dependencies can contain their addresses and users
+	Error string `json:"error,omitempty"`
+}
+
+// Report is up when all of its checks are up
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs checks concurrently, every check is given at most timeout. The errors of failed checks
+// are logged.
+type Checker struct {
+	log      *log.Logger
+	checks   []namedCheck
+	timeout  time.Duration
+	draining int32
+
+	mu        sync.Mutex
+	reportTTL time.Duration
+	report    Report
+	checked   time.Time
+}
+
+func NewChecker(timeout time.Duration, logger *log.Logger) *Checker {
+	return &Checker{timeout: timeout, log: logger, reportTTL: reportTTL}
+}
+
+// Add adds a check named name, checks are reported in the order they are added
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run runs all checks and reports their results
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Checks: make([]Result, len(c.checks))}
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// run runs check, a check which does not return in time is reported as down and left to finish
+func (c *Checker) run(ctx context.Context, check namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	result := Result{
+		Name:    check.name,
+		Status:  StatusUp,
+		Latency: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		c.log.Error(ctx, fmt.Errorf("health check %s: %w", check.name, err))
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// publicReport runs all checks at most once per reportTTL of c and leaves out the errors of dependencies
+func (c *Checker) publicReport(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < c.reportTTL {
+		return c.report
+	}
+
+	report := c.Run(ctx)
+	for i, result := range report.Checks {
+		if result.Error != ErrTimeout.Error() {
+			report.Checks[i].Error = ""
+		}
+	}
+	c.report, c.checked = report, time.Now()
+	return report
+}
+
+// Drain makes the server unready for good, so load balancers stop sending requests before it shuts down
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+}
+
+// Draining reports whether Drain was called
+func (c *Checker) Draining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+// Live answers 200 OK as long as the server is able to serve requests, it does not check dependencies
+// as restarting the server does not make them available
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.JSON(w, r, Report{Status: StatusUp})
+}
+
+// Ready answers 200 OK with the report of all checks when they are up, and 503 Service Unavailable
+// when any of them is down or the server is draining. The report is reused for reportTTL and only
+// contains the status and latency of every check.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if c.Draining() {
+		httpx.JSONStatus(w, r, http.StatusServiceUnavailable, Report{
+			Status: StatusDown,
+			Checks: []Result{{Name: "shutdown", Status: StatusDown, Error: ErrDraining.Error()}},
+		})
+		return
+	}
+	report := c.publicReport(r.Context())
+	code := http.StatusOK
+	if report.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	httpx.JSONStatus(w, r, code, report)
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+func ready(t *testing.T, c *Checker) (int, Report) {
+	w := httptest.NewRecorder()
+	c.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report), w.Body.String())
+	return w.Code, report
+}
+
+func TestChecker(t *testing.T) {
+	var dbErr error
+	logs := &bytes.Buffer{}
+	c := NewChecker(50*time.Millisecond, log.NewJSONLogger(logs, "", false))
+	c.reportTTL = 0
+	c.Add("db", func(ctx context.Context) error {
+		return dbErr
+	})
+	c.Add("blobs", func(ctx context.Context) error {
+		return nil
+	})
+
+	code, report := ready(t, c)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusUp, report.Status)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, "db", report.Checks[0].Name)
+	assert.Equal(t, "blobs", report.Checks[1].Name)
+
+	dbErr = errors.New("connection refused")
+	code, report = ready(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	// the errors of dependencies are only logged
+	assert.Equal(t, Result{Name: "db", Status: StatusDown, Latency: report.Checks[0].Latency}, report.Checks[0])
+	assert.Equal(t, StatusUp, report.Checks[1].Status)
+	assert.Contains(t, logs.String(), "health check db: connection refused")
+
+	// liveness does not depend on the checks
+	w := httptest.NewRecorder()
+	c.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"up"}`, w.Body.String())
+
+	dbErr = nil
+	c.Drain()
+	code, report = ready(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []Result{{Name: "shutdown", Status: StatusDown, Error: ErrDraining.Error()}}, report.Checks)
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	c := NewChecker(10*time.Millisecond, log.NewJSONLogger(&bytes.Buffer{}, "", false))
+	c.Add("stuck", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+
+	report := c.Run(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, ErrTimeout.Error(), report.Checks[0].Error)
+	assert.GreaterOrEqual(t, report.Checks[0].Latency, 10.0)
+}
+
+func TestCheckerReportTTL(t *testing.T) {
+	checks := 0
+	c := NewChecker(10*time.Millisecond, log.NewJSONLogger(&bytes.Buffer{}, "", false))
+	c.Add("db", func(ctx context.Context) error {
+		checks++
+		return nil
+	})
+
+	// readiness requests within reportTTL share a report
+	ready(t, c)
+	ready(t, c)
+	assert.Equal(t, 1, checks)
+}
@@ -0,0 +1,52 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+)
+
+// MaxBodySize limits request bodies to n bytes, reading beyond the limit fails with ErrBodyTooLarge and so
+// does reading a body with a larger Content-Length, before anything is read. MaxBodySize applied to a route
+// replaces the limit of the router, like for uploads which may be larger than other bodies.
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if body, ok := r.Body.(*maxBytesReader); ok {
+				body.limit = n
+			} else {
+				r.Body = &maxBytesReader{ReadCloser: r.Body, contentLength: r.ContentLength, limit: n}
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// maxBytesReader fails with ErrBodyTooLarge once more than limit bytes are read
+type maxBytesReader struct {
+	io.ReadCloser
+	contentLength int64
+	limit         int64
+	read          int64
+}
+
+func (b *maxBytesReader) Read(p []byte) (int, error) {
+	if b.contentLength > b.limit || b.read > b.limit {
+		return 0, ErrBodyTooLarge
+	}
+	remaining := b.limit - b.read
+	// read one byte more than remaining to find out whether the body is too large
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return int(remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	var decodeErr error
+	decode := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			_, decodeErr = io.ReadAll(r.Body)
+			return
+		}
+		var decoded item
+		decodeErr = Decode(r, &decoded)
+	})
+	handler := MaxBodySize(16)(decode)
+	// a route can replace the limit of the router, for multipart bodies as well
+	raised := MaxBodySize(16)(MaxBodySize(32)(decode))
+
+	tests := []struct {
+		handler       http.Handler
+		contentType   string
+		body          string
+		contentLength bool
+		err           error
+	}{
+		{handler: handler, body: `{"name": "abc"}`, contentLength: true},
+		{handler: handler, body: `{"name": "abcde"}`, contentLength: true, err: ErrBodyTooLarge},
+		{handler: handler, body: `{"name": "abc"}`},
+		{handler: handler, body: `{"name": "abcde"}`, err: ErrBodyTooLarge},
+		{handler: handler, contentType: "multipart/form-data; boundary=x", body: strings.Repeat("a", 32), err: ErrBodyTooLarge},
+		{handler: raised, body: `{"name": "abcde"}`, contentLength: true},
+		{handler: raised, body: `{"name": "abcdefghijklmnopqrstuvwxyz"}`, err: ErrBodyTooLarge},
+	}
+	for _, test := range tests {
+		decodeErr = nil
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if !test.contentLength {
+			// a chunked body
+			r.ContentLength = -1
+		}
+		test.handler.ServeHTTP(httptest.NewRecorder(), r)
+		assert.ErrorIs(t, decodeErr, test.err, test.body)
+	}
+}
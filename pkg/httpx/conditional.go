@@ -0,0 +1,106 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag is an entity tag. Strong tags are only equal for byte for byte equal representations, weak
+// tags for equivalent representations like a resource in different encodings.
+type ETag struct {
+	Tag  string
+	Weak bool
+}
+
+// StrongETag returns the strong tag of a representation
+func StrongETag(data []byte) ETag {
+	return ETag{Tag: hash(data)}
+}
+
+// WeakETag returns the weak tag of the version of a resource, identified by its parts
+func WeakETag(parts ...string) ETag {
+	return ETag{Tag: hash([]byte(strings.Join(parts, "\n"))), Weak: true}
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:18])
+}
+
+func (e ETag) String() string {
+	if e.Weak {
+		return fmt.Sprintf(`W/"%s"`, e.Tag)
+	}
+	return fmt.Sprintf(`"%s"`, e.Tag)
+}
+
+// Versioned is implemented by responses which know their version. Typed handlers answer GET requests
+// for them with a weak ETag and Last-Modified, unless modified is zero, instead of a strong ETag
+// of their representation.
+type Versioned interface {
+	Version() (etag ETag, modified time.Time)
+}
+
+// writeConditional writes the successful response body to a GET request with its validators, or
+// 304 Not Modified when the validators match the preconditions of r
+func writeConditional(w http.ResponseWriter, r *http.Request, body interface{}) {
+	code, contentType, data, err := encode(w, r, http.StatusOK, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if code != http.StatusOK {
+		send(w, code, contentType, data)
+		return
+	}
+
+	etag := StrongETag(data)
+	var modified time.Time
+	if versioned, ok := body.(Versioned); ok {
+		etag, modified = versioned.Version()
+	}
+	w.Header().Set("ETag", etag.String())
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	send(w, code, contentType, data)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when it is absent, as in RFC 9110
+func notModified(r *http.Request, etag ETag, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchesWeakly(inm, etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// matchesWeakly reports whether the If-None-Match header inm lists etag, comparing weakly
+func matchesWeakly(inm string, etag ETag) bool {
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`) == etag.Tag {
+			return true
+		}
+	}
+	return false
+}
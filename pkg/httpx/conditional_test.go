@@ -0,0 +1,104 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedItem struct {
+	item
+	updated time.Time
+}
+
+func (v versionedItem) Version() (ETag, time.Time) {
+	return WeakETag(v.Name, v.updated.Format(time.RFC3339Nano)), v.updated
+}
+
+func getConditional(h http.Handler, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/items/abc", nil)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestConditionalStrong(t *testing.T) {
+	count := 1
+	h := Handle(testConfig, func(ctx context.Context, req struct{}) (item, error) {
+		return item{Name: "abc", Count: count}, nil
+	})
+
+	w := getConditional(h, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[A-Za-z0-9_-]+"$`, etag)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+
+	w = getConditional(h, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	// every encoding has its own strong tag
+	w = getConditional(h, http.Header{"Accept": {MediaTypeYAML}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	count = 2
+	w = getConditional(h, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = getConditional(h, http.Header{"If-None-Match": {`"other", *`}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestConditionalVersioned(t *testing.T) {
+	updated := time.Date(2026, time.October, 19, 12, 0, 0, 500, time.UTC)
+	h := Handle(testConfig, func(ctx context.Context, req struct{}) (versionedItem, error) {
+		return versionedItem{item: item{Name: "abc"}, updated: updated}, nil
+	})
+
+	w := getConditional(h, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/"[A-Za-z0-9_-]+"$`, etag)
+	assert.Equal(t, "Mon, 19 Oct 2026 12:00:00 GMT", w.Header().Get("Last-Modified"))
+
+	// weak tags are the same in every encoding
+	w = getConditional(h, http.Header{"Accept": {MediaTypeYAML}})
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	tests := []struct {
+		name   string
+		header http.Header
+		code   int
+	}{
+		{"matching tag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"strong form of the tag", http.Header{"If-None-Match": {etag[2:]}}, http.StatusNotModified},
+		{"one of the tags", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified},
+		{"other tag", http.Header{"If-None-Match": {`W/"other"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {"Mon, 19 Oct 2026 12:00:00 GMT"}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {"Mon, 19 Oct 2026 11:59:59 GMT"}}, http.StatusOK},
+		{"invalid date", http.Header{"If-Modified-Since": {"yesterday"}}, http.StatusOK},
+		{"tag takes precedence", http.Header{"If-None-Match": {`W/"other"`}, "If-Modified-Since": {"Mon, 19 Oct 2026 12:00:00 GMT"}}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getConditional(h, test.header)
+			assert.Equal(t, test.code, w.Code)
+		})
+	}
+
+	// only GET requests are conditional
+	w = serve(h, "/items/abc", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
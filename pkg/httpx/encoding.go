@@ -0,0 +1,352 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Media types of the supported encodings
+const (
+	MediaTypeJSON        = "application/json"
+	MediaTypeYAML        = "application/yaml"
+	MediaTypeMessagePack = "application/msgpack"
+	MediaTypeCSV         = "text/csv"
+)
+
+var (
+	ErrNotAcceptable        = errors.New("not acceptable, use application/json, application/yaml, application/msgpack or text/csv for lists")
+	ErrUnsupportedMediaType = errors.New("unsupported media type, use application/json, application/yaml or application/msgpack")
+	ErrMissingContentType   = errors.New("missing Content-Type, use application/json, application/yaml or application/msgpack")
+	ErrBodyTooLarge         = errors.New("request body too large")
+	// ErrInvalidBody is wrapped by the errors of Decode for bodies which cannot be decoded
+	ErrInvalidBody = errors.New("invalid body")
+
+	errTrailingData = errors.New("unexpected data after the end of the body")
+)
+
+// CSVMarshaler is implemented by list responses which can be written as CSV
+type CSVMarshaler interface {
+	// MarshalCSV returns the header and the records of the list
+	MarshalCSV() ([]string, [][]string)
+}
+
+// encoding is a representation of response and request bodies, bodies are converted through
+// JSON so the field names are the same in every encoding
+type encoding struct {
+	mediaType   string
+	aliases     []string
+	contentType string
+	encode      func(w io.Writer, r *http.Request, body interface{}) error
+	// decode is nil for encodings which are only used for responses, it rejects unknown fields and trailing data
+	decode func(data []byte, dst interface{}) error
+}
+
+// encodings in order of preference
+var encodings = []encoding{
+	{
+		mediaType:   MediaTypeJSON,
+		contentType: "application/json; charset=utf-8",
+		encode:      encodeJSON,
+		decode:      decodeJSON,
+	},
+	{
+		mediaType:   MediaTypeYAML,
+		aliases:     []string{"application/x-yaml", "text/yaml"},
+		contentType: "application/yaml; charset=utf-8",
+		encode:      encodeYAML,
+		decode:      decodeYAML,
+	},
+	{
+		mediaType:   MediaTypeMessagePack,
+		aliases:     []string{"application/x-msgpack", "application/vnd.msgpack"},
+		contentType: MediaTypeMessagePack,
+		encode:      encodeMessagePack,
+		decode:      decodeMessagePack,
+	},
+	{
+		mediaType:   MediaTypeCSV,
+		contentType: "text/csv; charset=utf-8",
+		encode:      encodeCSV,
+	},
+}
+
+func (e *encoding) canEncode(body interface{}) bool {
+	if e.mediaType == MediaTypeCSV {
+		_, ok := body.(CSVMarshaler)
+		return ok
+	}
+	return true
+}
+
+func (e *encoding) matches(mediaType string) bool {
+	if mediaType == e.mediaType {
+		return true
+	}
+	for _, alias := range e.aliases {
+		if mediaType == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the encoding of body preferred by the Accept header of r, or nil when none is acceptable
+func negotiate(r *http.Request, body interface{}) *encoding {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return &encodings[0]
+	}
+	ranges := parseAccept(accept)
+
+	var best *encoding
+	var bestQuality float64
+	for i := range encodings {
+		e := &encodings[i]
+		if !e.canEncode(body) {
+			continue
+		}
+		if quality := e.quality(ranges); quality > bestQuality {
+			best, bestQuality = e, quality
+		}
+	}
+	return best
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// quality is the quality of the most specific media range matching the encoding, wildcards only
+// match the main type of the media type and not of its aliases
+func (e *encoding) quality(ranges []mediaRange) float64 {
+	mainType := strings.SplitN(e.mediaType, "/", 2)[0]
+	quality, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case e.matches(mr.mediaType):
+			s = 2
+		case mr.mediaType == mainType+"/*":
+			s = 1
+		case mr.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			quality, specificity = mr.quality, s
+		}
+	}
+	return quality
+}
+
+// Decode decodes the body of r into dst according to its Content-Type. Fields which are not in dst and data
+// after the end of the body are rejected. ErrMissingContentType and ErrUnsupportedMediaType are returned for
+// a missing or unsupported Content-Type, ErrBodyTooLarge when the body exceeds MaxBodySize and errors wrapping
+// ErrInvalidBody when the body cannot be decoded.
+func Decode(r *http.Request, dst interface{}) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ErrMissingContentType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ErrUnsupportedMediaType
+	}
+	var e *encoding
+	for i := range encodings {
+		if encodings[i].decode != nil && encodings[i].matches(mediaType) {
+			e = &encodings[i]
+		}
+	}
+	if e == nil {
+		return ErrUnsupportedMediaType
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if errors.Is(err, ErrBodyTooLarge) {
+		return ErrBodyTooLarge
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty body", ErrInvalidBody)
+	}
+	if err := e.decode(data, dst); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBody, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+func encodeJSON(w io.Writer, r *http.Request, body interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	if _, ok := r.URL.Query()["pretty"]; ok {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(body)
+}
+
+func decodeJSON(data []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+func encodeYAML(w io.Writer, _ *http.Request, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	// a node keeps the order of the fields, JSON is valid YAML
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle removes the flow style and quotes of JSON from node
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func decodeYAML(data []byte, dst interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	// a second document
+	var next interface{}
+	if err := dec.Decode(&next); err != io.EOF {
+		return errTrailingData
+	}
+	return fromGeneric(v, dst)
+}
+
+func encodeMessagePack(w io.Writer, _ *http.Request, body interface{}) error {
+	v, err := toGeneric(body)
+	if err != nil {
+		return err
+	}
+	enc := msgpack.NewEncoder(w)
+	enc.SetSortMapKeys(true)
+	return enc.Encode(v)
+}
+
+func decodeMessagePack(data []byte, dst interface{}) error {
+	r := bytes.NewReader(data)
+	var v interface{}
+	if err := msgpack.NewDecoder(r).Decode(&v); err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errTrailingData
+	}
+	return fromGeneric(v, dst)
+}
+
+func encodeCSV(w io.Writer, _ *http.Request, body interface{}) error {
+	header, records := body.(CSVMarshaler).MarshalCSV()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// toGeneric converts body to maps, slices and scalars through JSON, whole numbers stay integers
+func toGeneric(body interface{}) (interface{}, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = convertNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = convertNumbers(value)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// fromGeneric converts maps, slices and scalars to dst through JSON, fields which are not in dst are rejected
+func fromGeneric(v interface{}, dst interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
@@ -0,0 +1,147 @@
+package httpx
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type item struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type list struct {
+	Items []item `json:"items"`
+}
+
+func (l list) MarshalCSV() ([]string, [][]string) {
+	return []string{"name"}, [][]string{{l.Items[0].Name}}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept    string
+		body      interface{}
+		mediaType string
+	}{
+		{accept: "", body: item{}, mediaType: MediaTypeJSON},
+		{accept: "*/*", body: item{}, mediaType: MediaTypeJSON},
+		{accept: "application/yaml", body: item{}, mediaType: MediaTypeYAML},
+		{accept: "text/yaml", body: item{}, mediaType: MediaTypeYAML},
+		{accept: "application/x-msgpack", body: item{}, mediaType: MediaTypeMessagePack},
+		{accept: "application/json;q=0.5, application/yaml", body: item{}, mediaType: MediaTypeYAML},
+		{accept: "application/*;q=0.5, application/msgpack;q=0.8", body: item{}, mediaType: MediaTypeMessagePack},
+		{accept: "text/*", body: list{}, mediaType: MediaTypeCSV},
+		{accept: "text/csv", body: item{}, mediaType: ""},
+		{accept: "application/json;q=0, */*", body: item{}, mediaType: MediaTypeYAML},
+		{accept: "image/png", body: item{}, mediaType: ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", test.accept)
+		e := negotiate(r, test.body)
+		if test.mediaType == "" {
+			assert.Nil(t, e, test.accept)
+			continue
+		}
+		if assert.NotNil(t, e, test.accept) {
+			assert.Equal(t, test.mediaType, e.mediaType, test.accept)
+		}
+	}
+}
+
+func get(accept string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestWrite(t *testing.T) {
+	body := list{Items: []item{{Name: "a,b", Count: 2}}}
+	handler := func(w http.ResponseWriter, r *http.Request) { JSON(w, r, body) }
+
+	w := get("", handler)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	assert.JSONEq(t, `{"items": [{"name": "a,b", "count": 2}]}`, w.Body.String())
+
+	w = get("application/yaml", handler)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "items:\n  - name: a,b\n    count: 2\n", w.Body.String())
+
+	w = get("application/msgpack", handler)
+	assert.Equal(t, MediaTypeMessagePack, w.Header().Get("Content-Type"))
+	var decoded map[string][]map[string]interface{}
+	assert.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &decoded))
+	assert.Equal(t, int64(2), decoded["items"][0]["count"])
+
+	w = get("text/csv", handler)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "name\n\"a,b\"\n", w.Body.String())
+
+	w = get("text/csv", func(w http.ResponseWriter, r *http.Request) { JSON(w, r, item{}) })
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	// an error is not hidden behind a 406
+	w = get("image/png", func(w http.ResponseWriter, r *http.Request) {
+		AbortJSON(w, r, http.StatusNotFound, errors.New("not found"))
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "not found"}`, w.Body.String())
+}
+
+func TestDecode(t *testing.T) {
+	packed, err := msgpack.Marshal(map[string]interface{}{"name": "packed", "count": 3})
+	assert.NoError(t, err)
+	unknown, err := msgpack.Marshal(map[string]interface{}{"name": "packed", "other": 3})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		contentType string
+		body        []byte
+		expected    item
+		err         error
+	}{
+		{contentType: "application/json", body: []byte(`{"name": "json", "count": 1}`), expected: item{Name: "json", Count: 1}},
+		{contentType: "application/json; charset=utf-8", body: []byte(`{"name": "json"}` + "\n"), expected: item{Name: "json"}},
+		{contentType: "application/yaml", body: []byte("name: yaml\ncount: 2\n"), expected: item{Name: "yaml", Count: 2}},
+		{contentType: "application/msgpack", body: packed, expected: item{Name: "packed", Count: 3}},
+		{contentType: "", body: []byte(`{"name": "json"}`), err: ErrMissingContentType},
+		{contentType: "text/csv", body: []byte("name\n"), err: ErrUnsupportedMediaType},
+		{contentType: "text/plain", body: []byte("text"), err: ErrUnsupportedMediaType},
+		{contentType: "application/json", body: []byte(""), err: ErrInvalidBody},
+		{contentType: "application/json", body: []byte(`{"name": "json", "other": 1}`), err: ErrInvalidBody},
+		{contentType: "application/json", body: []byte(`{"name": "json"} {"name": "json"}`), err: ErrInvalidBody},
+		{contentType: "application/json", body: []byte(`{"name": "json"}}`), err: ErrInvalidBody},
+		{contentType: "application/yaml", body: []byte("name: yaml\nother: 1\n"), err: ErrInvalidBody},
+		{contentType: "application/yaml", body: []byte("name: yaml\n---\nname: yaml\n"), err: ErrInvalidBody},
+		{contentType: "application/yaml", body: []byte("name: [unclosed"), err: ErrInvalidBody},
+		{contentType: "application/msgpack", body: unknown, err: ErrInvalidBody},
+		{contentType: "application/msgpack", body: append(packed, 0x01), err: ErrInvalidBody},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		var decoded item
+		err := Decode(r, &decoded)
+		if test.err == nil {
+			assert.NoError(t, err, string(test.body))
+			assert.Equal(t, test.expected, decoded, string(test.body))
+		} else {
+			assert.True(t, errors.Is(err, test.err), "%s: %v", test.body, err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "json", "other": 1}`))
+	r.Header.Set("Content-Type", "application/json")
+	assert.EqualError(t, Decode(r, &item{}), `invalid body: unknown field "other"`)
+}
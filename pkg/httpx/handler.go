@@ -0,0 +1,349 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Config is shared by the typed handlers of an API
+type Config struct {
+	// PathParam returns the value of the path parameter name of r
+	PathParam func(r *http.Request, name string) string
+	// Validate validates a bound request, a ValidationError is answered with 400 Bad Request and
+	// any other error with 500 Internal Server Error
+	Validate func(v interface{}) error
+	// Status maps the errors returned by handlers to a status code, errors it maps to 0 are
+	// 500 Internal Server Error
+	Status func(err error) int
+}
+
+// StatusError is answered with its status code
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+// Error returns an error which is answered with code
+func Error(code int, err error) error {
+	return &StatusError{Code: code, Err: err}
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCoder is implemented by responses which choose their own status code
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Headerer is implemented by responses which set headers
+type Headerer interface {
+	Headers() http.Header
+}
+
+// Empty is a response without a body
+type Empty struct{}
+
+// Parameter is a path or query parameter of a request
+type Parameter struct {
+	Name string
+	// In is either path or query
+	In string
+	// Type is the JSON schema type of the parameter
+	Type     string
+	Required bool
+}
+
+// Operation describes a typed handler for an OpenAPI specification
+type Operation struct {
+	Parameters []Parameter
+	// Body is the type of the request body, nil for requests without a body
+	Body reflect.Type
+	// Response is the type of the response body, nil for Empty
+	Response reflect.Type
+	// Statuses are the status codes of successful responses
+	Statuses []int
+}
+
+type handlerOptions struct {
+	statuses []int
+}
+
+type HandlerOption func(*handlerOptions)
+
+// WithStatus sets the status codes of successful responses, the first is used unless the response
+// is a StatusCoder, the others document the codes a StatusCoder chooses from
+func WithStatus(codes ...int) HandlerOption {
+	return func(o *handlerOptions) {
+		o.statuses = codes
+	}
+}
+
+// Handler binds requests into Req, validates them, calls a function and writes its response or
+// error, see Handle
+type Handler[Req any, Resp any] struct {
+	config   *Config
+	fn       func(ctx context.Context, req Req) (Resp, error)
+	statuses []int
+	fields   []field
+	body     []int
+}
+
+// field is a path or query parameter bound into the field at index of a request
+type field struct {
+	Parameter
+	index []int
+	kind  reflect.Kind
+	// lenient parameters keep their zero value when they cannot be parsed
+	lenient bool
+}
+
+// Handle returns a Handler calling fn. Req is a struct, its fields tagged `path:"name"` and
+// `query:"name"` are bound from the path and the query, a field named Body is decoded from the
+// request body with Decode. Fields of embedded structs are bound as well. A parameter which cannot
+// be parsed is answered with 400 Bad Request, unless it is tagged lenient like `query:"page,lenient"`
+// which keeps its zero value instead. The response of fn is written with 200 OK, or the status set
+// with WithStatus, in the negotiated encoding.
+//
+// Errors are answered with the status code of a StatusError, 400 Bad Request for a
+// ValidationError, the status mapped by Config.Status or else 500 Internal Server Error.
+// Handle panics when Req cannot be bound.
+func Handle[Req any, Resp any](c *Config, fn func(ctx context.Context, req Req) (Resp, error), opts ...HandlerOption) *Handler[Req, Resp] {
+	options := handlerOptions{statuses: []int{http.StatusOK}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	h := &Handler[Req, Resp]{
+		config:   c,
+		fn:       fn,
+		statuses: options.statuses,
+	}
+
+	t := reflect.TypeOf((*Req)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("httpx: request %s is not a struct", t))
+	}
+	h.inspect(t, nil)
+	return h
+}
+
+// inspect collects the parameters and the body of the request struct t
+func (h *Handler[Req, Resp]) inspect(t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			h.inspect(f.Type, fieldIndex)
+			continue
+		}
+		if f.Name == "Body" {
+			h.body = fieldIndex
+			continue
+		}
+
+		var in, tag string
+		if tag = f.Tag.Get("path"); tag != "" {
+			in = "path"
+		} else if tag = f.Tag.Get("query"); tag != "" {
+			in = "query"
+		} else {
+			continue
+		}
+		name, option, _ := strings.Cut(tag, ",")
+
+		typ, ok := parameterTypes[f.Type.Kind()]
+		if !ok {
+			panic(fmt.Sprintf("httpx: %s parameter %q of type %s is not supported", in, name, f.Type))
+		}
+		h.fields = append(h.fields, field{
+			Parameter: Parameter{
+				Name:     name,
+				In:       in,
+				Type:     typ,
+				Required: in == "path" || isRequired(f.Tag.Get("validate")),
+			},
+			index:   fieldIndex,
+			kind:    f.Type.Kind(),
+			lenient: option == "lenient",
+		})
+	}
+}
+
+var parameterTypes = map[reflect.Kind]string{
+	reflect.String:  "string",
+	reflect.Bool:    "boolean",
+	reflect.Int:     "integer",
+	reflect.Int32:   "integer",
+	reflect.Int64:   "integer",
+	reflect.Uint:    "integer",
+	reflect.Uint32:  "integer",
+	reflect.Uint64:  "integer",
+	reflect.Float32: "number",
+	reflect.Float64: "number",
+}
+
+// Operation describes the parameters, body and responses of the handler
+func (h *Handler[Req, Resp]) Operation() Operation {
+	op := Operation{Statuses: h.statuses}
+	for _, f := range h.fields {
+		op.Parameters = append(op.Parameters, f.Parameter)
+	}
+	if h.body != nil {
+		op.Body = reflect.TypeOf((*Req)(nil)).Elem().FieldByIndex(h.body).Type
+	}
+	if response := reflect.TypeOf((*Resp)(nil)).Elem(); response != reflect.TypeOf(Empty{}) {
+		op.Response = response
+	}
+	return op
+}
+
+func (h *Handler[Req, Resp]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Req
+	if err := h.bind(r, &req); err != nil {
+		h.abort(w, r, err)
+		return
+	}
+	if h.config.Validate != nil {
+		if err := h.config.Validate(&req); err != nil {
+			h.abort(w, r, err)
+			return
+		}
+	}
+
+	resp, err := h.fn(r.Context(), req)
+	if err != nil {
+		h.abort(w, r, err)
+		return
+	}
+
+	status := h.statuses[0]
+	if coder, ok := interface{}(resp).(StatusCoder); ok {
+		status = coder.StatusCode()
+	}
+	if headerer, ok := interface{}(resp).(Headerer); ok {
+		for key, values := range headerer.Headers() {
+			w.Header()[key] = values
+		}
+	}
+	if _, ok := interface{}(resp).(Empty); ok {
+		w.WriteHeader(status)
+		return
+	}
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && status == http.StatusOK {
+		writeConditional(w, r, resp)
+		return
+	}
+	write(w, r, status, resp)
+}
+
+// bind binds the parameters and the body of r into req
+func (h *Handler[Req, Resp]) bind(r *http.Request, req *Req) error {
+	v := reflect.ValueOf(req).Elem()
+
+	query := r.URL.Query()
+	for _, f := range h.fields {
+		var value string
+		if f.In == "path" {
+			value = h.config.PathParam(r, f.Name)
+		} else {
+			value = query.Get(f.Name)
+		}
+		if value == "" {
+			continue
+		}
+		if err := setParameter(v.FieldByIndex(f.index), f.kind, value); err != nil {
+			if f.lenient {
+				continue
+			}
+			return &ValidationError{Message: fmt.Sprintf("invalid %s parameter %q, expected %s", f.In, f.Name, f.Type)}
+		}
+	}
+
+	if h.body != nil {
+		if err := Decode(r, v.FieldByIndex(h.body).Addr().Interface()); err != nil {
+			return Error(decodeStatus(err), err)
+		}
+	}
+	return nil
+}
+
+func setParameter(v reflect.Value, kind reflect.Kind, value string) error {
+	switch kind {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+// decodeStatus is the status code of an error returned by Decode
+func decodeStatus(err error) int {
+	switch err {
+	case ErrMissingContentType, ErrUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case ErrBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func (h *Handler[Req, Resp]) abort(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+
+	var statusErr *StatusError
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &statusErr):
+		code = statusErr.Code
+	case errors.As(err, &validationErr):
+		code = http.StatusBadRequest
+	case h.config.Status != nil && h.config.Status(err) != 0:
+		code = h.config.Status(err)
+	}
+	AbortJSON(w, r, code, err)
+}
+
+// isRequired reports whether validate contains the required rule, conditional rules like
+// required_with are not required
+func isRequired(validate string) bool {
+	for _, rule := range strings.Split(validate, ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
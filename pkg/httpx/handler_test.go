@@ -0,0 +1,181 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errGone = errors.New("gone")
+
+type paging struct {
+	Page int `query:"page"`
+}
+
+type itemRequest struct {
+	ID string `path:"id"`
+	paging
+	Verbose bool    `query:"verbose"`
+	Ratio   float64 `query:"ratio"`
+	Body    item
+}
+
+type createdItem struct {
+	item
+	created bool
+}
+
+func (c createdItem) StatusCode() int {
+	if c.created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+func (c createdItem) Headers() http.Header {
+	return http.Header{"Location": []string{"/items/" + c.Name}}
+}
+
+var testConfig = &Config{
+	PathParam: func(r *http.Request, name string) string {
+		return strings.TrimPrefix(r.URL.Path, "/items/")
+	},
+	Validate: func(v interface{}) error {
+		if req, ok := v.(*itemRequest); ok && req.Body.Name == "" {
+			return &ValidationError{Message: "name is required"}
+		}
+		return nil
+	},
+	Status: func(err error) int {
+		if err == errGone {
+			return http.StatusGone
+		}
+		return 0
+	},
+}
+
+func serve(h http.Handler, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", MediaTypeJSON)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandle(t *testing.T) {
+	var bound itemRequest
+	h := Handle(testConfig, func(ctx context.Context, req itemRequest) (createdItem, error) {
+		bound = req
+		switch req.ID {
+		case "gone":
+			return createdItem{}, errGone
+		case "teapot":
+			return createdItem{}, Error(http.StatusTeapot, errors.New("teapot"))
+		case "broken":
+			return createdItem{}, errors.New("broken")
+		}
+		return createdItem{item: req.Body, created: req.Verbose}, nil
+	}, WithStatus(http.StatusOK, http.StatusCreated))
+
+	w := serve(h, "/items/abc?page=2&verbose=true&ratio=0.5", `{"name": "abc", "count": 1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/items/abc", w.Header().Get("Location"))
+	assert.JSONEq(t, `{"name": "abc", "count": 1}`, w.Body.String())
+	assert.Equal(t, itemRequest{ID: "abc", paging: paging{Page: 2}, Verbose: true, Ratio: 0.5, Body: item{Name: "abc", Count: 1}}, bound)
+
+	w = serve(h, "/items/abc", `{"name": "abc"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tests := []struct {
+		target string
+		body   string
+		code   int
+		error  string
+	}{
+		{target: "/items/abc?page=two", body: `{"name": "abc"}`, code: http.StatusBadRequest, error: `invalid query parameter "page", expected integer`},
+		{target: "/items/abc", body: "", code: http.StatusUnsupportedMediaType, error: ErrMissingContentType.Error()},
+		{target: "/items/abc", body: `{"name": "abc", "other": 1}`, code: http.StatusBadRequest, error: `invalid body: unknown field "other"`},
+		{target: "/items/abc", body: `{"count": 1}`, code: http.StatusBadRequest, error: "name is required"},
+		{target: "/items/gone", body: `{"name": "abc"}`, code: http.StatusGone, error: "gone"},
+		{target: "/items/teapot", body: `{"name": "abc"}`, code: http.StatusTeapot, error: "teapot"},
+		{target: "/items/broken", body: `{"name": "abc"}`, code: http.StatusInternalServerError, error: "broken"},
+	}
+	for _, test := range tests {
+		w := serve(h, test.target, test.body)
+		assert.Equal(t, test.code, w.Code, test.target)
+		var response ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, test.error, response.Error, test.target)
+	}
+}
+
+func TestHandleEmpty(t *testing.T) {
+	h := Handle(testConfig, func(ctx context.Context, req struct {
+		ID string `path:"id"`
+	}) (Empty, error) {
+		return Empty{}, nil
+	}, WithStatus(http.StatusNoContent))
+
+	w := serve(h, "/items/abc", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, Operation{
+		Parameters: []Parameter{{Name: "id", In: "path", Type: "string", Required: true}},
+		Statuses:   []int{http.StatusNoContent},
+	}, h.Operation())
+}
+
+func TestHandleLenient(t *testing.T) {
+	type request struct {
+		Page  int `query:"page,lenient"`
+		Limit int `query:"limit"`
+	}
+	var bound request
+	h := Handle(testConfig, func(ctx context.Context, req request) (Empty, error) {
+		bound = req
+		return Empty{}, nil
+	})
+
+	w := serve(h, "/items?page=two&limit=5", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request{Limit: 5}, bound)
+
+	w = serve(h, "/items?page=2&limit=five", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []Parameter{{Name: "page", In: "query", Type: "integer"}, {Name: "limit", In: "query", Type: "integer"}}, h.Operation().Parameters)
+}
+
+func TestHandlerOperation(t *testing.T) {
+	h := Handle(testConfig, func(ctx context.Context, req itemRequest) (createdItem, error) {
+		return createdItem{}, nil
+	}, WithStatus(http.StatusOK, http.StatusCreated))
+
+	assert.Equal(t, Operation{
+		Parameters: []Parameter{
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "page", In: "query", Type: "integer"},
+			{Name: "verbose", In: "query", Type: "boolean"},
+			{Name: "ratio", In: "query", Type: "number"},
+		},
+		Body:     reflect.TypeOf(item{}),
+		Response: reflect.TypeOf(createdItem{}),
+		Statuses: []int{http.StatusOK, http.StatusCreated},
+	}, h.Operation())
+
+	assert.Panics(t, func() {
+		Handle(testConfig, func(ctx context.Context, req struct {
+			IDs []string `query:"id"`
+		}) (Empty, error) {
+			return Empty{}, nil
+		})
+	})
+}
@@ -1,37 +1,88 @@
 package httpx
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"net/http"
 )
 
 // swagger:model ErrorResponse
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
 }
 
-func writeJSON(w http.ResponseWriter, r *http.Request, code int, body interface{}) {
-	w.Header().Add("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(code)
+// FieldError describes why the value at Field, a JSON pointer into the request body, is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
 
-	enc := json.NewEncoder(w)
-	enc.SetEscapeHTML(false)
+// ValidationError is an error caused by invalid input, AbortJSON includes its fields in the response
+type ValidationError struct {
+	Message string
+	Fields  []FieldError
+}
 
-	if _, ok := r.URL.Query()["pretty"]; ok {
-		enc.SetIndent("", "  ")
-	}
+func (e *ValidationError) Error() string {
+	return e.Message
+}
 
-	if err := enc.Encode(body); err != nil {
+// write writes body with status code in the encoding negotiated from the Accept header of r,
+// a body which cannot be written in an acceptable encoding is replaced by 406 Not Acceptable
+func write(w http.ResponseWriter, r *http.Request, code int, body interface{}) {
+	code, contentType, data, err := encode(w, r, code, body)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	send(w, code, contentType, data)
+}
+
+// encode encodes body in the encoding negotiated from the Accept header of r like write, it
+// returns the status code, which is 406 Not Acceptable when no encoding is acceptable
+func encode(w http.ResponseWriter, r *http.Request, code int, body interface{}) (int, string, []byte, error) {
+	w.Header().Add("Vary", "Accept")
+
+	e := negotiate(r, body)
+	if e == nil {
+		// errors are written as JSON instead of hiding them behind a 406
+		if _, isError := body.(ErrorResponse); !isError {
+			code = http.StatusNotAcceptable
+			body = ErrorResponse{Error: ErrNotAcceptable.Error()}
+		}
+		e = &encodings[0]
 	}
+
+	var buf bytes.Buffer
+	if err := e.encode(&buf, r, body); err != nil {
+		return 0, "", nil, err
+	}
+	return code, e.contentType, buf.Bytes(), nil
+}
+
+func send(w http.ResponseWriter, code int, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(data)
 }
 
+// JSON writes body with 200 OK, despite its name in any of the supported encodings
 func JSON(w http.ResponseWriter, r *http.Request, body interface{}) {
-	writeJSON(w, r, http.StatusOK, body)
+	write(w, r, http.StatusOK, body)
+}
+
+func JSONStatus(w http.ResponseWriter, r *http.Request, code int, body interface{}) {
+	write(w, r, code, body)
 }
 
 func AbortJSON(w http.ResponseWriter, r *http.Request, code int, err error) {
-	writeJSON(w, r, code, ErrorResponse{
+	response := ErrorResponse{
 		Error: err.Error(),
-	})
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		response.Fields = validationErr.Fields
+	}
+	write(w, r, code, response)
 }
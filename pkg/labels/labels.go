@@ -0,0 +1,296 @@
+// Package labels implements Kubernetes-style labels and label selectors
+//
+// A selector is a comma separated list of requirements which all have to match:
+//
+//	env=prod,team in (a,b),!deprecated
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+const maxLength = 63
+
+var (
+	ErrInvalidSelector = errors.New("invalid label selector")
+
+	labelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+)
+
+// Requirement is a single condition on the labels of a thing
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Matches reports whether labels satisfy the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && value == r.Values[0]
+	case NotEquals:
+		return !ok || value != r.Values[0]
+	case In:
+		return ok && contains(r.Values, value)
+	case NotIn:
+		return !ok || !contains(r.Values, value)
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	}
+	return r.Key + string(r.Operator) + r.Values[0]
+}
+
+// Selector is a list of requirements which all have to match, an empty selector matches everything
+type Selector []Requirement
+
+// Matches reports whether labels satisfy all requirements of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Validate checks that all keys and values are valid labels
+func Validate(labels map[string]string) error {
+	for key, value := range labels {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+		if err := ValidateValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateKey checks that key is at most 63 characters, starts and ends with an alphanumeric character
+// and only contains alphanumerics, '-', '_', '.' and '/'
+func ValidateKey(key string) error {
+	if len(key) > maxLength || !labelRegexp.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// ValidateValue checks that value is empty or follows the same rules as a key
+func ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxLength || !labelRegexp.MatchString(value) {
+		return fmt.Errorf("invalid label value %q", value)
+	}
+	return nil
+}
+
+// Parse parses a selector such as "env=prod,team in (a,b),!deprecated"
+func Parse(selector string) (Selector, error) {
+	p := &parser{tokens: tokenize(selector)}
+	var s Selector
+	for !p.done() {
+		r, err := p.requirement()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+		}
+		s = append(s, r)
+
+		if p.done() {
+			break
+		}
+		if t := p.next(); t != "," {
+			return nil, fmt.Errorf("%w: expected ',' but found %q", ErrInvalidSelector, t)
+		}
+		if p.done() {
+			return nil, fmt.Errorf("%w: trailing ','", ErrInvalidSelector)
+		}
+	}
+	return s, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) requirement() (Requirement, error) {
+	if p.peek() == "!" {
+		p.next()
+		key := p.next()
+		if err := ValidateKey(key); err != nil {
+			return Requirement{}, err
+		}
+		return Requirement{Key: key, Operator: DoesNotExist}, nil
+	}
+
+	key := p.next()
+	if err := ValidateKey(key); err != nil {
+		return Requirement{}, err
+	}
+
+	switch op := p.peek(); op {
+	case "", ",":
+		return Requirement{Key: key, Operator: Exists}, nil
+	case "=", "==", "!=":
+		p.next()
+		value := p.peek()
+		if value == "," {
+			value = ""
+		} else {
+			p.next()
+		}
+		if err := ValidateValue(value); err != nil {
+			return Requirement{}, err
+		}
+		operator := Equals
+		if op == "!=" {
+			operator = NotEquals
+		}
+		return Requirement{Key: key, Operator: operator, Values: []string{value}}, nil
+	case string(In), string(NotIn):
+		p.next()
+		values, err := p.set()
+		if err != nil {
+			return Requirement{}, err
+		}
+		return Requirement{Key: key, Operator: Operator(op), Values: values}, nil
+	default:
+		return Requirement{}, fmt.Errorf("unexpected %q after key %q", op, key)
+	}
+}
+
+func (p *parser) set() ([]string, error) {
+	if t := p.next(); t != "(" {
+		return nil, fmt.Errorf("expected '(' but found %q", t)
+	}
+	var values []string
+	for {
+		value := p.next()
+		if value == "" {
+			return nil, errors.New("missing ')'")
+		}
+		if value == ")" && len(values) == 0 {
+			return nil, errors.New("empty set of values")
+		}
+		if err := ValidateValue(value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		switch t := p.next(); t {
+		case ")":
+			sort.Strings(values)
+			return values, nil
+		case ",":
+		default:
+			return nil, fmt.Errorf("expected ',' or ')' but found %q", t)
+		}
+	}
+}
+
+// tokenize splits a selector into operators, parentheses, commas and words
+func tokenize(selector string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == ' ' || c == '\t':
+			flush()
+		case c == '(' || c == ')' || c == ',':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == '!' || c == '=':
+			flush()
+			if i+1 < len(selector) && selector[i+1] == '=' {
+				tokens = append(tokens, selector[i:i+2])
+				i++
+			} else {
+				tokens = append(tokens, string(c))
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package labels_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/pkg/labels"
+)
+
+func TestParse(t *testing.T) {
+	selector, err := labels.Parse("env=prod, team in (b,a),!deprecated,owner,tier!=frontend,region notin (eu)")
+	assert.NoError(t, err)
+	assert.Equal(t, labels.Selector{
+		{Key: "env", Operator: labels.Equals, Values: []string{"prod"}},
+		{Key: "team", Operator: labels.In, Values: []string{"a", "b"}},
+		{Key: "deprecated", Operator: labels.DoesNotExist},
+		{Key: "owner", Operator: labels.Exists},
+		{Key: "tier", Operator: labels.NotEquals, Values: []string{"frontend"}},
+		{Key: "region", Operator: labels.NotIn, Values: []string{"eu"}},
+	}, selector)
+	assert.Equal(t, "env=prod,team in (a,b),!deprecated,owner,tier!=frontend,region notin (eu)", selector.String())
+}
+
+func TestParseEmpty(t *testing.T) {
+	selector, err := labels.Parse("")
+	assert.NoError(t, err)
+	assert.True(t, selector.Empty())
+	assert.True(t, selector.Matches(map[string]string{"env": "prod"}))
+}
+
+func TestParseDoubleEquals(t *testing.T) {
+	selector, err := labels.Parse("env==prod")
+	assert.NoError(t, err)
+	assert.Equal(t, labels.Selector{{Key: "env", Operator: labels.Equals, Values: []string{"prod"}}}, selector)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, selector := range []string{
+		"env=prod,",
+		"env in ()",
+		"env in (a,b",
+		"env in a",
+		"env prod",
+		"=prod",
+		"-env=prod",
+		"env=prod=test",
+		"!",
+	} {
+		_, err := labels.Parse(selector)
+		assert.True(t, errors.Is(err, labels.ErrInvalidSelector), selector)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	thingLabels := map[string]string{"env": "prod", "team": "a"}
+
+	for selector, expected := range map[string]bool{
+		"env=prod":             true,
+		"env=test":             false,
+		"env!=test":            true,
+		"owner!=me":            true,
+		"team in (a,b)":        true,
+		"team in (b,c)":        false,
+		"team notin (b,c)":     true,
+		"owner notin (me)":     true,
+		"env":                  true,
+		"owner":                false,
+		"!deprecated":          true,
+		"!env":                 false,
+		"env=prod,team in (a)": true,
+		"env=prod,team in (b)": false,
+	} {
+		s, err := labels.Parse(selector)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, s.Matches(thingLabels), selector)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, labels.Validate(map[string]string{"env": "prod", "app.ldej.nl/team": "", "a": "b_c-d"}))
+	assert.Error(t, labels.Validate(map[string]string{"env=": "prod"}))
+	assert.Error(t, labels.Validate(map[string]string{"env": "prod "}))
+	assert.Error(t, labels.Validate(map[string]string{"": "prod"}))
+}
@@ -26,13 +26,27 @@ const (
 
 	// CloudTraceContextKey is the context.Context key used for the X-Cloud-Trace-Context request header.
 	CloudTraceContextKey ContextKey = TraceHeader
+
+	// keyValuesContextKey is the context.Context key of the key values added with With
+	keyValuesContextKey ContextKey = "keyValues"
 )
 
 type Logger struct {
 	projectID string
 	logger    *log.Logger
+	spans     SpanFunc
+}
+
+// Span identifies the span a log statement is written in
+type Span struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
 }
 
+// SpanFunc returns the span of ctx, ok is false when ctx has no span
+type SpanFunc func(ctx context.Context) (span Span, ok bool)
+
 type KeyValue struct {
 	Key   string
 	Value interface{}
@@ -42,12 +56,20 @@ func KV(key string, value interface{}) KeyValue {
 	return KeyValue{key, value}
 }
 
+// With returns a copy of ctx with key values which are added to every log statement using it
+func With(ctx context.Context, keysValues ...KeyValue) context.Context {
+	existing, _ := ctx.Value(keyValuesContextKey).([]KeyValue)
+	kvs := make([]KeyValue, 0, len(existing)+len(keysValues))
+	kvs = append(append(kvs, existing...), keysValues...)
+	return context.WithValue(ctx, keyValuesContextKey, kvs)
+}
+
 // NewJSONLogger generates a structured logger
 // redirectStdLog redirects output from the standard library's package-global logger to the this logger at Info level.
 func NewJSONLogger(out io.Writer, projectID string, redirectStdLog bool) *Logger {
 	logger := log.New(out, "", 0)
 
-	l := &Logger{projectID, logger}
+	l := &Logger{projectID: projectID, logger: logger}
 	if redirectStdLog {
 		log.SetFlags(0)
 		log.SetPrefix("")
@@ -57,6 +79,12 @@ func NewJSONLogger(out io.Writer, projectID string, redirectStdLog bool) *Logger
 	return l
 }
 
+// WithSpans adds the trace and span returned by spans to every log statement which has a span, the
+// X-Cloud-Trace-Context added by Tracer is only used for log statements without a span
+func (l *Logger) WithSpans(spans SpanFunc) {
+	l.spans = spans
+}
+
 // Info logs message with severity INFO
 func (l *Logger) Info(ctx context.Context, msg string, keysValues ...KeyValue) {
 	l.writeLog(ctx, "INFO", msg, keysValues)
@@ -101,10 +129,15 @@ func (l *Logger) writeLog(ctx context.Context, level string, msg string, keysVal
 		{"severity", level},
 		{"message", msg},
 	}
+	if contextKeysValues, ok := ctx.Value(keyValuesContextKey).([]KeyValue); ok {
+		m = append(m, contextKeysValues...)
+	}
 	m = append(m, keysValues...)
 
-	// Add trace if available in context
-	if l.projectID != "" {
+	// Add the span if available in context, or the trace
+	if span, ok := l.span(ctx); ok {
+		m = append(m, l.spanKeyValues(span)...)
+	} else if l.projectID != "" {
 		cloudTraceHeader, ok := ctx.Value(CloudTraceContextKey).(string)
 		if ok && cloudTraceHeader != "" {
 			// Format: X-Cloud-Trace-Context: TRACE_ID/SPAN_ID;o=TRACE_TRUE
@@ -127,6 +160,25 @@ func (l *Logger) writeLog(ctx context.Context, level string, msg string, keysVal
 	l.logger.Output(0, out)
 }
 
+func (l *Logger) span(ctx context.Context) (Span, bool) {
+	if l.spans == nil {
+		return Span{}, false
+	}
+	return l.spans(ctx)
+}
+
+// spanKeyValues are the special fields of Cloud Logging for span when the project is known
+func (l *Logger) spanKeyValues(span Span) []KeyValue {
+	if l.projectID == "" {
+		return []KeyValue{{"trace_id", span.TraceID}, {"span_id", span.SpanID}}
+	}
+	return []KeyValue{
+		{"logging.googleapis.com/trace", fmt.Sprintf("projects/%s/traces/%s", l.projectID, span.TraceID)},
+		{"logging.googleapis.com/spanId", span.SpanID},
+		{"logging.googleapis.com/trace_sampled", span.Sampled},
+	}
+}
+
 func (l *Logger) marshalJSON(keysValues []KeyValue) (string, error) {
 	var buf strings.Builder
 
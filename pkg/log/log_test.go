@@ -141,6 +141,43 @@ func TestTrace(t *testing.T) {
 	assert.Equal(t, "projects/my-project/traces/58baa99db36bc04802c1519f8769901a", result.Trace)
 }
 
+func TestSpans(t *testing.T) {
+	type spanKey struct{}
+	spans := func(ctx context.Context) (log.Span, bool) {
+		span, ok := ctx.Value(spanKey{}).(log.Span)
+		return span, ok
+	}
+	span := log.Span{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+	ctx := context.WithValue(context.Background(), spanKey{}, span)
+	// the span takes precedence over the trace header
+	ctx = context.WithValue(ctx, log.CloudTraceContextKey, "58baa99db36bc04802c1519f8769901a/0;o=1")
+
+	var b bytes.Buffer
+	l := log.NewJSONLogger(&b, "my-project", false)
+	l.WithSpans(spans)
+	l.Info(ctx, "spanMsg")
+
+	var result struct {
+		LogLine
+		SpanID  string `json:"logging.googleapis.com/spanId"`
+		Sampled bool   `json:"logging.googleapis.com/trace_sampled"`
+	}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &result))
+	assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", result.Trace)
+	assert.Equal(t, "00f067aa0ba902b7", result.SpanID)
+	assert.True(t, result.Sampled)
+
+	b.Reset()
+	l.Info(context.Background(), "withoutSpan")
+	assert.NotContains(t, b.String(), "trace")
+
+	b.Reset()
+	local := log.NewJSONLogger(&b, "", false)
+	local.WithSpans(spans)
+	local.Info(ctx, "localMsg")
+	assert.Contains(t, b.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"`)
+}
+
 func TestTracer(t *testing.T) {
 	traceValue := "58baa99db36bc04802c1519f8769901a/0;o=1"
 
@@ -157,3 +194,24 @@ func TestTracer(t *testing.T) {
 
 	l.Tracer(testHandler).ServeHTTP(nil, req)
 }
+
+func TestWith(t *testing.T) {
+	ctx := log.With(context.Background(), log.KV("principal", "key-1"))
+	ctx = log.With(ctx, log.KV("key", "value"))
+
+	var b bytes.Buffer
+	l := log.NewJSONLogger(&b, "my-project", false)
+
+	l.Info(ctx, "withMsg")
+
+	var result struct {
+		LogLine
+		Principal string `json:"principal"`
+	}
+	err := json.Unmarshal(b.Bytes(), &result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "withMsg", result.Message)
+	assert.Equal(t, "key-1", result.Principal)
+	assert.Equal(t, "value", result.Key)
+}
@@ -0,0 +1,138 @@
+// Package metrics collects Prometheus metrics of HTTP requests, storage operations, the Go runtime and
+// the build of a server in a registry of its own
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute is the route label of requests which did not match a route, so scanners requesting
+// arbitrary paths do not create a series per path
+const unmatchedRoute = "unmatched"
+
+// Route returns the pattern of the route r matched, like "/v1/thing/{uuid}", after r is served
+type Route func(r *http.Request) string
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests   *prometheus.CounterVec
+	durations  *prometheus.HistogramVec
+	inFlight   prometheus.Gauge
+	operations *prometheus.HistogramVec
+	failures   *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "The number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "The duration of HTTP requests by method, route and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "The number of HTTP requests being served.",
+		}),
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_operation_duration_seconds",
+			Help:    "The duration of storage operations by backend and operation.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "operation"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_operation_errors_total",
+			Help: "The number of failed storage operations by backend and operation.",
+		}, []string{"backend", "operation"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.durations,
+		m.inFlight,
+		m.operations,
+		m.failures,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo(),
+	)
+	return m
+}
+
+// buildInfo is always 1, its labels are the version and VCS revision of the main module and the Go version
+func buildInfo() prometheus.Collector {
+	version, revision := "unknown", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "api_build_info",
+		Help: "The build of the server, always 1.",
+		ConstLabels: prometheus.Labels{
+			"version":    version,
+			"revision":   revision,
+			"go_version": runtime.Version(),
+		},
+	})
+	gauge.Set(1)
+	return gauge
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and observes their duration by method, the route returned by route and
+// status code
+func (m *Metrics) Middleware(route Route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			pattern := route(r)
+			if pattern == "" {
+				pattern = unmatchedRoute
+			}
+			labels := prometheus.Labels{"method": r.Method, "route": pattern, "code": strconv.Itoa(status)}
+			m.requests.With(labels).Inc()
+			m.durations.With(labels).Observe(time.Since(start).Seconds())
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ObserveOperation observes the duration of a storage operation started at start, failed operations are
+// counted as errors as well
+func (m *Metrics) ObserveOperation(backend string, operation string, start time.Time, failed bool) {
+	m.operations.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if failed {
+		m.failures.WithLabelValues(backend, operation).Inc()
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	handler := m.Middleware(func(r *http.Request) string {
+		if r.URL.Path == "/v1/thing/abc" {
+			return "/v1/thing/{uuid}"
+		}
+		return ""
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/thing/abc" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("thing"))
+	}))
+
+	for _, target := range []string{"/v1/thing/abc", "/v1/thing/abc", "/wp-login.php"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `http_requests_total{code="200",method="GET",route="/v1/thing/{uuid}"} 2`)
+	assert.Contains(t, body, `http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{code="200",method="GET",route="/v1/thing/{uuid}"} 2`)
+	assert.Contains(t, body, `http_requests_in_flight 0`)
+	assert.Contains(t, body, `go_goroutines`)
+	assert.Contains(t, body, `api_build_info{go_version="go`)
+}
+
+func TestObserveOperation(t *testing.T) {
+	m := New()
+	m.ObserveOperation("postgres", "GetThing", time.Now(), false)
+	m.ObserveOperation("postgres", "GetThing", time.Now(), true)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `db_operation_duration_seconds_count{backend="postgres",operation="GetThing"} 2`)
+	assert.Contains(t, body, `db_operation_errors_total{backend="postgres",operation="GetThing"} 1`)
+}
@@ -0,0 +1,296 @@
+// Package openapi validates http requests and responses against an OpenAPI specification
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+// Load parses a Swagger 2.0 or OpenAPI 3 specification, a Swagger 2.0 specification is converted to OpenAPI 3
+func Load(spec []byte) (*openapi3.T, error) {
+	var version struct {
+		Swagger string `json:"swagger"`
+	}
+	if err := json.Unmarshal(spec, &version); err != nil {
+		return nil, err
+	}
+	if version.Swagger == "" {
+		return openapi3.NewLoader().LoadFromData(spec)
+	}
+
+	var doc2 openapi2.T
+	if err := json.Unmarshal(spec, &doc2); err != nil {
+		return nil, err
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, err
+	}
+	if err := openapi3.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, err
+	}
+	convertProduces(&doc2, doc)
+	convertFileResponses(doc)
+	return doc, nil
+}
+
+// convertProduces describes the responses of an operation in every media type it produces,
+// the conversion only describes them as JSON. Errors of operations producing other content
+// than JSON, such as downloads, are kept as JSON.
+func convertProduces(doc2 *openapi2.T, doc *openapi3.T) {
+	for path, item2 := range doc2.Paths {
+		for method, operation2 := range item2.Operations() {
+			produces := operation2.Produces
+			if len(produces) == 0 {
+				produces = doc2.Produces
+			}
+			if len(produces) == 0 {
+				continue
+			}
+			producesJSON := false
+			for _, mediaType := range produces {
+				producesJSON = producesJSON || mediaType == "application/json"
+			}
+			for status, response := range doc.Paths[path].GetOperation(method).Responses {
+				if response.Value == nil || (!producesJSON && !strings.HasPrefix(status, "2")) {
+					continue
+				}
+				if mediaType := response.Value.Content.Get("application/json"); mediaType != nil {
+					response.Value.Content = openapi3.NewContentWithSchemaRef(mediaType.Schema, produces)
+				}
+			}
+		}
+	}
+}
+
+// convertFileResponses replaces the Swagger 2.0 "file" type of responses, which is not converted,
+// by binary content
+func convertFileResponses(doc *openapi3.T) {
+	for _, item := range doc.Paths {
+		for _, operation := range item.Operations() {
+			for _, response := range operation.Responses {
+				if response.Value == nil {
+					continue
+				}
+				for _, mediaType := range response.Value.Content {
+					if schema := mediaType.Schema; schema != nil && schema.Value != nil && schema.Value.Type == "file" {
+						mediaType.Schema = openapi3.NewSchemaRef("", &openapi3.Schema{Type: openapi3.TypeString, Format: "binary"})
+					}
+				}
+			}
+		}
+	}
+}
+
+// Validator is a middleware validating requests, and optionally responses, against a specification
+type Validator struct {
+	router            routers.Router
+	log               *log.Logger
+	validateResponses bool
+}
+
+type Option func(*Validator)
+
+// WithResponseValidation validates responses as well, a response which does not match the
+// specification is logged, it is meant for development and tests as it buffers every response
+func WithResponseValidation() Option {
+	return func(v *Validator) {
+		v.validateResponses = true
+	}
+}
+
+func NewValidator(doc *openapi3.T, logger *log.Logger, opts ...Option) (*Validator, error) {
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid specification: %w", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	v := &Validator{
+		router: router,
+		log:    logger,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// Middleware rejects requests which do not match the specification with 400 Bad Request,
+// requests for paths and methods which are not in the specification are passed on untouched
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !validatesBody(route, r.Header.Get("Content-Type")),
+				MultiError:         true,
+				// security requirements are enforced by the authentication middleware
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		err = openapi3filter.ValidateRequest(ctx, input)
+		if errors.Is(err, httpx.ErrBodyTooLarge) {
+			httpx.AbortJSON(w, r, http.StatusRequestEntityTooLarge, httpx.ErrBodyTooLarge)
+			return
+		}
+		if err != nil {
+			httpx.AbortJSON(w, r, http.StatusBadRequest, requestValidationError(err))
+			return
+		}
+
+		if !v.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 rec.Header(),
+			Options: &openapi3filter.Options{
+				ExcludeResponseBody:   !isJSON(rec.Header().Get("Content-Type")),
+				IncludeResponseStatus: true,
+			},
+		}
+		responseInput.SetBodyBytes(rec.body.Bytes())
+		if err := openapi3filter.ValidateResponse(ctx, responseInput); err != nil {
+			v.log.Warn(
+				ctx,
+				"response does not match the specification",
+				log.KV("error", err.Error()),
+				log.KV("method", r.Method),
+				log.KV("path", r.URL.Path),
+				log.KV("status", rec.status),
+			)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// requestValidationError turns the errors of a request into a ValidationError, schema errors in
+// the body are reported per field
+func requestValidationError(err error) error {
+	validationErr := &httpx.ValidationError{Message: "request does not match the specification"}
+
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+	for _, err := range errs {
+		var requestErr *openapi3filter.RequestError
+		if !errors.As(err, &requestErr) {
+			validationErr.Fields = append(validationErr.Fields, httpx.FieldError{Message: err.Error()})
+			continue
+		}
+		if requestErr.Parameter != nil {
+			validationErr.Fields = append(validationErr.Fields, httpx.FieldError{
+				Message: fmt.Sprintf("%s parameter %q: %s", requestErr.Parameter.In, requestErr.Parameter.Name, reason(requestErr)),
+			})
+			continue
+		}
+
+		schemaErrs, ok := requestErr.Err.(openapi3.MultiError)
+		if !ok {
+			schemaErrs = openapi3.MultiError{requestErr.Err}
+		}
+		for _, schemaErr := range schemaErrs {
+			validationErr.Fields = append(validationErr.Fields, bodyFieldError(requestErr, schemaErr))
+		}
+	}
+	return validationErr
+}
+
+func bodyFieldError(requestErr *openapi3filter.RequestError, err error) httpx.FieldError {
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return httpx.FieldError{Message: reason(requestErr)}
+	}
+	return httpx.FieldError{
+		Field:   "/" + strings.Join(schemaErr.JSONPointer(), "/"),
+		Message: schemaErr.Reason,
+	}
+}
+
+// reason is the reason of a RequestError without the schema and value details of its cause
+func reason(requestErr *openapi3filter.RequestError) string {
+	var schemaErr *openapi3.SchemaError
+	if errors.As(requestErr.Err, &schemaErr) && schemaErr.Reason != "" {
+		return schemaErr.Reason
+	}
+	if requestErr.Err != nil && requestErr.Reason == "" {
+		return requestErr.Err.Error()
+	}
+	return requestErr.Reason
+}
+
+// validatesBody reports whether a request body of contentType is validated. Multipart bodies are
+// streamed by the handlers instead of being read into memory, not every encoding can be decoded
+// and undocumented media types are left to the handler to reject with 415 Unsupported Media Type.
+func validatesBody(route *routers.Route, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") || openapi3filter.RegisteredBodyDecoder(mediaType) == nil {
+		return false
+	}
+	requestBody := route.Operation.RequestBody
+	return requestBody == nil || requestBody.Value == nil || requestBody.Value.Content.Get(mediaType) != nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json"
+}
+
+// recorder passes a response through while keeping a copy of its status and body
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	if isJSON(r.Header().Get("Content-Type")) {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
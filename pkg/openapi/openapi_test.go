@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+const spec = `{
+	"swagger": "2.0",
+	"info": {"title": "test", "version": "1.0"},
+	"paths": {
+		"/pet/{id}": {
+			"put": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "type": "integer"},
+					{"name": "Body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Pet"}}
+				],
+				"responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/Pet"}}}
+			}
+		},
+		"/pet/{id}/photo": {
+			"get": {
+				"parameters": [{"name": "id", "in": "path", "required": true, "type": "integer"}],
+				"responses": {"200": {"description": "OK", "schema": {"type": "file"}}}
+			}
+		}
+	},
+	"definitions": {
+		"Pet": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {"name": {"type": "string"}, "age": {"type": "integer"}}
+		}
+	}
+}`
+
+func newValidator(t *testing.T, logs *bytes.Buffer) *Validator {
+	doc, err := Load([]byte(spec))
+	assert.NoError(t, err)
+	v, err := NewValidator(doc, log.NewJSONLogger(logs, "", false), WithResponseValidation())
+	assert.NoError(t, err)
+	return v
+}
+
+func serve(handler http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestValidatorRequests(t *testing.T) {
+	v := newValidator(t, &bytes.Buffer{})
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpx.JSON(w, r, map[string]string{"name": "rex"})
+	}))
+
+	w := serve(handler, http.MethodPut, "/pet/1", `{"name": "rex", "age": 3}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(handler, http.MethodPut, "/pet/one", `{"name": "rex"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(handler, http.MethodPut, "/pet/1", `{"age": "three"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response httpx.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "request does not match the specification", response.Error)
+	assert.ElementsMatch(t, []string{"/name", "/age"}, []string{response.Fields[0].Field, response.Fields[1].Field})
+
+	// paths and methods which are not in the specification are left to the router
+	w = serve(handler, http.MethodPost, "/pet/1", `not json`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(handler, http.MethodGet, "/other", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestValidatorResponses(t *testing.T) {
+	var logs bytes.Buffer
+	v := newValidator(t, &logs)
+
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpx.JSON(w, r, map[string]int{"age": 3})
+	}))
+	w := serve(handler, http.MethodPut, "/pet/1", `{"name": "rex"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"age\":3}\n", w.Body.String(), "the response is passed through")
+	assert.Contains(t, logs.String(), "response does not match the specification")
+
+	logs.Reset()
+	handler = v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	}))
+	w = serve(handler, http.MethodGet, "/pet/1/photo", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, logs.String())
+
+	handler = v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpx.AbortJSON(w, r, http.StatusTeapot, errors.New("teapot"))
+	}))
+	serve(handler, http.MethodPut, "/pet/1", `{"name": "rex"}`)
+	assert.Contains(t, logs.String(), "418")
+}
@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+// NewOperation generates the OpenAPI 3 operation of a typed handler, errors are described by a
+// default response with an httpx.ErrorResponse
+func NewOperation(op httpx.Operation) (*openapi3.Operation, error) {
+	operation := openapi3.NewOperation()
+	for _, p := range op.Parameters {
+		parameter := &openapi3.Parameter{
+			Name:     p.Name,
+			In:       p.In,
+			Required: p.Required,
+			Schema:   openapi3.NewSchemaRef("", &openapi3.Schema{Type: p.Type}),
+		}
+		operation.AddParameter(parameter)
+	}
+
+	if op.Body != nil {
+		schema, err := schemaRef(op.Body)
+		if err != nil {
+			return nil, err
+		}
+		operation.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(schema),
+		}
+	}
+
+	operation.Responses = openapi3.Responses{}
+	for _, status := range op.Statuses {
+		response := openapi3.NewResponse().WithDescription(http.StatusText(status))
+		if op.Response != nil {
+			schema, err := schemaRef(op.Response)
+			if err != nil {
+				return nil, err
+			}
+			response.WithJSONSchemaRef(schema)
+		}
+		operation.AddResponse(status, response)
+	}
+
+	errorSchema, err := schemaRef(reflect.TypeOf(httpx.ErrorResponse{}))
+	if err != nil {
+		return nil, err
+	}
+	operation.Responses["default"] = &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithDescription("Error").WithJSONSchemaRef(errorSchema),
+	}
+	return operation, nil
+}
+
+// schemaRef generates the schema of t, a `swaggertype:"object"` tag describes a field as an object
+// as it does for swag, and fields with a `validate:"required"` tag are required
+func schemaRef(t reflect.Type) (*openapi3.SchemaRef, error) {
+	ref, err := openapi3gen.NewGenerator(openapi3gen.SchemaCustomizer(customizeSchema)).GenerateSchemaRef(t)
+	if err != nil {
+		return nil, err
+	}
+	inline(ref, map[*openapi3.Schema]bool{})
+	return ref, nil
+}
+
+// inline removes the references to Go type names the generator adds, they do not point to components
+func inline(ref *openapi3.SchemaRef, seen map[*openapi3.Schema]bool) {
+	if ref == nil || ref.Value == nil || seen[ref.Value] {
+		return
+	}
+	seen[ref.Value] = true
+	ref.Ref = ""
+	inline(ref.Value.Items, seen)
+	for _, property := range ref.Value.Properties {
+		inline(property, seen)
+	}
+	inline(ref.Value.AdditionalProperties, seen)
+}
+
+func customizeSchema(_ string, t reflect.Type, _ reflect.StructTag, schema *openapi3.Schema) error {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	// fields of json.RawMessage are generated without calling the customizer for them
+	for _, f := range jsonFields(t) {
+		name := jsonName(f)
+		if property := schema.Properties[name]; property != nil && f.Tag.Get("swaggertype") == "object" {
+			schema.Properties[name] = openapi3.NewSchemaRef("", openapi3.NewObjectSchema())
+		}
+		if contains(strings.Split(f.Tag.Get("validate"), ","), "required") && !contains(schema.Required, name) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// jsonFields returns the fields of t including the fields of embedded structs
+func jsonFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+type pet struct {
+	Name  string          `json:"name" validate:"required"`
+	Tags  []string        `json:"tags,omitempty"`
+	Extra json.RawMessage `json:"extra" swaggertype:"object"`
+}
+
+func TestNewOperation(t *testing.T) {
+	operation, err := NewOperation(httpx.Operation{
+		Parameters: []httpx.Parameter{
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer"},
+		},
+		Body:     reflect.TypeOf(pet{}),
+		Response: reflect.TypeOf(pet{}),
+		Statuses: []int{http.StatusOK, http.StatusCreated},
+	})
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(operation)
+	assert.NoError(t, err)
+	petSchema := `{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"extra": {"type": "object"}
+		}
+	}`
+	assert.JSONEq(t, `{
+		"parameters": [
+			{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}},
+			{"name": "limit", "in": "query", "schema": {"type": "integer"}}
+		],
+		"requestBody": {"required": true, "content": {"application/json": {"schema": `+petSchema+`}}},
+		"responses": {
+			"200": {"description": "OK", "content": {"application/json": {"schema": `+petSchema+`}}},
+			"201": {"description": "Created", "content": {"application/json": {"schema": `+petSchema+`}}},
+			"default": {"description": "Error", "content": {"application/json": {"schema": {
+				"type": "object",
+				"properties": {
+					"error": {"type": "string"},
+					"fields": {"type": "array", "items": {"type": "object", "properties": {
+						"field": {"type": "string"},
+						"message": {"type": "string"}
+					}}}
+				}
+			}}}}
+		}
+	}`, string(data))
+}
@@ -0,0 +1,195 @@
+// Package ratelimit limits the rate of requests of clients with a token bucket per client
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Limit allows Requests requests per Period, a client can use them all at once after which they are
+// replenished evenly over the period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit like "60/1m" or "10/s" as requests per period
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: expected requests/period", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: invalid number of requests", s)
+	}
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789") {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: invalid period", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// interval is the time in which a single request is replenished
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result is the state of the bucket of a client after taking a request from it
+type Result struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is the number of requests the client can make right away
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when Allowed
+	RetryAfter time.Duration
+}
+
+// bucket is full at tat, the theoretical arrival time of the generic cell rate algorithm: every
+// request moves tat one interval ahead and a request is allowed when tat stays within a period
+type bucket struct {
+	tat time.Time
+}
+
+// Limiter keeps a token bucket per client key, buckets which are full again are forgotten
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a request from the bucket of key
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tat: now}
+		l.buckets[key] = b
+	}
+	tat := b.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	interval := l.limit.interval()
+	next := tat.Add(interval)
+	result := Result{Limit: l.limit}
+	if next.Sub(now) > l.limit.Period {
+		result.RetryAfter = next.Sub(now) - l.limit.Period
+	} else {
+		b.tat = next
+		tat = next
+		result.Allowed = true
+	}
+	result.Reset = tat.Sub(now)
+	result.Remaining = int((l.limit.Period - result.Reset) / interval)
+	return result
+}
+
+// sweep forgets the buckets which are full again, at most once per period
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.limit.Period {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if !b.tat.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// SetHeaders sets the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers of the IETF draft for result, and Retry-After when the request is not allowed
+func SetHeaders(h http.Header, result Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit.Requests, seconds(result.Limit.Period)))
+	if !result.Allowed {
+		h.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	}
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Key returns the key of the bucket of the client of a request
+type Key func(r *http.Request) string
+
+// ClientKey keys requests by their authenticated principal, or by the IP address of the client
+// for requests without one. The IP address is read from ipHeader when set, like the
+// X-Appengine-User-Ip header App Engine sets, and from the remote address otherwise.
+func ClientKey(ipHeader string) Key {
+	return func(r *http.Request) string {
+		if p, ok := auth.FromContext(r.Context()); ok {
+			return "principal:" + p.ID
+		}
+		if ipHeader != "" {
+			if ip := r.Header.Get(ipHeader); ip != "" {
+				return "ip:" + ip
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// Middleware limits the requests of every client to the limit of limiter, requests exceeding it
+// are answered with 429 Too Many Requests. All responses carry the RateLimit headers.
+func Middleware(limiter *Limiter, key Key) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			result := limiter.Allow(key(r))
+			SetHeaders(w.Header(), result)
+			if !result.Allowed {
+				httpx.AbortJSON(w, r, http.StatusTooManyRequests, ErrRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
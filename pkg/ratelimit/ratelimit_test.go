@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Limit{Requests: 3, Period: 3 * time.Second})
+	limiter.now = func() time.Time { return now }
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result := limiter.Allow("a")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result := limiter.Allow("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// other clients have their own bucket
+	assert.True(t, limiter.Allow("b").Allowed)
+
+	now = now.Add(time.Second)
+	result = limiter.Allow("a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.False(t, limiter.Allow("a").Allowed)
+
+	// full buckets are forgotten
+	now = now.Add(time.Minute)
+	assert.Equal(t, 2, limiter.Allow("a").Remaining)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestParseLimit(t *testing.T) {
+	for s, expected := range map[string]Limit{
+		"60/1m":  {Requests: 60, Period: time.Minute},
+		"10/s":   {Requests: 10, Period: time.Second},
+		"5/10s":  {Requests: 5, Period: 10 * time.Second},
+		"1000/h": {Requests: 1000, Period: time.Hour},
+	} {
+		limit, err := ParseLimit(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, limit, s)
+	}
+	for _, s := range []string{"", "60", "0/s", "-1/s", "a/s", "10/", "10/x", "10/-1s"} {
+		_, err := ParseLimit(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewLimiter(Limit{Requests: 2, Period: time.Minute})
+	handler := Middleware(limiter, ClientKey("X-Appengine-User-Ip"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(modify func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		modify(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	fromIP := func(r *http.Request) {}
+
+	w := do(fromIP)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, do(fromIP).Code)
+	w = do(fromIP)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), ErrRateLimited.Error())
+
+	// principals and the IP addresses of the header have buckets of their own
+	w = do(func(r *http.Request) {
+		*r = *r.WithContext(auth.NewContext(r.Context(), auth.Principal{ID: "ak1"}))
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(func(r *http.Request) { r.Header.Set("X-Appengine-User-Ip", "203.0.113.7") })
+	assert.Equal(t, http.StatusOK, w.Code)
+}
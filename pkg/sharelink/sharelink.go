@@ -0,0 +1,159 @@
+// Package sharelink signs links which grant access to a single path without credentials, the links
+// expire and can be revoked by rotating the key they are signed with
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLink = errors.New("invalid share link")
+	ErrExpired     = errors.New("the share link is expired")
+)
+
+// the query parameters of a share link
+const (
+	linkParam      = "link"
+	expiresParam   = "expires"
+	maxUsesParam   = "uses"
+	tenantParam    = "tenant"
+	keyIDParam     = "kid"
+	signatureParam = "sig"
+)
+
+// Key is a signing key, its ID is part of the links it signs
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parses comma separated keys formatted as id:secret with a base64 encoded secret of at
+// least 32 bytes, like "2024-02:c2VjcmV0...,2024-01:b2xk..."
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, part := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key %q: expected id:secret", part)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		if len(decoded) < 32 {
+			return nil, fmt.Errorf("invalid key %s: the secret must be at least 32 bytes", id)
+		}
+		keys = append(keys, Key{ID: id, Secret: decoded})
+	}
+	return keys, nil
+}
+
+// Link grants GET requests to Path until it expires
+type Link struct {
+	// ID identifies the link to count its uses
+	ID      string
+	Path    string
+	Expires time.Time
+	// MaxUses is the number of times the link can be used, zero for unlimited
+	MaxUses int
+	// Tenant is the tenant of the path, the empty string is the default tenant
+	Tenant string
+}
+
+// Signer signs links with its first key and verifies links signed with any of its keys. Keys are
+// rotated by adding a new key in front, removing a key revokes all links signed with it.
+type Signer struct {
+	keys []Key
+	now  func() time.Time
+}
+
+func NewSigner(keys ...Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	return &Signer{keys: keys, now: time.Now}, nil
+}
+
+// Sign returns the path and query of link
+func (s *Signer) Sign(link Link) string {
+	query := url.Values{}
+	query.Set(linkParam, link.ID)
+	query.Set(expiresParam, strconv.FormatInt(link.Expires.Unix(), 10))
+	if link.MaxUses > 0 {
+		query.Set(maxUsesParam, strconv.Itoa(link.MaxUses))
+	}
+	if link.Tenant != "" {
+		query.Set(tenantParam, link.Tenant)
+	}
+	key := s.keys[0]
+	query.Set(keyIDParam, key.ID)
+	query.Set(signatureParam, signature(key, link))
+	return link.Path + "?" + query.Encode()
+}
+
+// Signed reports whether r is made with a share link, which may be invalid
+func Signed(r *http.Request) bool {
+	return r.URL.Query().Has(signatureParam)
+}
+
+// Verify returns the link r is made with. ErrInvalidLink is returned when r is not a GET or HEAD
+// request of the path of a link signed with one of the keys, ErrExpired when the link is expired.
+func (s *Signer) Verify(r *http.Request) (Link, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return Link{}, ErrInvalidLink
+	}
+	query := r.URL.Query()
+	link := Link{
+		ID:     query.Get(linkParam),
+		Path:   r.URL.Path,
+		Tenant: query.Get(tenantParam),
+	}
+	expires, err := strconv.ParseInt(query.Get(expiresParam), 10, 64)
+	if err != nil || link.ID == "" {
+		return Link{}, ErrInvalidLink
+	}
+	link.Expires = time.Unix(expires, 0)
+	if uses := query.Get(maxUsesParam); uses != "" {
+		link.MaxUses, err = strconv.Atoi(uses)
+		if err != nil || link.MaxUses <= 0 {
+			return Link{}, ErrInvalidLink
+		}
+	}
+
+	key, ok := s.key(query.Get(keyIDParam))
+	if !ok {
+		return Link{}, ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(signature(key, link)), []byte(query.Get(signatureParam))) {
+		return Link{}, ErrInvalidLink
+	}
+	if !s.now().Before(link.Expires) {
+		return Link{}, ErrExpired
+	}
+	return link, nil
+}
+
+func (s *Signer) key(id string) (Key, bool) {
+	for _, key := range s.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// signature is the HMAC-SHA256 of all fields of link with key
+func signature(key Key, link Link) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d\n%s\n%s", key.ID, link.ID, link.Expires.Unix(), link.MaxUses, link.Tenant, link.Path)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,94 @@
+package sharelink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	current := Key{ID: "2", Secret: bytes.Repeat([]byte("b"), 32)}
+	previous := Key{ID: "1", Secret: bytes.Repeat([]byte("a"), 32)}
+	oldSigner, err := NewSigner(previous)
+	require.NoError(t, err)
+	signer, err := NewSigner(current, previous)
+	require.NoError(t, err)
+	oldSigner.now = func() time.Time { return now }
+	signer.now = func() time.Time { return now }
+
+	link := Link{ID: "abc", Path: "/v1/thing/123", Expires: now.Add(time.Hour), MaxUses: 3, Tenant: "acme"}
+	signed := signer.Sign(link)
+	assert.Contains(t, signed, "kid=2")
+
+	r := httptest.NewRequest(http.MethodGet, signed, nil)
+	assert.True(t, Signed(r))
+	verified, err := signer.Verify(r)
+	require.NoError(t, err)
+	assert.Equal(t, link, verified)
+
+	// links of the previous key are valid until it is removed
+	byPrevious := oldSigner.Sign(link)
+	_, err = signer.Verify(httptest.NewRequest(http.MethodGet, byPrevious, nil))
+	assert.NoError(t, err)
+	rotated, err := NewSigner(current)
+	require.NoError(t, err)
+	_, err = rotated.Verify(httptest.NewRequest(http.MethodGet, byPrevious, nil))
+	assert.Equal(t, ErrInvalidLink, err)
+
+	tamper := func(key string, value string) string {
+		u, err := url.Parse(signed)
+		require.NoError(t, err)
+		query := u.Query()
+		query.Set(key, value)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	for name, target := range map[string]string{
+		"other path":      "/v1/thing/456?" + signed[len(link.Path)+1:],
+		"later expiry":    tamper("expires", "1800000000"),
+		"more uses":       tamper("uses", "4"),
+		"other tenant":    tamper("tenant", "globex"),
+		"other link":      tamper("link", "def"),
+		"unknown key":     tamper("kid", "3"),
+		"no signature":    tamper("sig", ""),
+		"invalid uses":    tamper("uses", "-1"),
+		"without link":    tamper("link", ""),
+		"wrong signature": tamper("sig", "AAAA"),
+		"invalid expiry":  tamper("expires", "tomorrow"),
+		"default tenant":  tamper("tenant", ""),
+	} {
+		_, err := signer.Verify(httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, ErrInvalidLink, err, name)
+	}
+
+	_, err = signer.Verify(httptest.NewRequest(http.MethodPut, signed, nil))
+	assert.Equal(t, ErrInvalidLink, err)
+
+	signer.now = func() time.Time { return now.Add(time.Hour) }
+	_, err = signer.Verify(httptest.NewRequest(http.MethodGet, signed, nil))
+	assert.Equal(t, ErrExpired, err)
+
+	assert.False(t, Signed(httptest.NewRequest(http.MethodGet, "/v1/thing/123", nil)))
+}
+
+func TestParseKeys(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32))
+	keys, err := ParseKeys("2:" + secret + ", 1:" + secret)
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "2", keys[0].ID)
+	assert.Equal(t, "1", keys[1].ID)
+
+	for _, s := range []string{"", secret, ":" + secret, "1:not base64", "1:" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := ParseKeys(s)
+		assert.Error(t, err, s)
+	}
+}
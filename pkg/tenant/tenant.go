@@ -0,0 +1,176 @@
+// Package tenant resolves the tenant of requests, the data of every tenant is stored separately
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/httpx"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+var (
+	ErrNoTenant           = errors.New("no tenant")
+	ErrInvalidTenant      = errors.New("invalid tenant")
+	ErrTenantMismatch     = errors.New("the tenant of the request does not match the tenant of the credentials")
+	ErrUnboundCredentials = errors.New("the credentials are not bound to a tenant")
+)
+
+// KeyClaim is the claim holding the tenant of principals authenticated with an API key
+const KeyClaim = "tenant"
+
+// validID matches tenant ids, they are used as Datastore namespace and Postgres value
+var validID = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Valid reports whether id is a valid tenant id: lowercase alphanumerics and '-', at most 63 characters
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant of ctx, the empty string is the default tenant
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Resolver resolves the tenant of a request, it returns the empty string when the request does
+// not identify a tenant
+type Resolver interface {
+	Resolve(r *http.Request) (string, error)
+}
+
+// ResolverFunc is a function which implements Resolver
+type ResolverFunc func(r *http.Request) (string, error)
+
+func (f ResolverFunc) Resolve(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// Header resolves the tenant from a request header, like X-Tenant
+func Header(name string) Resolver {
+	return header(http.CanonicalHeaderKey(name))
+}
+
+// header is the Resolver returned by Header, Headers reports its name
+type header string
+
+func (h header) Resolve(r *http.Request) (string, error) {
+	return r.Header.Get(string(h)), nil
+}
+
+// Headers returns the names of the request headers resolvers resolve the tenant from, responses
+// vary by them
+func Headers(resolvers ...Resolver) []string {
+	var names []string
+	for _, resolver := range resolvers {
+		if h, ok := resolver.(header); ok {
+			names = append(names, string(h))
+		}
+	}
+	return names
+}
+
+// Subdomain resolves the tenant from the subdomain of domain in the Host of the request,
+// acme.api.example.com is tenant acme of domain api.example.com
+func Subdomain(domain string) Resolver {
+	suffix := "." + strings.ToLower(domain)
+	return ResolverFunc(func(r *http.Request) (string, error) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return "", nil
+		}
+		return strings.TrimSuffix(host, suffix), nil
+	})
+}
+
+// Claim resolves the tenant from a string claim of the principal the request is authenticated with,
+// it binds the credentials of the principal to its tenant
+func Claim(name string) Resolver {
+	return claim(name)
+}
+
+// claim is the Resolver returned by Claim, Resolve recognizes it as the tenant of the credentials
+type claim string
+
+func (c claim) Resolve(r *http.Request) (string, error) {
+	p, _ := auth.FromContext(r.Context())
+	id, _ := p.Claims[string(c)].(string)
+	return id, nil
+}
+
+// Resolve resolves the tenant of r with all resolvers, which must agree on it. ErrNoTenant is
+// returned when none resolves a tenant, ErrInvalidTenant for an invalid tenant id and
+// ErrTenantMismatch when resolvers disagree. An authenticated request must be bound to its tenant
+// by a Claim of its principal, ErrUnboundCredentials is returned when the tenant is only resolved
+// from the request itself, like from a header or the subdomain.
+func Resolve(r *http.Request, resolvers ...Resolver) (string, error) {
+	var id string
+	var bound bool
+	for _, resolver := range resolvers {
+		resolved, err := resolver.Resolve(r)
+		if err != nil {
+			return "", err
+		}
+		if resolved == "" {
+			continue
+		}
+		if !Valid(resolved) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidTenant, resolved)
+		}
+		if id != "" && id != resolved {
+			return "", ErrTenantMismatch
+		}
+		id = resolved
+		if _, ok := resolver.(claim); ok {
+			bound = true
+		}
+	}
+	if id == "" {
+		return "", ErrNoTenant
+	}
+	if _, ok := auth.FromContext(r.Context()); ok && !bound {
+		return "", ErrUnboundCredentials
+	}
+	return id, nil
+}
+
+// Middleware adds the tenant resolved by resolvers to the context of requests and to their log
+// statements. Requests without a valid tenant are answered with 400 Bad Request, requests whose
+// resolvers disagree or whose credentials are not bound to the tenant with 403 Forbidden.
+func Middleware(resolvers ...Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			id, err := Resolve(r, resolvers...)
+			switch {
+			case err == ErrNoTenant, errors.Is(err, ErrInvalidTenant):
+				httpx.AbortJSON(w, r, http.StatusBadRequest, err)
+				return
+			case err == ErrTenantMismatch, err == ErrUnboundCredentials:
+				httpx.AbortJSON(w, r, http.StatusForbidden, err)
+				return
+			case err != nil:
+				httpx.AbortJSON(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			ctx := log.With(NewContext(r.Context(), id), log.KV("tenant", id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
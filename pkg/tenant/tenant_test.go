@@ -0,0 +1,117 @@
+package tenant_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ldej/api-ldej-nl/pkg/auth"
+	"github.com/ldej/api-ldej-nl/pkg/log"
+	"github.com/ldej/api-ldej-nl/pkg/tenant"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.NewJSONLogger(&logs, "", false)
+	handler := tenant.Middleware(
+		tenant.Header("X-Tenant"),
+		tenant.Subdomain("api.example.com"),
+		tenant.Claim("tenant"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Info(r.Context(), "handled")
+		w.Write([]byte(tenant.FromContext(r.Context())))
+	}))
+
+	tests := []struct {
+		name   string
+		host   string
+		header string
+		claim  string
+		code   int
+		tenant string
+	}{
+		{"header", "localhost:8080", "acme", "", http.StatusOK, "acme"},
+		{"subdomain", "acme.api.example.com", "", "", http.StatusOK, "acme"},
+		{"subdomain with port", "acme.API.example.com:443", "", "", http.StatusOK, "acme"},
+		{"claim", "localhost", "", "acme", http.StatusOK, "acme"},
+		{"agreeing", "acme.api.example.com", "acme", "acme", http.StatusOK, "acme"},
+		{"no tenant", "api.example.com", "", "", http.StatusBadRequest, ""},
+		{"invalid tenant", "localhost", "Acme Inc", "", http.StatusBadRequest, ""},
+		{"nested subdomain", "a.b.api.example.com", "", "", http.StatusBadRequest, ""},
+		{"header of another tenant", "localhost", "globex", "acme", http.StatusForbidden, ""},
+		{"subdomain of another tenant", "globex.api.example.com", "", "acme", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs.Reset()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = test.host
+			if test.header != "" {
+				r.Header.Set("X-Tenant", test.header)
+			}
+			if test.claim != "" {
+				r = r.WithContext(auth.NewContext(r.Context(), auth.Principal{ID: "user", Claims: map[string]interface{}{"tenant": test.claim}}))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+			if test.code == http.StatusOK {
+				assert.Equal(t, test.tenant, w.Body.String())
+				assert.Contains(t, logs.String(), `"tenant":"`+test.tenant+`"`)
+			}
+		})
+	}
+}
+
+func TestResolveUnboundCredentials(t *testing.T) {
+	resolvers := []tenant.Resolver{tenant.Header("X-Tenant"), tenant.Claim("tenant")}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", "acme")
+
+	// unauthenticated requests are resolved by the header alone
+	id, err := tenant.Resolve(r, resolvers...)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", id)
+
+	// the credentials of authenticated requests must be bound to the tenant
+	unbound := r.WithContext(auth.NewContext(r.Context(), auth.Principal{ID: "key:1"}))
+	_, err = tenant.Resolve(unbound, resolvers...)
+	assert.Equal(t, tenant.ErrUnboundCredentials, err)
+
+	bound := r.WithContext(auth.NewContext(r.Context(), auth.Principal{ID: "key:1", Claims: map[string]interface{}{"tenant": "acme"}}))
+	id, err = tenant.Resolve(bound, resolvers...)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", id)
+
+	// without a Claim resolver no credentials are bound
+	_, err = tenant.Resolve(bound, tenant.Header("X-Tenant"))
+	assert.Equal(t, tenant.ErrUnboundCredentials, err)
+}
+
+func TestHeaders(t *testing.T) {
+	headers := tenant.Headers(tenant.Header("x-tenant"), tenant.Subdomain("api.example.com"), tenant.Claim("tenant"))
+	assert.Equal(t, []string{"X-Tenant"}, headers)
+	assert.Empty(t, tenant.Headers())
+}
+
+func TestValid(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"acme":     true,
+		"acme-eu":  true,
+		"a1":       true,
+		"":         false,
+		"-acme":    false,
+		"acme-":    false,
+		"Acme":     false,
+		"acme.eu":  false,
+		"acme_eu":  false,
+		"ac/me":    false,
+		"a-b-c-de": true,
+	} {
+		assert.Equal(t, valid, tenant.Valid(id), id)
+	}
+}
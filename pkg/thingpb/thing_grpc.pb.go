@@ -0,0 +1,314 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package thingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ThingServiceClient is the client API for ThingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ThingServiceClient interface {
+	GetThing(ctx context.Context, in *GetThingRequest, opts ...grpc.CallOption) (*Thing, error)
+	CreateThing(ctx context.Context, in *CreateThingRequest, opts ...grpc.CallOption) (*Thing, error)
+	// UpdateThing updates a thing, or creates it with the given uuid when it does not exist yet and a name is given
+	UpdateThing(ctx context.Context, in *UpdateThingRequest, opts ...grpc.CallOption) (*UpdateThingResponse, error)
+	DeleteThing(ctx context.Context, in *DeleteThingRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ListThings(ctx context.Context, in *ListThingsRequest, opts ...grpc.CallOption) (*ListThingsResponse, error)
+	// StreamThings streams all things matching the label selector
+	StreamThings(ctx context.Context, in *StreamThingsRequest, opts ...grpc.CallOption) (ThingService_StreamThingsClient, error)
+}
+
+type thingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewThingServiceClient(cc grpc.ClientConnInterface) ThingServiceClient {
+	return &thingServiceClient{cc}
+}
+
+func (c *thingServiceClient) GetThing(ctx context.Context, in *GetThingRequest, opts ...grpc.CallOption) (*Thing, error) {
+	out := new(Thing)
+	err := c.cc.Invoke(ctx, "/thing.v1.ThingService/GetThing", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thingServiceClient) CreateThing(ctx context.Context, in *CreateThingRequest, opts ...grpc.CallOption) (*Thing, error) {
+	out := new(Thing)
+	err := c.cc.Invoke(ctx, "/thing.v1.ThingService/CreateThing", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thingServiceClient) UpdateThing(ctx context.Context, in *UpdateThingRequest, opts ...grpc.CallOption) (*UpdateThingResponse, error) {
+	out := new(UpdateThingResponse)
+	err := c.cc.Invoke(ctx, "/thing.v1.ThingService/UpdateThing", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thingServiceClient) DeleteThing(ctx context.Context, in *DeleteThingRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/thing.v1.ThingService/DeleteThing", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thingServiceClient) ListThings(ctx context.Context, in *ListThingsRequest, opts ...grpc.CallOption) (*ListThingsResponse, error) {
+	out := new(ListThingsResponse)
+	err := c.cc.Invoke(ctx, "/thing.v1.ThingService/ListThings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thingServiceClient) StreamThings(ctx context.Context, in *StreamThingsRequest, opts ...grpc.CallOption) (ThingService_StreamThingsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ThingService_ServiceDesc.Streams[0], "/thing.v1.ThingService/StreamThings", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &thingServiceStreamThingsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ThingService_StreamThingsClient interface {
+	Recv() (*Thing, error)
+	grpc.ClientStream
+}
+
+type thingServiceStreamThingsClient struct {
+	grpc.ClientStream
+}
+
+func (x *thingServiceStreamThingsClient) Recv() (*Thing, error) {
+	m := new(Thing)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ThingServiceServer is the server API for ThingService service.
+// All implementations must embed UnimplementedThingServiceServer
+// for forward compatibility
+type ThingServiceServer interface {
+	GetThing(context.Context, *GetThingRequest) (*Thing, error)
+	CreateThing(context.Context, *CreateThingRequest) (*Thing, error)
+	// UpdateThing updates a thing, or creates it with the given uuid when it does not exist yet and a name is given
+	UpdateThing(context.Context, *UpdateThingRequest) (*UpdateThingResponse, error)
+	DeleteThing(context.Context, *DeleteThingRequest) (*emptypb.Empty, error)
+	ListThings(context.Context, *ListThingsRequest) (*ListThingsResponse, error)
+	// StreamThings streams all things matching the label selector
+	StreamThings(*StreamThingsRequest, ThingService_StreamThingsServer) error
+	mustEmbedUnimplementedThingServiceServer()
+}
+
+// UnimplementedThingServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedThingServiceServer struct {
+}
+
+func (UnimplementedThingServiceServer) GetThing(context.Context, *GetThingRequest) (*Thing, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetThing not implemented")
+}
+func (UnimplementedThingServiceServer) CreateThing(context.Context, *CreateThingRequest) (*Thing, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateThing not implemented")
+}
+func (UnimplementedThingServiceServer) UpdateThing(context.Context, *UpdateThingRequest) (*UpdateThingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateThing not implemented")
+}
+func (UnimplementedThingServiceServer) DeleteThing(context.Context, *DeleteThingRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteThing not implemented")
+}
+func (UnimplementedThingServiceServer) ListThings(context.Context, *ListThingsRequest) (*ListThingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListThings not implemented")
+}
+func (UnimplementedThingServiceServer) StreamThings(*StreamThingsRequest, ThingService_StreamThingsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamThings not implemented")
+}
+func (UnimplementedThingServiceServer) mustEmbedUnimplementedThingServiceServer() {}
+
+// UnsafeThingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ThingServiceServer will
+// result in compilation errors.
+type UnsafeThingServiceServer interface {
+	mustEmbedUnimplementedThingServiceServer()
+}
+
+func RegisterThingServiceServer(s grpc.ServiceRegistrar, srv ThingServiceServer) {
+	s.RegisterService(&ThingService_ServiceDesc, srv)
+}
+
+func _ThingService_GetThing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetThingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThingServiceServer).GetThing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thing.v1.ThingService/GetThing",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThingServiceServer).GetThing(ctx, req.(*GetThingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ThingService_CreateThing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateThingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThingServiceServer).CreateThing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thing.v1.ThingService/CreateThing",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThingServiceServer).CreateThing(ctx, req.(*CreateThingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ThingService_UpdateThing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateThingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThingServiceServer).UpdateThing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thing.v1.ThingService/UpdateThing",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThingServiceServer).UpdateThing(ctx, req.(*UpdateThingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ThingService_DeleteThing_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteThingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThingServiceServer).DeleteThing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thing.v1.ThingService/DeleteThing",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThingServiceServer).DeleteThing(ctx, req.(*DeleteThingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ThingService_ListThings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListThingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThingServiceServer).ListThings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thing.v1.ThingService/ListThings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThingServiceServer).ListThings(ctx, req.(*ListThingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ThingService_StreamThings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamThingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ThingServiceServer).StreamThings(m, &thingServiceStreamThingsServer{stream})
+}
+
+type ThingService_StreamThingsServer interface {
+	Send(*Thing) error
+	grpc.ServerStream
+}
+
+type thingServiceStreamThingsServer struct {
+	grpc.ServerStream
+}
+
+func (x *thingServiceStreamThingsServer) Send(m *Thing) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ThingService_ServiceDesc is the grpc.ServiceDesc for ThingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ThingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "thing.v1.ThingService",
+	HandlerType: (*ThingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetThing",
+			Handler:    _ThingService_GetThing_Handler,
+		},
+		{
+			MethodName: "CreateThing",
+			Handler:    _ThingService_CreateThing_Handler,
+		},
+		{
+			MethodName: "UpdateThing",
+			Handler:    _ThingService_UpdateThing_Handler,
+		},
+		{
+			MethodName: "DeleteThing",
+			Handler:    _ThingService_DeleteThing_Handler,
+		},
+		{
+			MethodName: "ListThings",
+			Handler:    _ThingService_ListThings_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamThings",
+			Handler:       _ThingService_StreamThings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "thing/v1/thing.proto",
+}
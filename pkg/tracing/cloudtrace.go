@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+// CloudTraceContext propagates the trace context with the X-Cloud-Trace-Context header of Google Cloud,
+// formatted as TRACE_ID/SPAN_ID;o=OPTIONS with a hexadecimal trace ID and a decimal span ID. Headers
+// with a span ID of 0 are ignored, a span context without a span ID is invalid.
+type CloudTraceContext struct{}
+
+var _ propagation.TextMapPropagator = CloudTraceContext{}
+
+func (CloudTraceContext) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	spanID := sc.SpanID()
+	sampled := 0
+	if sc.IsSampled() {
+		sampled = 1
+	}
+	carrier.Set(log.TraceHeader, fmt.Sprintf("%s/%d;o=%d", sc.TraceID(), binary.BigEndian.Uint64(spanID[:]), sampled))
+}
+
+func (CloudTraceContext) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := parseCloudTraceContext(carrier.Get(log.TraceHeader))
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (CloudTraceContext) Fields() []string {
+	return []string{log.TraceHeader}
+}
+
+func parseCloudTraceContext(header string) (trace.SpanContext, bool) {
+	traceID, rest, ok := strings.Cut(header, "/")
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	spanID, options, _ := strings.Cut(rest, ";")
+
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sid, err := strconv.ParseUint(spanID, 10, 64)
+	if err != nil || sid == 0 {
+		return trace.SpanContext{}, false
+	}
+	config := trace.SpanContextConfig{TraceID: tid, Remote: true}
+	binary.BigEndian.PutUint64(config.SpanID[:], sid)
+	if options == "o=1" {
+		config.TraceFlags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(config), true
+}
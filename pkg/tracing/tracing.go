@@ -0,0 +1,89 @@
+// Package tracing traces requests with OpenTelemetry, the trace context is propagated with the W3C
+// traceparent header and the X-Cloud-Trace-Context header of Google Cloud
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+// Route returns the pattern of the route r matched, like "/v1/thing/{uuid}", after r is served
+type Route func(r *http.Request) string
+
+// NewProvider samples ratio of the traces which are not sampled by the caller already and exports
+// their spans in batches to exporter
+func NewProvider(exporter sdktrace.SpanExporter, serviceName string, ratio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+}
+
+// NewOTLPExporter exports spans to an OpenTelemetry collector over HTTP, it is configured with the
+// OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS environment variables
+func NewOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(ctx)
+}
+
+// NewWriterExporter writes spans to w as a JSON document per span, for development without a collector
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// Propagator extracts and injects both traceparent and X-Cloud-Trace-Context, traceparent takes
+// precedence when a request has both
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(CloudTraceContext{}, propagation.TraceContext{})
+}
+
+// SpanIDs returns the span of ctx for log.Logger.WithSpans
+func SpanIDs(ctx context.Context) (log.Span, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return log.Span{}, false
+	}
+	return log.Span{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Sampled: sc.IsSampled()}, true
+}
+
+// Middleware starts a span for every request as a child of the trace context propagated by its caller,
+// the span is named after the method and the route returned by route
+func Middleware(tracer trace.Tracer, propagator propagation.TextMapPropagator, route Route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+			))
+			defer span.End()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if pattern := route(r); pattern != "" {
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttributes(semconv.HTTPRouteKey.String(pattern))
+			}
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
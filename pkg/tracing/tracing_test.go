@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ldej/api-ldej-nl/pkg/log"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	cloudTrace  = "58baa99db36bc04802c1519f8769901a/67667974448284343;o=1"
+)
+
+func TestCloudTraceContext(t *testing.T) {
+	carrier := propagation.HeaderCarrier(http.Header{})
+	carrier.Set(log.TraceHeader, cloudTrace)
+	sc := trace.SpanContextFromContext(CloudTraceContext{}.Extract(context.Background(), carrier))
+	require.True(t, sc.IsValid())
+	assert.Equal(t, "58baa99db36bc04802c1519f8769901a", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+	assert.True(t, sc.IsRemote())
+
+	injected := propagation.HeaderCarrier(http.Header{})
+	CloudTraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), injected)
+	assert.Equal(t, cloudTrace, injected.Get(log.TraceHeader))
+
+	for _, header := range []string{"", "58baa99db36bc04802c1519f8769901a", "58baa99db36bc04802c1519f8769901a/0;o=1", "invalid/1;o=1", "58baa99db36bc04802c1519f8769901a/span"} {
+		carrier.Set(log.TraceHeader, header)
+		ctx := CloudTraceContext{}.Extract(context.Background(), carrier)
+		assert.False(t, trace.SpanContextFromContext(ctx).IsValid(), header)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var logged bytes.Buffer
+	logger := log.NewJSONLogger(&logged, "my-project", false)
+	logger.WithSpans(SpanIDs)
+
+	handler := Middleware(provider.Tracer("test"), Propagator(), func(r *http.Request) string {
+		if r.URL.Path == "/v1/thing/abc" {
+			return "/v1/thing/{uuid}"
+		}
+		return ""
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Info(r.Context(), "handled")
+		if r.URL.Path != "/v1/thing/abc" {
+			http.Error(w, "failed", http.StatusInternalServerError)
+		}
+	}))
+
+	serve := func(target string, header http.Header) sdktrace.ReadOnlySpan {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		spans := recorder.Ended()
+		require.NotEmpty(t, spans)
+		return spans[len(spans)-1]
+	}
+
+	span := serve("/v1/thing/abc", http.Header{"Traceparent": {traceparent}})
+	assert.Equal(t, "GET /v1/thing/{uuid}", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, logged.String(), `"logging.googleapis.com/trace":"projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, logged.String(), `"logging.googleapis.com/spanId":"`+span.SpanContext().SpanID().String()+`"`)
+
+	span = serve("/v1/thing/abc", http.Header{log.TraceHeader: {cloudTrace}})
+	assert.Equal(t, "58baa99db36bc04802c1519f8769901a", span.SpanContext().TraceID().String())
+
+	// traceparent takes precedence over X-Cloud-Trace-Context
+	span = serve("/v1/thing/abc", http.Header{"Traceparent": {traceparent}, log.TraceHeader: {cloudTrace}})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+
+	span = serve("/unknown", nil)
+	assert.Equal(t, "GET", span.Name())
+	assert.False(t, span.Parent().IsValid())
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
@@ -0,0 +1,16 @@
+package swagger
+
+import (
+	"embed"
+)
+
+// UI is the Swagger UI, it shows the specification served at /openapi.json
+//
+//go:embed index.html oauth2-redirect.html favicon-16x16.png favicon-32x32.png
+//go:embed swagger-ui.css swagger-ui-bundle.js swagger-ui-standalone-preset.js
+var UI embed.FS
+
+// OpenAPI is the OpenAPI 3 specification of the API, generated from swagger.json by cmd/openapigen
+//
+//go:embed openapi.json
+var OpenAPI []byte